@@ -3,16 +3,21 @@ CREATE TABLE IF NOT EXISTS books (
     id SERIAL PRIMARY KEY,
     title VARCHAR(255) NOT NULL,
     author VARCHAR(255) NOT NULL,
-    isbn VARCHAR(20) UNIQUE,
+    isbn VARCHAR(20),
     publication_year VARCHAR(4),
     genre VARCHAR(100),
     price DECIMAL(10, 2),
+    cover_url TEXT,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+-- One book per ISBN; books without one don't conflict. The app creates the
+-- same index on startup.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_books_isbn ON books (isbn) WHERE isbn <> '';
+
 INSERT INTO books (title, author, isbn, publication_year, genre, price) VALUES
 ('The Go Programming Language', 'Alan Donovan, Brian Kernighan', '9780134190440', '2015', 'Programming', 45.99),
 ('Clean Code', 'Robert C. Martin', '9780132350884', '2008', 'Programming', 42.99),
 ('The Pragmatic Programmer', 'David Thomas, Andrew Hunt', '9780135957059', '2019', 'Programming', 39.99)
-ON CONFLICT (isbn) DO NOTHING;
+ON CONFLICT (isbn) WHERE isbn <> '' DO NOTHING;
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -10,6 +11,7 @@ import (
 	"strconv"
 	"testing"
 
+	"github.com/adedaryorh/bookstore-app/pkg/config"
 	"github.com/adedaryorh/bookstore-app/pkg/models"
 	"github.com/adedaryorh/bookstore-app/pkg/routes"
 	"github.com/julienschmidt/httprouter"
@@ -23,6 +25,17 @@ func TestMain(m *testing.M) {
 	os.Setenv("DB_PASSWORD", "bookstore_pass")
 	os.Setenv("DB_NAME", "bookstore_test")
 
+	cfg, err := config.Load(nil)
+	if err != nil {
+		panic(err)
+	}
+	if err := config.Connect(context.Background(), cfg.Database); err != nil {
+		panic(err)
+	}
+	if err := models.Init(); err != nil {
+		panic(err)
+	}
+
 	// Run tests
 	code := m.Run()
 	os.Exit(code)
@@ -31,12 +44,12 @@ func TestMain(m *testing.M) {
 func TestBookCRUDFlow(t *testing.T) {
 
 	router := httprouter.New()
-	routes.RegisterRoutes(router)
+	routes.RegisterRoutes(router, routes.Options{})
 
 	testBook := models.Book{
 		Title:           "Integration Test Book",
 		Author:          "Lincoln Author",
-		ISBN:            "9999999999999",
+		ISBN:            "9789999999991",
 		PublicationYear: "2023",
 		Genre:           stringPtr("Testing"),
 		Price:           float64Ptr(99.99),
@@ -161,7 +174,7 @@ func TestBookCRUDFlow(t *testing.T) {
 
 func TestHealthCheck(t *testing.T) {
 	router := httprouter.New()
-	routes.RegisterRoutes(router)
+	routes.RegisterRoutes(router, routes.Options{})
 
 	req, _ := http.NewRequest("GET", "/health", nil)
 	rr := httptest.NewRecorder()
@@ -178,7 +191,7 @@ func TestHealthCheck(t *testing.T) {
 
 func TestErrorScenarios(t *testing.T) {
 	router := httprouter.New()
-	routes.RegisterRoutes(router)
+	routes.RegisterRoutes(router, routes.Options{})
 
 	t.Run("Get Non-existent Book", func(t *testing.T) {
 		req, _ := http.NewRequest("GET", "/book/99999", nil)
@@ -237,7 +250,7 @@ func TestErrorScenarios(t *testing.T) {
 
 func TestMultipleGetEndpoints(t *testing.T) {
 	router := httprouter.New()
-	routes.RegisterRoutes(router)
+	routes.RegisterRoutes(router, routes.Options{})
 
 	t.Run("GET /book", func(t *testing.T) {
 		req, _ := http.NewRequest("GET", "/book", nil)
@@ -272,8 +285,9 @@ func TestMultipleGetEndpoints(t *testing.T) {
 
 func TestConcurrentOperations(t *testing.T) {
 	router := httprouter.New()
-	routes.RegisterRoutes(router)
-	bookCount := 5
+	routes.RegisterRoutes(router, routes.Options{})
+	isbns := []string{"9781234567804", "9781234567811", "9781234567828", "9781234567835", "9781234567842"}
+	bookCount := len(isbns)
 	results := make(chan error, bookCount)
 
 	for i := 0; i < bookCount; i++ {
@@ -281,7 +295,7 @@ func TestConcurrentOperations(t *testing.T) {
 			testBook := models.Book{
 				Title:           fmt.Sprintf("Concurrent Book %d", index),
 				Author:          fmt.Sprintf("Author %d", index),
-				ISBN:            fmt.Sprintf("123456789012%d", index),
+				ISBN:            isbns[index],
 				PublicationYear: "2023",
 			}
 
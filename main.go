@@ -1,18 +1,281 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/adedaryorh/bookstore-app/pkg/cache"
+	"github.com/adedaryorh/bookstore-app/pkg/catalogpb"
+	"github.com/adedaryorh/bookstore-app/pkg/config"
+	"github.com/adedaryorh/bookstore-app/pkg/controllers"
+	"github.com/adedaryorh/bookstore-app/pkg/enrich"
+	"github.com/adedaryorh/bookstore-app/pkg/importer"
+	"github.com/adedaryorh/bookstore-app/pkg/logging"
+	"github.com/adedaryorh/bookstore-app/pkg/middleware"
+	"github.com/adedaryorh/bookstore-app/pkg/models"
+	"github.com/adedaryorh/bookstore-app/pkg/outbox"
 	"github.com/adedaryorh/bookstore-app/pkg/routes"
+	"github.com/adedaryorh/bookstore-app/pkg/storage"
+	"github.com/adedaryorh/bookstore-app/pkg/stream"
+	"github.com/adedaryorh/bookstore-app/pkg/tracing"
+	"github.com/adedaryorh/bookstore-app/pkg/webhooks"
 	"github.com/julienschmidt/httprouter"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
 )
 
 func main() {
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error loading configuration:", err)
+		os.Exit(2)
+	}
+
+	if err := logging.Setup(logging.Options{Level: cfg.Log.Level, Format: cfg.Log.Format}); err != nil {
+		fmt.Fprintln(os.Stderr, "Error setting up logging:", err)
+		os.Exit(1)
+	}
+	slog.Info("configuration loaded", "config", cfg)
+
+	if err := run(cfg); err != nil {
+		slog.Error("bookstore server stopped", "error", err)
+		os.Exit(1)
+	}
+}
+
+func run(cfg *config.Config) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Options{
+		Exporter:    cfg.Tracing.Exporter,
+		File:        cfg.Tracing.File,
+		ServiceName: cfg.Tracing.ServiceName,
+	})
+	if err != nil {
+		return fmt.Errorf("setting up tracing: %w", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	if err := config.Connect(ctx, cfg.Database); err != nil {
+		return err
+	}
+	if err := models.Init(); err != nil {
+		return fmt.Errorf("migrating database: %w", err)
+	}
+	models.UseReplicas(ctx, config.GetReplicas(), models.ReplicaOptions{
+		HealthInterval:       cfg.Database.ReplicaHealthInterval,
+		ReadYourWritesWindow: cfg.Database.ReadYourWritesWindow,
+	})
+	if cfg.Cache.Size > 0 {
+		models.UseCache(cache.NewLRU(cfg.Cache.Size), cfg.Cache.TTL)
+	}
+	controllers.UseONIX(cfg.ONIX.SenderName, cfg.ONIX.Currency)
+	if cfg.ONIX.FeedURL != "" {
+		feed := &importer.Feed{
+			URL:      cfg.ONIX.FeedURL,
+			Interval: cfg.ONIX.FeedInterval,
+			Currency: cfg.ONIX.Currency,
+			Client:   &http.Client{Timeout: 5 * time.Minute},
+		}
+		go feed.Run(ctx)
+	}
+	if p := newEnricher(cfg.Enrich); p != nil {
+		controllers.UseEnrichment(p, cfg.Enrich.OnCreate)
+	}
+	if cfg.Covers.Dir != "" {
+		store, err := storage.NewLocal(cfg.Covers.Dir)
+		if err != nil {
+			return err
+		}
+		controllers.UseCovers(store, int64(cfg.Covers.MaxBytes))
+	}
+	hub := stream.NewHub(cfg.Stream.BufferSize)
+	models.OnEvent(hub.Publish)
+	controllers.UseStream(hub, cfg.Stream.Heartbeat)
+	controllers.UseBulk(cfg.Bulk.MaxOperations)
+	controllers.UseGraphQL(cfg.GraphQL.MaxDepth, cfg.GraphQL.MaxComplexity)
+	var publishers outbox.Multi
+	if p := newPublisher(cfg.Outbox); p != nil {
+		publishers = append(publishers, p)
+	}
+	if cfg.Webhooks.Enabled {
+		publishers = append(publishers, webhooks.Fanout{})
+		dispatcher := &webhooks.Dispatcher{
+			Client:      webhooks.NewClient(cfg.Webhooks.Timeout),
+			Interval:    cfg.Webhooks.Interval,
+			BatchSize:   cfg.Webhooks.BatchSize,
+			MaxAttempts: cfg.Webhooks.MaxAttempts,
+			Backoff:     cfg.Webhooks.RetryBackoff,
+			MaxBackoff:  cfg.Webhooks.RetryMaxBackoff,
+			Retention:   cfg.Webhooks.Retention,
+		}
+		go dispatcher.Run(ctx)
+	}
+	if len(publishers) > 0 {
+		relay := &outbox.Relay{
+			Publisher:   publishers,
+			Interval:    cfg.Outbox.Interval,
+			BatchSize:   cfg.Outbox.BatchSize,
+			Lease:       cfg.Outbox.Lease,
+			MaxAttempts: cfg.Outbox.MaxAttempts,
+			Retention:   cfg.Outbox.Retention,
+		}
+		go relay.Run(ctx)
+	}
+
+	opts := routes.Options{
+		CacheControl: cfg.Server.CacheControl,
+		AdminToken:   cfg.Server.AdminToken,
+	}
+	if cfg.Idempotency.TTL > 0 {
+		// A claimed key is held no longer than a request can run.
+		opts.Idempotency = models.IdempotencyKeys{TTL: cfg.Idempotency.TTL, Lease: max(cfg.Server.WriteTimeout, time.Minute)}
+		go purgeIdempotencyKeys(ctx)
+	}
 	r := httprouter.New()
-	routes.RegisterRoutes(r)
-	if err := http.ListenAndServe(":8080", r); err != nil {
-		fmt.Println("Error starting server:", err)
+	routes.RegisterRoutes(r, opts)
+
+	srv := &http.Server{
+		Addr:              cfg.Server.Addr,
+		Handler:           r,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+	// Event streams never finish on their own.
+	srv.RegisterOnShutdown(hub.Close)
+
+	errc := make(chan error, 2)
+	go func() {
+		slog.Info("starting bookstore server", "addr", cfg.Server.Addr)
+		errc <- srv.ListenAndServe()
+	}()
+
+	var grpcSrv *grpc.Server
+	if cfg.GRPC.Addr != "" {
+		lis, err := net.Listen("tcp", cfg.GRPC.Addr)
+		if err != nil {
+			return fmt.Errorf("listening for gRPC: %w", err)
+		}
+		grpcSrv = newGRPCServer(cfg.GRPC)
+		go func() {
+			slog.Info("starting gRPC server", "addr", cfg.GRPC.Addr)
+			errc <- grpcSrv.Serve(lis)
+		}()
+	}
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down bookstore server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if grpcSrv != nil {
+		grpcStopped := make(chan struct{})
+		go func() {
+			stopGRPC(shutdownCtx, grpcSrv)
+			close(grpcStopped)
+		}()
+		defer func() { <-grpcStopped }()
+	}
+	return srv.Shutdown(shutdownCtx)
+}
+
+// newGRPCServer builds the server for the BookCatalog service, with the
+// request IDs, caller identities, spans and access logs HTTP requests get,
+// and panics recovered as net/http recovers them.
+func newGRPCServer(cfg config.GRPCConfig) *grpc.Server {
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(middleware.UnaryInterceptor, middleware.RecoverUnary),
+		grpc.ChainStreamInterceptor(middleware.StreamInterceptor, middleware.RecoverStream),
+	)
+	catalogpb.RegisterBookCatalogServer(srv, controllers.CatalogServer{})
+	if cfg.Reflection {
+		reflection.Register(srv)
+	}
+	return srv
+}
+
+// stopGRPC lets in-flight calls finish, cutting off any still running,
+// such as long listings, once ctx is done.
+func stopGRPC(ctx context.Context, srv *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		srv.Stop()
+		<-stopped
+	}
+}
+
+// purgeIdempotencyKeys deletes expired idempotency keys hourly until ctx
+// is done.
+func purgeIdempotencyKeys(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if n, err := models.PurgeIdempotencyKeys(ctx); err != nil {
+				slog.WarnContext(ctx, "purging idempotency keys failed", "error", err)
+			} else if n > 0 {
+				slog.InfoContext(ctx, "purged idempotency keys", "count", n)
+			}
+		}
+	}
+}
+
+// newEnricher builds the configured metadata source, or returns nil when
+// enrichment is off.
+func newEnricher(cfg config.EnrichConfig) enrich.Provider {
+	client := &http.Client{Timeout: cfg.Timeout}
+	var p enrich.Provider
+	switch cfg.Provider {
+	case "openlibrary":
+		p = &enrich.OpenLibrary{BaseURL: cfg.BaseURL, Client: client}
+	case "googlebooks":
+		p = &enrich.GoogleBooks{BaseURL: cfg.BaseURL, APIKey: cfg.APIKey, Client: client}
+	default:
+		return nil
+	}
+	if cfg.CacheSize > 0 {
+		p = &enrich.Cached{Provider: p, Cache: cache.NewLRU(cfg.CacheSize), TTL: cfg.CacheTTL, NotFoundTTL: cfg.CacheTTL}
+	}
+	return p
+}
+
+// newPublisher builds the configured event publisher, or returns nil when
+// events are left in the outbox.
+func newPublisher(cfg config.OutboxConfig) outbox.Publisher {
+	switch cfg.Publisher {
+	case "log":
+		return outbox.LogPublisher{}
+	case "http":
+		return &outbox.HTTPPublisher{URL: cfg.URL, Client: &http.Client{Timeout: 10 * time.Second}}
+	default:
+		return nil
 	}
-	fmt.Println("Welcome to the bookStore application!")
 }
@@ -0,0 +1,55 @@
+// Package bookio reads and writes books in the file formats used to move
+// catalogs in and out of the store.
+package bookio
+
+import (
+	"fmt"
+
+	"github.com/adedaryorh/bookstore-app/pkg/models"
+)
+
+// Reader decodes books one at a time, so files of any size can be processed
+// without holding them in memory.
+type Reader interface {
+	// Read returns the next book, or io.EOF once the input is exhausted.
+	// A *RowError means only that record was bad and reading may go on;
+	// any other error is fatal.
+	Read() (*models.Book, error)
+	// Line is where the record last returned by Read starts.
+	Line() int
+}
+
+// Deleter is implemented by readers of formats that can withdraw a book,
+// such as ONIX delete notifications.
+type Deleter interface {
+	// Deleted reports whether the book last returned by Read should be
+	// removed rather than saved.
+	Deleted() bool
+}
+
+// Writer encodes books one at a time.
+type Writer interface {
+	Write(*models.Book) error
+	// Close finishes the output. It does not close the underlying writer.
+	Close() error
+}
+
+// RowError describes a record that could not be decoded.
+type RowError struct {
+	// Line is the input line (or record number for binary formats) the
+	// record starts on.
+	Line int
+	Err  error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// Fields are the Book fields that can be imported and exported, named as in
+// the JSON API.
+var Fields = []string{"title", "author", "isbn", "publication_year", "genre", "price"}
@@ -0,0 +1,202 @@
+package bookio
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adedaryorh/bookstore-app/pkg/models"
+)
+
+// CSVReader reads books from CSV with a header row. Columns are matched to
+// fields by name, ignoring case and treating spaces and hyphens as
+// underscores, so "Publication Year" fills publication_year.
+type CSVReader struct {
+	r      *csv.Reader
+	fields []string // field for each column, "" when ignored
+	line   int
+
+	// Ignored lists the header columns that map to no field.
+	Ignored []string
+}
+
+// NewCSVReader reads the header row from r. mapping renames columns whose
+// header doesn't match a field name, e.g. {"Book Title": "title"}.
+func NewCSVReader(r io.Reader, mapping map[string]string) (*CSVReader, error) {
+	named := make(map[string]string, len(mapping))
+	for column, field := range mapping {
+		if !isField(field) {
+			return nil, fmt.Errorf("column %q is mapped to unknown field %q", column, field)
+		}
+		named[normalizeColumn(column)] = field
+	}
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, errors.New("missing header row")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading header row: %w", err)
+	}
+
+	c := &CSVReader{r: cr, fields: make([]string, len(header))}
+	seen := map[string]string{}
+	for i, column := range header {
+		if i == 0 {
+			column = strings.TrimPrefix(column, "\ufeff")
+		}
+		key := normalizeColumn(column)
+		field, ok := named[key]
+		if !ok && isField(key) {
+			field = key
+		}
+		if field == "" {
+			c.Ignored = append(c.Ignored, column)
+			continue
+		}
+		if prev, dup := seen[field]; dup {
+			return nil, fmt.Errorf("columns %q and %q both map to %s", prev, column, field)
+		}
+		seen[field] = column
+		c.fields[i] = field
+	}
+	for _, required := range []string{"title", "author", "isbn"} {
+		if _, ok := seen[required]; !ok {
+			return nil, fmt.Errorf("no column for required field %s", required)
+		}
+	}
+	return c, nil
+}
+
+func (c *CSVReader) Read() (*models.Book, error) {
+	record, err := c.r.Read()
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		c.line = parseErr.StartLine
+		return nil, &RowError{Line: c.line, Err: parseErr.Err}
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.line, _ = c.r.FieldPos(0)
+
+	if len(record) > len(c.fields) {
+		return nil, &RowError{Line: c.line, Err: fmt.Errorf("%d fields, header has %d", len(record), len(c.fields))}
+	}
+	var book models.Book
+	for i, value := range record {
+		value = strings.TrimSpace(value)
+		if c.fields[i] != "price" {
+			value = unescapeCSVText(value)
+		}
+		switch c.fields[i] {
+		case "title":
+			book.Title = value
+		case "author":
+			book.Author = value
+		case "isbn":
+			book.ISBN = value
+		case "publication_year":
+			book.PublicationYear = value
+		case "genre":
+			if value != "" {
+				book.Genre = &value
+			}
+		case "price":
+			if value == "" {
+				continue
+			}
+			price, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, &RowError{Line: c.line, Err: fmt.Errorf("price %q is not a number", value)}
+			}
+			book.Price = &price
+		}
+	}
+	return &book, nil
+}
+
+func (c *CSVReader) Line() int {
+	return c.line
+}
+
+func normalizeColumn(column string) string {
+	column = strings.ToLower(strings.TrimSpace(column))
+	return strings.NewReplacer(" ", "_", "-", "_").Replace(column)
+}
+
+func isField(name string) bool {
+	for _, f := range Fields {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// CSVWriter writes books as CSV with a header row. Besides Fields it has
+// id, created_at and updated_at columns, which an import ignores. Text
+// cells are escaped with CSVText, and CSVReader undoes it, so exports
+// re-import unchanged.
+type CSVWriter struct {
+	w *csv.Writer
+}
+
+// NewCSVWriter writes the header row to w.
+func NewCSVWriter(w io.Writer) (*CSVWriter, error) {
+	cw := csv.NewWriter(w)
+	header := append(append([]string{"id"}, Fields...), "created_at", "updated_at")
+	if err := cw.Write(header); err != nil {
+		return nil, err
+	}
+	return &CSVWriter{w: cw}, nil
+}
+
+func (c *CSVWriter) Write(b *models.Book) error {
+	var genre, price string
+	if b.Genre != nil {
+		genre = *b.Genre
+	}
+	if b.Price != nil {
+		price = strconv.FormatFloat(*b.Price, 'f', -1, 64)
+	}
+	return c.w.Write([]string{
+		strconv.FormatUint(uint64(b.ID), 10),
+		CSVText(b.Title), CSVText(b.Author), CSVText(b.ISBN), CSVText(b.PublicationYear), CSVText(genre), price,
+		b.CreatedAt.UTC().Format(time.RFC3339),
+		b.UpdatedAt.UTC().Format(time.RFC3339),
+	})
+}
+
+func (c *CSVWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// CSVText escapes a text cell that a spreadsheet would run as a formula,
+// one starting with =, +, -, @, a tab or a carriage return, by prefixing
+// it with a single quote.
+func CSVText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// unescapeCSVText removes the quote CSVText adds.
+func unescapeCSVText(s string) string {
+	if len(s) > 1 && s[0] == '\'' && CSVText(s[1:]) != s[1:] {
+		return s[1:]
+	}
+	return s
+}
@@ -0,0 +1,85 @@
+package bookio
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCSVReaderMapsHeaders(t *testing.T) {
+	in := "\ufeffBook Title,Author,ISBN,Publication Year,Genre,Price,Shelf\n" +
+		"Dune,Frank Herbert,9780441013593,1965,Science Fiction,9.99,A3\n" +
+		"\"Emma, Volume 1\",Jane Austen,9780141439587,,,\n"
+	r, err := NewCSVReader(strings.NewReader(in), map[string]string{"book title": "title"})
+	if err != nil {
+		t.Fatalf("NewCSVReader failed: %v", err)
+	}
+	if len(r.Ignored) != 1 || r.Ignored[0] != "Shelf" {
+		t.Errorf("got ignored columns %v want [Shelf]", r.Ignored)
+	}
+
+	book, err := r.Read()
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if book.Title != "Dune" || book.PublicationYear != "1965" || *book.Genre != "Science Fiction" || *book.Price != 9.99 {
+		t.Errorf("wrong book: %+v", book)
+	}
+	if r.Line() != 2 {
+		t.Errorf("got line %d want 2", r.Line())
+	}
+
+	book, err = r.Read()
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if book.Title != "Emma, Volume 1" || book.Genre != nil || book.Price != nil {
+		t.Errorf("wrong book: %+v", book)
+	}
+	if _, err := r.Read(); err != io.EOF {
+		t.Errorf("got %v want io.EOF", err)
+	}
+}
+
+func TestCSVReaderRowErrors(t *testing.T) {
+	in := "title,author,isbn,price\n" +
+		"A,B,1,cheap\n" +
+		"A,B,2,1,extra\n" +
+		"C,D,3,4.50\n"
+	r, err := NewCSVReader(strings.NewReader(in), nil)
+	if err != nil {
+		t.Fatalf("NewCSVReader failed: %v", err)
+	}
+
+	for _, line := range []int{2, 3} {
+		_, err := r.Read()
+		var rowErr *RowError
+		if !errors.As(err, &rowErr) || rowErr.Line != line {
+			t.Errorf("got %v want row error on line %d", err, line)
+		}
+	}
+	if book, err := r.Read(); err != nil || book.ISBN != "3" {
+		t.Errorf("reading should continue after bad rows: got %+v, %v", book, err)
+	}
+}
+
+func TestCSVReaderRejectsBadHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		mapping map[string]string
+	}{
+		{"empty", "", nil},
+		{"missing isbn", "title,author\n", nil},
+		{"duplicate field", "title,name,author,isbn\n", map[string]string{"name": "title"}},
+		{"unknown field", "title,author,isbn\n", map[string]string{"isbn": "ean"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewCSVReader(strings.NewReader(tt.in), tt.mapping); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
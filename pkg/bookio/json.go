@@ -0,0 +1,62 @@
+package bookio
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/adedaryorh/bookstore-app/pkg/models"
+)
+
+// NDJSONWriter writes one JSON book per line.
+type NDJSONWriter struct {
+	enc *json.Encoder
+}
+
+func NewNDJSONWriter(w io.Writer) *NDJSONWriter {
+	return &NDJSONWriter{enc: json.NewEncoder(w)}
+}
+
+func (n *NDJSONWriter) Write(b *models.Book) error {
+	return n.enc.Encode(b)
+}
+
+func (n *NDJSONWriter) Close() error {
+	return nil
+}
+
+// JSONWriter writes books as a single JSON array, matching the list
+// endpoint, without holding the array in memory.
+type JSONWriter struct {
+	w     io.Writer
+	count int
+}
+
+func NewJSONWriter(w io.Writer) *JSONWriter {
+	return &JSONWriter{w: w}
+}
+
+func (j *JSONWriter) Write(b *models.Book) error {
+	data, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	sep := ","
+	if j.count == 0 {
+		sep = "["
+	}
+	j.count++
+	if _, err := io.WriteString(j.w, sep); err != nil {
+		return err
+	}
+	_, err = j.w.Write(data)
+	return err
+}
+
+func (j *JSONWriter) Close() error {
+	end := "]\n"
+	if j.count == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(j.w, end)
+	return err
+}
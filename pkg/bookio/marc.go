@@ -0,0 +1,484 @@
+package bookio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/adedaryorh/bookstore-app/pkg/models"
+)
+
+// MARC 21 structural characters.
+const (
+	marcSubfieldDelimiter = 0x1f
+	marcFieldTerminator   = 0x1e
+	marcRecordTerminator  = 0x1d
+)
+
+// Limits set by the five-digit record length and four-digit field length
+// of the leader and directory.
+const (
+	marcMaxRecord = 99999
+	marcMaxField  = 9999
+)
+
+const marcXMLNamespace = "http://www.loc.gov/MARC21/slim"
+
+// marcRecord is a MARC 21 bibliographic record, the form shared by the
+// binary and MARCXML encodings.
+type marcRecord struct {
+	Leader        string             `xml:"leader"`
+	ControlFields []marcControlField `xml:"controlfield"`
+	DataFields    []marcDataField    `xml:"datafield"`
+}
+
+type marcControlField struct {
+	Tag   string `xml:"tag,attr"`
+	Value string `xml:",chardata"`
+}
+
+type marcDataField struct {
+	Tag       string         `xml:"tag,attr"`
+	Ind1      string         `xml:"ind1,attr"`
+	Ind2      string         `xml:"ind2,attr"`
+	Subfields []marcSubfield `xml:"subfield"`
+}
+
+type marcSubfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+func (f *marcDataField) subfield(code string) string {
+	for _, s := range f.Subfields {
+		if s.Code == code {
+			return s.Value
+		}
+	}
+	return ""
+}
+
+var (
+	yearPattern = regexp.MustCompile(`\d{4}`)
+	isbnPattern = regexp.MustCompile(`^[0-9Xx-]+`)
+)
+
+// book maps the record onto a Book: 020 $a is the ISBN, 245 $a and $b the
+// title, 100 and 700 $a the authors, 264 $c (or 260 $c, or 008) the
+// publication year and the first 650 $a the genre.
+func (r *marcRecord) book() *models.Book {
+	var b models.Book
+	for _, f := range r.DataFields {
+		switch f.Tag {
+		case "020":
+			if b.ISBN == "" {
+				b.ISBN = strings.ReplaceAll(isbnPattern.FindString(strings.TrimSpace(f.subfield("a"))), "-", "")
+			}
+		case "100", "700":
+			if name := marcName(&f); name != "" {
+				if b.Author != "" {
+					b.Author += authorSeparator
+				}
+				b.Author += name
+			}
+		case "245":
+			b.Title = trimISBD(f.subfield("a"))
+			if sub := trimISBD(f.subfield("b")); sub != "" {
+				b.Title += ": " + sub
+			}
+		case "650":
+			if b.Genre == nil {
+				if genre := trimISBD(f.subfield("a")); genre != "" {
+					b.Genre = &genre
+				}
+			}
+		}
+	}
+
+	for _, f := range r.DataFields {
+		if f.Tag == "264" && f.Ind2 == "1" || f.Tag == "260" {
+			if year := yearPattern.FindString(f.subfield("c")); year != "" {
+				b.PublicationYear = year
+				break
+			}
+		}
+	}
+	if b.PublicationYear == "" {
+		for _, c := range r.ControlFields {
+			if c.Tag == "008" && len(c.Value) >= 11 && yearPattern.MatchString(c.Value[7:11]) {
+				b.PublicationYear = c.Value[7:11]
+			}
+		}
+	}
+	return &b
+}
+
+// marcName returns a personal name in display order. Names entered surname
+// first (first indicator 1) are turned around: "Herbert, Frank," becomes
+// "Frank Herbert".
+func marcName(f *marcDataField) string {
+	name := trimISBD(f.subfield("a"))
+	if f.Ind1 == "1" {
+		if surname, forenames, ok := strings.Cut(name, ", "); ok {
+			name = forenames + " " + surname
+		}
+	}
+	return name
+}
+
+// trimISBD strips the punctuation cataloguers put between subfields, but
+// keeps the full stop of an initial such as "Le Guin, Ursula K.".
+func trimISBD(s string) string {
+	s = strings.TrimRight(strings.TrimSpace(s), " /:;,=")
+	if strings.HasSuffix(s, ".") {
+		if word := s[strings.LastIndex(s, " ")+1:]; len(word) > 2 {
+			s = strings.TrimSuffix(s, ".")
+		}
+	}
+	return s
+}
+
+// marcRecordFor builds the record a Book is exported as.
+func marcRecordFor(b *models.Book) *marcRecord {
+	r := &marcRecord{
+		// Record length and base address are filled in when encoding.
+		Leader: "00000nam a2200000 i 4500",
+	}
+	date1 := "    "
+	if yearPattern.MatchString(b.PublicationYear) && len(b.PublicationYear) == 4 {
+		date1 = b.PublicationYear
+	}
+	fixed := b.CreatedAt.UTC().Format("060102") + "s" + date1 + "    " + "xx " + strings.Repeat(" ", 17) + "und  "
+	r.ControlFields = []marcControlField{
+		{Tag: "001", Value: strconv.FormatUint(uint64(b.ID), 10)},
+		{Tag: "005", Value: b.UpdatedAt.UTC().Format("20060102150405") + ".0"},
+		{Tag: "008", Value: fixed},
+	}
+
+	if b.ISBN != "" {
+		r.DataFields = append(r.DataFields, marcDataField{Tag: "020", Ind1: " ", Ind2: " ",
+			Subfields: []marcSubfield{{Code: "a", Value: b.ISBN}}})
+	}
+	authors := splitAuthors(b.Author)
+	for i, name := range authors {
+		tag := "700"
+		if i == 0 {
+			tag = "100"
+		}
+		r.DataFields = append(r.DataFields, marcDataField{Tag: tag, Ind1: "0", Ind2: " ",
+			Subfields: []marcSubfield{{Code: "a", Value: name}}})
+	}
+	title := marcDataField{Tag: "245", Ind1: "0", Ind2: "0"}
+	if len(authors) > 0 {
+		title.Ind1 = "1"
+	}
+	if main, sub, ok := strings.Cut(b.Title, ": "); ok {
+		title.Subfields = []marcSubfield{{Code: "a", Value: main + " :"}, {Code: "b", Value: sub}}
+	} else {
+		title.Subfields = []marcSubfield{{Code: "a", Value: b.Title}}
+	}
+	r.DataFields = append(r.DataFields, title)
+	if b.PublicationYear != "" {
+		r.DataFields = append(r.DataFields, marcDataField{Tag: "264", Ind1: " ", Ind2: "1",
+			Subfields: []marcSubfield{{Code: "c", Value: b.PublicationYear}}})
+	}
+	if b.Genre != nil && *b.Genre != "" {
+		r.DataFields = append(r.DataFields, marcDataField{Tag: "650", Ind1: " ", Ind2: "4",
+			Subfields: []marcSubfield{{Code: "a", Value: *b.Genre}}})
+	}
+	return r
+}
+
+// MARCReader reads books from MARC 21 records in the binary transmission
+// format (ISO 2709). Character data is expected to be UTF-8 (leader/09
+// "a"); MARC-8 records are read as-is.
+type MARCReader struct {
+	r      *bufio.Reader
+	record int
+}
+
+// NewMARCReader reads records from r.
+func NewMARCReader(r io.Reader) *MARCReader {
+	return &MARCReader{r: bufio.NewReader(r)}
+}
+
+// Read reads exactly as many bytes as the record's leader says it has. A
+// record with an unreadable length is skipped up to the next record
+// terminator, which must come within the longest possible record.
+func (m *MARCReader) Read() (*models.Book, error) {
+	if err := m.skipSpace(); err != nil {
+		return nil, err
+	}
+	m.record++
+	head, err := m.r.Peek(5)
+	if err == io.EOF {
+		m.r.Discard(len(head))
+		return nil, &RowError{Line: m.record, Err: errors.New("truncated record")}
+	} else if err != nil {
+		return nil, err
+	}
+	length, ok := marcNumber(head)
+	if !ok || length < 25 {
+		if err := m.skipRecord(); err != nil {
+			return nil, err
+		}
+		return nil, &RowError{Line: m.record, Err: fmt.Errorf("invalid record length %q", head)}
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(m.r, data); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, &RowError{Line: m.record, Err: errors.New("truncated record")}
+	} else if err != nil {
+		return nil, err
+	}
+	rec, err := decodeMARC(data)
+	if err != nil {
+		return nil, &RowError{Line: m.record, Err: err}
+	}
+	return rec.book(), nil
+}
+
+// skipSpace skips line breaks and other white space between records,
+// returning io.EOF if nothing else is left.
+func (m *MARCReader) skipSpace() error {
+	for {
+		c, err := m.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+			return m.r.UnreadByte()
+		}
+	}
+}
+
+// skipRecord discards input up to and including the next record
+// terminator.
+func (m *MARCReader) skipRecord() error {
+	for n := 0; n < marcMaxRecord; n++ {
+		c, err := m.r.ReadByte()
+		if err == io.EOF || c == marcRecordTerminator {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("record %d: no record terminator within %d bytes", m.record, marcMaxRecord)
+}
+
+// marcNumber parses a fixed-width number of the leader or directory.
+func marcNumber(b []byte) (int, bool) {
+	n := 0
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		n = n*10 + int(c-'0')
+	}
+	return n, true
+}
+
+// Line returns the number of the record last read, counting from 1.
+func (m *MARCReader) Line() int {
+	return m.record
+}
+
+func decodeMARC(data []byte) (*marcRecord, error) {
+	data = bytes.TrimLeft(data, "\r\n")
+	if len(data) < 25 || data[len(data)-1] != marcRecordTerminator {
+		return nil, errors.New("truncated record")
+	}
+	leader := string(data[:24])
+	base, err := strconv.Atoi(leader[12:17])
+	if err != nil || base < 25 || base > len(data) {
+		return nil, fmt.Errorf("invalid base address %q", leader[12:17])
+	}
+	dir := data[24 : base-1]
+	if len(dir)%12 != 0 {
+		return nil, errors.New("invalid directory")
+	}
+
+	rec := &marcRecord{Leader: leader}
+	for i := 0; i < len(dir); i += 12 {
+		tag := string(dir[i : i+3])
+		length, err1 := strconv.Atoi(string(dir[i+3 : i+7]))
+		start, err2 := strconv.Atoi(string(dir[i+7 : i+12]))
+		if err1 != nil || err2 != nil || base+start+length > len(data) || length < 1 {
+			return nil, fmt.Errorf("invalid directory entry for field %s", tag)
+		}
+		field := data[base+start : base+start+length-1] // drop the field terminator
+		if strings.HasPrefix(tag, "00") {
+			rec.ControlFields = append(rec.ControlFields, marcControlField{Tag: tag, Value: string(field)})
+			continue
+		}
+		if len(field) < 2 {
+			return nil, fmt.Errorf("field %s has no indicators", tag)
+		}
+		df := marcDataField{Tag: tag, Ind1: string(field[0]), Ind2: string(field[1])}
+		for _, sub := range bytes.Split(field[2:], []byte{marcSubfieldDelimiter}) {
+			if len(sub) == 0 {
+				continue
+			}
+			df.Subfields = append(df.Subfields, marcSubfield{Code: string(sub[0]), Value: string(sub[1:])})
+		}
+		rec.DataFields = append(rec.DataFields, df)
+	}
+	return rec, nil
+}
+
+func encodeMARC(rec *marcRecord) ([]byte, error) {
+	var dir, fields bytes.Buffer
+	add := func(tag string, data []byte) error {
+		if len(data)+1 > marcMaxField {
+			return fmt.Errorf("field %s longer than %d bytes", tag, marcMaxField-1)
+		}
+		fmt.Fprintf(&dir, "%s%04d%05d", tag, len(data)+1, fields.Len())
+		fields.Write(data)
+		fields.WriteByte(marcFieldTerminator)
+		return nil
+	}
+	for _, c := range rec.ControlFields {
+		if err := add(c.Tag, []byte(c.Value)); err != nil {
+			return nil, err
+		}
+	}
+	for _, f := range rec.DataFields {
+		var data bytes.Buffer
+		data.WriteString(indicator(f.Ind1) + indicator(f.Ind2))
+		for _, s := range f.Subfields {
+			data.WriteByte(marcSubfieldDelimiter)
+			data.WriteString(s.Code)
+			data.WriteString(s.Value)
+		}
+		if err := add(f.Tag, data.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+	dir.WriteByte(marcFieldTerminator)
+
+	base := 24 + dir.Len()
+	length := base + fields.Len() + 1
+	if length > marcMaxRecord {
+		return nil, fmt.Errorf("record longer than %d bytes", marcMaxRecord)
+	}
+	leader := []byte(rec.Leader)
+	copy(leader[0:5], fmt.Sprintf("%05d", length))
+	copy(leader[12:17], fmt.Sprintf("%05d", base))
+
+	out := make([]byte, 0, length)
+	out = append(out, leader...)
+	out = append(out, dir.Bytes()...)
+	out = append(out, fields.Bytes()...)
+	return append(out, marcRecordTerminator), nil
+}
+
+func indicator(s string) string {
+	if s == "" {
+		return " "
+	}
+	return s[:1]
+}
+
+// MARCWriter writes books as binary MARC 21 records.
+type MARCWriter struct {
+	w io.Writer
+}
+
+// NewMARCWriter writes records to w.
+func NewMARCWriter(w io.Writer) *MARCWriter {
+	return &MARCWriter{w: w}
+}
+
+func (m *MARCWriter) Write(b *models.Book) error {
+	data, err := encodeMARC(marcRecordFor(b))
+	if err != nil {
+		return err
+	}
+	_, err = m.w.Write(data)
+	return err
+}
+
+func (m *MARCWriter) Close() error {
+	return nil
+}
+
+// MARCXMLReader reads books from the <record> elements of a MARCXML
+// document.
+type MARCXMLReader struct {
+	d    *xml.Decoder
+	line int
+}
+
+// NewMARCXMLReader reads records from r.
+func NewMARCXMLReader(r io.Reader) *MARCXMLReader {
+	return &MARCXMLReader{d: xml.NewDecoder(r)}
+}
+
+func (m *MARCXMLReader) Read() (*models.Book, error) {
+	for {
+		tok, err := m.d.Token()
+		if err != nil {
+			return nil, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "record" {
+			continue
+		}
+		m.line, _ = m.d.InputPos()
+		var rec marcRecord
+		if err := m.d.DecodeElement(&rec, &start); err != nil {
+			return nil, err
+		}
+		return rec.book(), nil
+	}
+}
+
+func (m *MARCXMLReader) Line() int {
+	return m.line
+}
+
+// MARCXMLWriter writes books as a MARCXML collection.
+type MARCXMLWriter struct {
+	w       io.Writer
+	enc     *xml.Encoder
+	started bool
+}
+
+// NewMARCXMLWriter writes the collection to w.
+func NewMARCXMLWriter(w io.Writer) *MARCXMLWriter {
+	return &MARCXMLWriter{w: w, enc: xml.NewEncoder(w)}
+}
+
+func (m *MARCXMLWriter) start() error {
+	m.started = true
+	_, err := fmt.Fprintf(m.w, "%s<collection xmlns=\"%s\">\n", xml.Header, marcXMLNamespace)
+	return err
+}
+
+func (m *MARCXMLWriter) Write(b *models.Book) error {
+	if !m.started {
+		if err := m.start(); err != nil {
+			return err
+		}
+	}
+	if err := m.enc.EncodeElement(marcRecordFor(b), xml.StartElement{Name: xml.Name{Local: "record"}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(m.w, "\n")
+	return err
+}
+
+func (m *MARCXMLWriter) Close() error {
+	if !m.started {
+		if err := m.start(); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(m.w, "</collection>\n")
+	return err
+}
@@ -0,0 +1,188 @@
+package bookio
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+const sampleMARCXML = `<?xml version="1.0" encoding="UTF-8"?>
+<collection xmlns="http://www.loc.gov/MARC21/slim">
+  <record>
+    <leader>01142cam  2200301 i 4500</leader>
+    <controlfield tag="001">ocm123</controlfield>
+    <controlfield tag="008">690301s1969    nyu           000 1 eng d</controlfield>
+    <datafield tag="020" ind1=" " ind2=" ">
+      <subfield code="a">978-0-441-47812-5 (paperback)</subfield>
+      <subfield code="c">$9.99</subfield>
+    </datafield>
+    <datafield tag="100" ind1="1" ind2=" ">
+      <subfield code="a">Le Guin, Ursula K.,</subfield>
+      <subfield code="e">author.</subfield>
+    </datafield>
+    <datafield tag="245" ind1="1" ind2="4">
+      <subfield code="a">The left hand of darkness /</subfield>
+      <subfield code="c">Ursula K. Le Guin.</subfield>
+    </datafield>
+    <datafield tag="264" ind1=" " ind2="4">
+      <subfield code="c">©1968</subfield>
+    </datafield>
+    <datafield tag="264" ind1=" " ind2="1">
+      <subfield code="a">New York :</subfield>
+      <subfield code="b">Ace Books,</subfield>
+      <subfield code="c">1969.</subfield>
+    </datafield>
+    <datafield tag="650" ind1=" " ind2="0">
+      <subfield code="a">Science fiction.</subfield>
+    </datafield>
+    <datafield tag="650" ind1=" " ind2="0">
+      <subfield code="a">Gender identity</subfield>
+    </datafield>
+    <datafield tag="700" ind1="1" ind2=" ">
+      <subfield code="a">Miéville, China,</subfield>
+      <subfield code="e">writer of introduction.</subfield>
+    </datafield>
+  </record>
+</collection>`
+
+func TestMARCXMLReader(t *testing.T) {
+	r := NewMARCXMLReader(strings.NewReader(sampleMARCXML))
+	book, err := r.Read()
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	checks := []struct {
+		name      string
+		got, want string
+	}{
+		{"isbn", book.ISBN, "9780441478125"},
+		{"title", book.Title, "The left hand of darkness"},
+		{"author", book.Author, "Ursula K. Le Guin; China Miéville"},
+		{"year", book.PublicationYear, "1969"},
+		{"genre", *book.Genre, "Science fiction"},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("%s: got %q want %q", c.name, c.got, c.want)
+		}
+	}
+	if r.Line() != 3 {
+		t.Errorf("got line %d want 3", r.Line())
+	}
+	if _, err := r.Read(); err != io.EOF {
+		t.Errorf("got %v want io.EOF", err)
+	}
+}
+
+func TestMARCRoundTrip(t *testing.T) {
+	books := testBooks()
+	books[0].Title = "Dune: Deluxe Edition"
+	books[0].Author = "Frank Herbert; Brian Herbert"
+
+	var bin, xmlOut bytes.Buffer
+	bw, xw := NewMARCWriter(&bin), NewMARCXMLWriter(&xmlOut)
+	for _, b := range books {
+		if err := bw.Write(b); err != nil {
+			t.Fatal(err)
+		}
+		if err := xw.Write(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bw.Close()
+	xw.Close()
+
+	// Record length and base address in the leader must describe the
+	// record the way other MARC tools expect.
+	first := bin.Bytes()[:bytes.IndexByte(bin.Bytes(), marcRecordTerminator)+1]
+	if got, want := string(first[:5]), fmt.Sprintf("%05d", len(first)); got != want {
+		t.Errorf("got record length %s want %s", got, want)
+	}
+
+	for name, r := range map[string]Reader{"binary": NewMARCReader(&bin), "xml": NewMARCXMLReader(&xmlOut)} {
+		for i, want := range books {
+			got, err := r.Read()
+			if err != nil {
+				t.Fatalf("%s: Read failed: %v", name, err)
+			}
+			if got.Title != want.Title || got.Author != want.Author || got.ISBN != want.ISBN ||
+				got.PublicationYear != want.PublicationYear {
+				t.Errorf("%s book %d: got %+v want %+v", name, i, got, want)
+			}
+			if (got.Genre == nil) != (want.Genre == nil) || got.Genre != nil && *got.Genre != *want.Genre {
+				t.Errorf("%s book %d: genre not kept", name, i)
+			}
+		}
+		if _, err := r.Read(); err != io.EOF {
+			t.Errorf("%s: got %v want io.EOF", name, err)
+		}
+	}
+}
+
+func TestMARCReaderSkipsBadRecords(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewMARCWriter(&buf)
+	w.Write(testBooks()[0])
+	buf.WriteString("00010nam\x1d") // too short to be a record
+	w.Write(testBooks()[1])
+
+	r := NewMARCReader(&buf)
+	if _, err := r.Read(); err != nil {
+		t.Fatalf("first record: %v", err)
+	}
+	_, err := r.Read()
+	var rowErr *RowError
+	if !errors.As(err, &rowErr) || rowErr.Line != 2 {
+		t.Errorf("got %v want row error for record 2", err)
+	}
+	if book, err := r.Read(); err != nil || book.ISBN != testBooks()[1].ISBN {
+		t.Errorf("reading should continue after a bad record: got %+v, %v", book, err)
+	}
+}
+
+func TestMARCReaderLimitsRecordLength(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewMARCWriter(&buf)
+	w.Write(testBooks()[0])
+	buf.WriteString("\n")
+	w.Write(testBooks()[1])
+	good := buf.String()
+
+	// A record is read to the length in its leader, not to a terminator.
+	r := NewMARCReader(strings.NewReader(good))
+	for _, want := range testBooks()[:2] {
+		if book, err := r.Read(); err != nil || book.ISBN != want.ISBN {
+			t.Fatalf("got %+v, %v want %s", book, err, want.ISBN)
+		}
+	}
+	if _, err := r.Read(); err != io.EOF {
+		t.Errorf("got %v want io.EOF", err)
+	}
+
+	// A leader claiming more than is left is a truncated record.
+	r = NewMARCReader(strings.NewReader("99999nam" + good))
+	var rowErr *RowError
+	if _, err := r.Read(); !errors.As(err, &rowErr) {
+		t.Errorf("got %v want row error", err)
+	}
+	if _, err := r.Read(); err != io.EOF {
+		t.Errorf("got %v want io.EOF", err)
+	}
+
+	// Input with no usable length and no terminator is not buffered whole.
+	r = NewMARCReader(strings.NewReader("x" + strings.Repeat("a", 200000)))
+	if _, err := r.Read(); err == nil || errors.As(err, &rowErr) {
+		t.Errorf("got %v want an error ending the read", err)
+	}
+}
+
+func TestMARCWriterRejectsLongFields(t *testing.T) {
+	b := testBooks()[0]
+	b.Title = strings.Repeat("é", 5000)
+	if err := NewMARCWriter(io.Discard).Write(b); err == nil {
+		t.Error("a field over 9998 bytes should not be written")
+	}
+}
@@ -0,0 +1,425 @@
+package bookio
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adedaryorh/bookstore-app/pkg/models"
+)
+
+// DefaultCurrency is the currency of Book.Price when a format carries prices
+// in several currencies and the caller doesn't pick one.
+const DefaultCurrency = "USD"
+
+// authorSeparator joins several contributors into Book.Author.
+const authorSeparator = "; "
+
+const onixNamespace = "http://ns.editeur.org/onix/3.0/reference"
+
+// ONIX code list values used in the mapping.
+const (
+	onixNotifyUpdate  = "03" // Notification or update
+	onixNotifyDelete  = "05" // Delete
+	onixIDISBN13      = "15" // ProductIDType: ISBN-13
+	onixIDISBN10      = "02" // ProductIDType: ISBN-10
+	onixTitleDistinct = "01" // TitleType: distinctive title
+	onixTitleProduct  = "01" // TitleElementLevel: product
+	onixRoleAuthor    = "A01"
+	onixDatePublished = "01" // PublishingDateRole: publication date
+	onixDateYear      = "05" // dateformat: YYYY
+	onixSchemeKeyword = "20" // SubjectSchemeIdentifier: keywords
+	onixPriceRRP      = "01" // PriceType: RRP excluding tax
+	onixAvailable     = "20" // ProductAvailability: available
+)
+
+// onixProduct is the part of an ONIX 3.0 <Product> the catalog uses, in
+// reference tag form and schema order so it can be written back out.
+type onixProduct struct {
+	XMLName            xml.Name                `xml:"Product"`
+	RecordReference    string                  `xml:"RecordReference"`
+	NotificationType   string                  `xml:"NotificationType"`
+	ProductIdentifiers []onixProductIdentifier `xml:"ProductIdentifier"`
+	DescriptiveDetail  onixDescriptiveDetail   `xml:"DescriptiveDetail"`
+	PublishingDetail   *onixPublishingDetail   `xml:"PublishingDetail,omitempty"`
+	ProductSupply      []onixProductSupply     `xml:"ProductSupply,omitempty"`
+}
+
+type onixProductIdentifier struct {
+	ProductIDType string `xml:"ProductIDType"`
+	IDValue       string `xml:"IDValue"`
+}
+
+type onixDescriptiveDetail struct {
+	ProductComposition string            `xml:"ProductComposition,omitempty"`
+	ProductForm        string            `xml:"ProductForm,omitempty"`
+	TitleDetails       []onixTitleDetail `xml:"TitleDetail"`
+	Contributors       []onixContributor `xml:"Contributor,omitempty"`
+	Subjects           []onixSubject     `xml:"Subject,omitempty"`
+}
+
+type onixTitleDetail struct {
+	TitleType     string             `xml:"TitleType"`
+	TitleElements []onixTitleElement `xml:"TitleElement"`
+}
+
+type onixTitleElement struct {
+	TitleElementLevel  string `xml:"TitleElementLevel"`
+	TitleText          string `xml:"TitleText,omitempty"`
+	TitlePrefix        string `xml:"TitlePrefix,omitempty"`
+	TitleWithoutPrefix string `xml:"TitleWithoutPrefix,omitempty"`
+	Subtitle           string `xml:"Subtitle,omitempty"`
+}
+
+type onixContributor struct {
+	SequenceNumber  int    `xml:"SequenceNumber,omitempty"`
+	ContributorRole string `xml:"ContributorRole"`
+	PersonName      string `xml:"PersonName,omitempty"`
+	NamesBeforeKey  string `xml:"NamesBeforeKey,omitempty"`
+	KeyNames        string `xml:"KeyNames,omitempty"`
+	CorporateName   string `xml:"CorporateName,omitempty"`
+}
+
+type onixSubject struct {
+	MainSubject             *struct{} `xml:"MainSubject"`
+	SubjectSchemeIdentifier string    `xml:"SubjectSchemeIdentifier"`
+	SubjectCode             string    `xml:"SubjectCode,omitempty"`
+	SubjectHeadingText      string    `xml:"SubjectHeadingText,omitempty"`
+}
+
+type onixPublishingDetail struct {
+	PublishingDates []onixPublishingDate `xml:"PublishingDate"`
+}
+
+type onixPublishingDate struct {
+	PublishingDateRole string   `xml:"PublishingDateRole"`
+	Date               onixDate `xml:"Date"`
+}
+
+type onixDate struct {
+	Format string `xml:"dateformat,attr,omitempty"`
+	Value  string `xml:",chardata"`
+}
+
+type onixProductSupply struct {
+	SupplyDetails []onixSupplyDetail `xml:"SupplyDetail"`
+}
+
+type onixSupplyDetail struct {
+	Supplier            *onixSupplier `xml:"Supplier,omitempty"`
+	ProductAvailability string        `xml:"ProductAvailability,omitempty"`
+	Prices              []onixPrice   `xml:"Price"`
+}
+
+type onixSupplier struct {
+	SupplierRole string `xml:"SupplierRole"`
+	SupplierName string `xml:"SupplierName"`
+}
+
+type onixPrice struct {
+	PriceType    string `xml:"PriceType,omitempty"`
+	PriceAmount  string `xml:"PriceAmount"`
+	CurrencyCode string `xml:"CurrencyCode,omitempty"`
+}
+
+// ONIXReader reads books from the <Product> records of an ONIX 3.0 message
+// in reference tag form. Products with NotificationType 05 are reported as
+// deletions.
+type ONIXReader struct {
+	d        *xml.Decoder
+	currency string
+	started  bool
+	line     int
+	deleted  bool
+
+	// SentAt is the message's SentDateTime, known once the first product
+	// has been read.
+	SentAt time.Time
+}
+
+// NewONIXReader reads products from r, taking Book.Price from the price in
+// currency.
+func NewONIXReader(r io.Reader, currency string) *ONIXReader {
+	return &ONIXReader{d: xml.NewDecoder(r), currency: currency}
+}
+
+func (o *ONIXReader) Read() (*models.Book, error) {
+	for {
+		tok, err := o.d.Token()
+		if err == io.EOF {
+			if !o.started {
+				return nil, errors.New("empty document")
+			}
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		if !o.started {
+			switch start.Name.Local {
+			case "ONIXMessage":
+				o.started = true
+				continue
+			case "ONIXmessage":
+				return nil, errors.New("short tag ONIX is not supported, send reference tags")
+			default:
+				return nil, fmt.Errorf("root element is <%s>, want <ONIXMessage>", start.Name.Local)
+			}
+		}
+
+		switch start.Name.Local {
+		case "Header":
+			var header struct {
+				SentDateTime string `xml:"SentDateTime"`
+			}
+			if err := o.d.DecodeElement(&header, &start); err != nil {
+				return nil, err
+			}
+			o.SentAt, _ = parseONIXDateTime(header.SentDateTime)
+		case "Product":
+			line, _ := o.d.InputPos()
+			var p onixProduct
+			if err := o.d.DecodeElement(&p, &start); err != nil {
+				return nil, err
+			}
+			o.line = line
+			o.deleted = p.NotificationType == onixNotifyDelete
+			return p.book(o.currency), nil
+		default:
+			o.d.Skip()
+		}
+	}
+}
+
+func (o *ONIXReader) Line() int {
+	return o.line
+}
+
+func (o *ONIXReader) Deleted() bool {
+	return o.deleted
+}
+
+func (p *onixProduct) book(currency string) *models.Book {
+	var b models.Book
+	for _, id := range p.ProductIdentifiers {
+		if id.ProductIDType == onixIDISBN13 || (id.ProductIDType == onixIDISBN10 && b.ISBN == "") {
+			b.ISBN = strings.TrimSpace(id.IDValue)
+		}
+	}
+
+	d := p.DescriptiveDetail
+	if title := pickTitle(d.TitleDetails); title != nil {
+		b.Title = title.TitleText
+		if b.Title == "" {
+			b.Title = strings.TrimSpace(title.TitlePrefix + " " + title.TitleWithoutPrefix)
+		}
+		if title.Subtitle != "" {
+			b.Title += ": " + title.Subtitle
+		}
+	}
+
+	var authors, others []string
+	for _, c := range d.Contributors {
+		name := c.name()
+		if name == "" {
+			continue
+		}
+		if c.ContributorRole == onixRoleAuthor {
+			authors = append(authors, name)
+		} else {
+			others = append(others, name)
+		}
+	}
+	if len(authors) == 0 {
+		authors = others
+	}
+	b.Author = strings.Join(authors, authorSeparator)
+
+	for i, s := range d.Subjects {
+		if i > 0 && s.MainSubject == nil {
+			continue
+		}
+		genre := s.SubjectHeadingText
+		if genre == "" {
+			genre = s.SubjectCode
+		}
+		if genre != "" {
+			b.Genre = &genre
+		}
+		if s.MainSubject != nil {
+			break
+		}
+	}
+
+	if p.PublishingDetail != nil {
+		for _, date := range p.PublishingDetail.PublishingDates {
+			if date.PublishingDateRole == onixDatePublished && len(date.Date.Value) >= 4 {
+				b.PublicationYear = date.Date.Value[:4]
+			}
+		}
+	}
+
+	for _, supply := range p.ProductSupply {
+		for _, detail := range supply.SupplyDetails {
+			for _, price := range detail.Prices {
+				if b.Price != nil || !strings.EqualFold(price.CurrencyCode, currency) {
+					continue
+				}
+				if amount, err := strconv.ParseFloat(price.PriceAmount, 64); err == nil {
+					b.Price = &amount
+				}
+			}
+		}
+	}
+	return &b
+}
+
+func pickTitle(details []onixTitleDetail) *onixTitleElement {
+	var found *onixTitleElement
+	for i := range details {
+		for j := range details[i].TitleElements {
+			el := &details[i].TitleElements[j]
+			if found == nil {
+				found = el
+			}
+			if details[i].TitleType == onixTitleDistinct && el.TitleElementLevel == onixTitleProduct {
+				return el
+			}
+		}
+	}
+	return found
+}
+
+func (c onixContributor) name() string {
+	switch {
+	case c.PersonName != "":
+		return c.PersonName
+	case c.KeyNames != "":
+		return strings.TrimSpace(c.NamesBeforeKey + " " + c.KeyNames)
+	}
+	return c.CorporateName
+}
+
+// parseONIXDateTime parses the SentDateTime forms ONIX allows.
+func parseONIXDateTime(s string) (time.Time, error) {
+	for _, layout := range []string{"20060102T1504-0700", "20060102T150405-0700", "20060102T1504Z", "20060102T150405Z", "20060102T1504", "20060102T150405", "20060102"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid SentDateTime %q", s)
+}
+
+// ONIXWriter writes books as an ONIX 3.0 message in reference tag form.
+type ONIXWriter struct {
+	w        io.Writer
+	enc      *xml.Encoder
+	sender   string
+	currency string
+	started  bool
+}
+
+// NewONIXWriter writes books sent by sender, with prices in currency.
+func NewONIXWriter(w io.Writer, sender, currency string) *ONIXWriter {
+	return &ONIXWriter{w: w, enc: xml.NewEncoder(w), sender: sender, currency: currency}
+}
+
+func (o *ONIXWriter) start() error {
+	o.started = true
+	var name strings.Builder
+	xml.EscapeText(&name, []byte(o.sender))
+	_, err := fmt.Fprintf(o.w, "%s<ONIXMessage release=\"3.0\" xmlns=\"%s\">\n"+
+		"<Header><Sender><SenderName>%s</SenderName></Sender><SentDateTime>%s</SentDateTime></Header>\n",
+		xml.Header, onixNamespace, name.String(), time.Now().UTC().Format("20060102T1504Z"))
+	return err
+}
+
+func (o *ONIXWriter) Write(b *models.Book) error {
+	if !o.started {
+		if err := o.start(); err != nil {
+			return err
+		}
+	}
+	p := onixProduct{
+		RecordReference:  fmt.Sprintf("%s.book.%d", o.sender, b.ID),
+		NotificationType: onixNotifyUpdate,
+		DescriptiveDetail: onixDescriptiveDetail{
+			ProductComposition: "00", // single-item retail product
+			ProductForm:        "00", // undefined
+			TitleDetails: []onixTitleDetail{{
+				TitleType:     onixTitleDistinct,
+				TitleElements: []onixTitleElement{{TitleElementLevel: onixTitleProduct, TitleText: b.Title}},
+			}},
+		},
+	}
+	if b.ISBN != "" {
+		idType := onixIDISBN13
+		if len(b.ISBN) == 10 {
+			idType = onixIDISBN10
+		}
+		p.ProductIdentifiers = append(p.ProductIdentifiers, onixProductIdentifier{ProductIDType: idType, IDValue: b.ISBN})
+	}
+	for i, name := range splitAuthors(b.Author) {
+		p.DescriptiveDetail.Contributors = append(p.DescriptiveDetail.Contributors,
+			onixContributor{SequenceNumber: i + 1, ContributorRole: onixRoleAuthor, PersonName: name})
+	}
+	if b.Genre != nil && *b.Genre != "" {
+		p.DescriptiveDetail.Subjects = []onixSubject{{
+			MainSubject:             &struct{}{},
+			SubjectSchemeIdentifier: onixSchemeKeyword,
+			SubjectHeadingText:      *b.Genre,
+		}}
+	}
+	if b.PublicationYear != "" {
+		p.PublishingDetail = &onixPublishingDetail{PublishingDates: []onixPublishingDate{{
+			PublishingDateRole: onixDatePublished,
+			Date:               onixDate{Format: onixDateYear, Value: b.PublicationYear},
+		}}}
+	}
+	if b.Price != nil {
+		p.ProductSupply = []onixProductSupply{{SupplyDetails: []onixSupplyDetail{{
+			Supplier:            &onixSupplier{SupplierRole: "01", SupplierName: o.sender},
+			ProductAvailability: onixAvailable,
+			Prices: []onixPrice{{
+				PriceType:    onixPriceRRP,
+				PriceAmount:  strconv.FormatFloat(*b.Price, 'f', 2, 64),
+				CurrencyCode: o.currency,
+			}},
+		}}}}
+	}
+	if err := o.enc.Encode(p); err != nil {
+		return err
+	}
+	_, err := io.WriteString(o.w, "\n")
+	return err
+}
+
+func (o *ONIXWriter) Close() error {
+	if !o.started {
+		if err := o.start(); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(o.w, "</ONIXMessage>\n")
+	return err
+}
+
+// splitAuthors undoes the joining of several contributors into Book.Author.
+func splitAuthors(author string) []string {
+	var names []string
+	for _, name := range strings.Split(author, strings.TrimSpace(authorSeparator)) {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
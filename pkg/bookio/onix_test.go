@@ -0,0 +1,174 @@
+package bookio
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+const sampleONIX = `<?xml version="1.0" encoding="UTF-8"?>
+<ONIXMessage release="3.0" xmlns="http://ns.editeur.org/onix/3.0/reference">
+  <Header>
+    <Sender><SenderName>Example Press</SenderName></Sender>
+    <SentDateTime>20240301T0900Z</SentDateTime>
+  </Header>
+  <Product>
+    <RecordReference>com.example.9780441013593</RecordReference>
+    <NotificationType>03</NotificationType>
+    <ProductIdentifier><ProductIDType>01</ProductIDType><IDValue>EX-1</IDValue></ProductIdentifier>
+    <ProductIdentifier><ProductIDType>15</ProductIDType><IDValue>9780441013593</IDValue></ProductIdentifier>
+    <DescriptiveDetail>
+      <ProductComposition>00</ProductComposition>
+      <ProductForm>BC</ProductForm>
+      <TitleDetail>
+        <TitleType>01</TitleType>
+        <TitleElement>
+          <TitleElementLevel>01</TitleElementLevel>
+          <TitlePrefix>The</TitlePrefix>
+          <TitleWithoutPrefix>Left Hand of Darkness</TitleWithoutPrefix>
+          <Subtitle>A Novel</Subtitle>
+        </TitleElement>
+      </TitleDetail>
+      <Contributor>
+        <SequenceNumber>1</SequenceNumber>
+        <ContributorRole>B01</ContributorRole>
+        <PersonName>Some Editor</PersonName>
+      </Contributor>
+      <Contributor>
+        <SequenceNumber>2</SequenceNumber>
+        <ContributorRole>A01</ContributorRole>
+        <NamesBeforeKey>Ursula K.</NamesBeforeKey>
+        <KeyNames>Le Guin</KeyNames>
+      </Contributor>
+      <Subject>
+        <SubjectSchemeIdentifier>20</SubjectSchemeIdentifier>
+        <SubjectHeadingText>gender; anthropology</SubjectHeadingText>
+      </Subject>
+      <Subject>
+        <MainSubject/>
+        <SubjectSchemeIdentifier>10</SubjectSchemeIdentifier>
+        <SubjectCode>FIC028000</SubjectCode>
+        <SubjectHeadingText>Science Fiction</SubjectHeadingText>
+      </Subject>
+    </DescriptiveDetail>
+    <PublishingDetail>
+      <PublishingDate>
+        <PublishingDateRole>01</PublishingDateRole>
+        <Date dateformat="00">19690301</Date>
+      </PublishingDate>
+    </PublishingDetail>
+    <ProductSupply>
+      <SupplyDetail>
+        <ProductAvailability>20</ProductAvailability>
+        <Price><PriceType>01</PriceType><PriceAmount>12.00</PriceAmount><CurrencyCode>GBP</CurrencyCode></Price>
+        <Price><PriceType>01</PriceType><PriceAmount>15.99</PriceAmount><CurrencyCode>USD</CurrencyCode></Price>
+      </SupplyDetail>
+    </ProductSupply>
+  </Product>
+  <Product>
+    <RecordReference>com.example.9780000000002</RecordReference>
+    <NotificationType>05</NotificationType>
+    <ProductIdentifier><ProductIDType>15</ProductIDType><IDValue>9780000000002</IDValue></ProductIdentifier>
+    <DescriptiveDetail/>
+  </Product>
+</ONIXMessage>
+`
+
+func TestONIXReader(t *testing.T) {
+	r := NewONIXReader(strings.NewReader(sampleONIX), "USD")
+
+	book, err := r.Read()
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	checks := []struct {
+		name      string
+		got, want interface{}
+	}{
+		{"isbn", book.ISBN, "9780441013593"},
+		{"title", book.Title, "The Left Hand of Darkness: A Novel"},
+		{"author", book.Author, "Ursula K. Le Guin"},
+		{"year", book.PublicationYear, "1969"},
+		{"genre", *book.Genre, "Science Fiction"},
+		{"price", *book.Price, 15.99},
+		{"deleted", r.Deleted(), false},
+		{"sent", r.SentAt, time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)},
+		{"line", r.Line(), 7},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("%s: got %v want %v", c.name, c.got, c.want)
+		}
+	}
+
+	book, err = r.Read()
+	if err != nil || book.ISBN != "9780000000002" || !r.Deleted() {
+		t.Errorf("expected delete notification, got %+v, %v, deleted=%v", book, err, r.Deleted())
+	}
+	if _, err := r.Read(); err != io.EOF {
+		t.Errorf("got %v want io.EOF", err)
+	}
+}
+
+func TestONIXReaderCurrency(t *testing.T) {
+	book, err := NewONIXReader(strings.NewReader(sampleONIX), "EUR").Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if book.Price != nil {
+		t.Errorf("no EUR price, got %v", *book.Price)
+	}
+}
+
+func TestONIXReaderRejectsOtherDocuments(t *testing.T) {
+	for _, doc := range []string{
+		"",
+		`<ONIXmessage release="3.0"><header/></ONIXmessage>`,
+		`<catalog><book/></catalog>`,
+		`<ONIXMessage><Product><RecordReference>x</Product></ONIXMessage>`,
+	} {
+		if _, err := NewONIXReader(strings.NewReader(doc), "USD").Read(); err == nil || err == io.EOF {
+			t.Errorf("expected an error for %q, got %v", doc, err)
+		}
+	}
+}
+
+func TestONIXRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewONIXWriter(&buf, "Corner Books", "USD")
+	for _, b := range testBooks() {
+		b.Author = "Frank Herbert; Brian Herbert"
+		if err := w.Write(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "<SenderName>Corner Books</SenderName>") {
+		t.Errorf("sender missing from header:\n%s", buf.String())
+	}
+
+	r := NewONIXReader(&buf, "USD")
+	want := testBooks()
+	for i := range want {
+		got, err := r.Read()
+		if err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+		if got.Title != want[i].Title || got.ISBN != want[i].ISBN || got.PublicationYear != want[i].PublicationYear {
+			t.Errorf("book %d: got %+v want %+v", i, got, want[i])
+		}
+		if got.Author != "Frank Herbert; Brian Herbert" {
+			t.Errorf("book %d: got author %q", i, got.Author)
+		}
+		if (got.Price == nil) != (want[i].Price == nil) || (got.Genre == nil) != (want[i].Genre == nil) {
+			t.Errorf("book %d: price or genre lost: %+v", i, got)
+		}
+	}
+	if _, err := r.Read(); err != io.EOF {
+		t.Errorf("got %v want io.EOF", err)
+	}
+}
@@ -0,0 +1,171 @@
+package bookio
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adedaryorh/bookstore-app/pkg/models"
+)
+
+func testBooks() []*models.Book {
+	genre, price := "Science Fiction", 9.5
+	at := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	return []*models.Book{
+		{ID: 1, Title: "Dune", Author: "Frank Herbert", ISBN: "9780441013593", PublicationYear: "1965",
+			Genre: &genre, Price: &price, CreatedAt: at, UpdatedAt: at},
+		{ID: 2, Title: "Emma, Volume 1", Author: "Jane Austen", ISBN: "9780141439587", CreatedAt: at, UpdatedAt: at},
+	}
+}
+
+func TestCSVWriterRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewCSVWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range testBooks() {
+		if err := w.Write(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "id,title,author,isbn,publication_year,genre,price,created_at,updated_at\n" +
+		"1,Dune,Frank Herbert,9780441013593,1965,Science Fiction,9.5,2024-05-01T10:00:00Z,2024-05-01T10:00:00Z\n" +
+		"2,\"Emma, Volume 1\",Jane Austen,9780141439587,,,,2024-05-01T10:00:00Z,2024-05-01T10:00:00Z\n"
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	// An export can be imported again.
+	r, err := NewCSVReader(&buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	book, err := r.Read()
+	if err != nil || book.Title != "Dune" || *book.Price != 9.5 {
+		t.Errorf("got %+v, %v", book, err)
+	}
+}
+
+func TestCSVWriterEscapesFormulas(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewCSVWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := testBooks()[1]
+	b.Title, b.Author = `=HYPERLINK("http://example.com","Emma")`, "@Austen"
+	w.Write(b)
+	w.Close()
+
+	if !strings.Contains(buf.String(), `"'=HYPERLINK(""http://example.com"",""Emma"")",'@Austen,`) {
+		t.Errorf("formulas not escaped: %s", buf.String())
+	}
+	r, err := NewCSVReader(&buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if book, err := r.Read(); err != nil || book.Title != b.Title || book.Author != b.Author {
+		t.Errorf("escaping should be undone on import: got %+v, %v", book, err)
+	}
+}
+
+func TestJSONWriters(t *testing.T) {
+	var arr, nd bytes.Buffer
+	jw, nw := NewJSONWriter(&arr), NewNDJSONWriter(&nd)
+	for _, b := range testBooks() {
+		jw.Write(b)
+		nw.Write(b)
+	}
+	jw.Close()
+	nw.Close()
+
+	var books []models.Book
+	if err := json.Unmarshal(arr.Bytes(), &books); err != nil || len(books) != 2 {
+		t.Errorf("JSON array invalid: %v, %d books", err, len(books))
+	}
+	lines := strings.Split(strings.TrimSpace(nd.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d NDJSON lines want 2", len(lines))
+	}
+	var book models.Book
+	if err := json.Unmarshal([]byte(lines[1]), &book); err != nil || book.Author != "Jane Austen" {
+		t.Errorf("got %+v, %v", book, err)
+	}
+
+	var empty bytes.Buffer
+	NewJSONWriter(&empty).Close()
+	if empty.String() != "[]\n" {
+		t.Errorf("got %q want []", empty.String())
+	}
+}
+
+func TestXLSXWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewXLSXWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range testBooks() {
+		if err := w.Write(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		parts[f.Name] = string(b)
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/worksheets/sheet1.xml"} {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("workbook has no %s", name)
+		}
+	}
+
+	var sheet struct {
+		Rows []struct {
+			Cells []struct {
+				Ref    string `xml:"r,attr"`
+				Type   string `xml:"t,attr"`
+				Text   string `xml:"is>t"`
+				Number string `xml:"v"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := xml.Unmarshal([]byte(parts["xl/worksheets/sheet1.xml"]), &sheet); err != nil {
+		t.Fatal(err)
+	}
+	if len(sheet.Rows) != 3 || len(sheet.Rows[0].Cells) != 9 {
+		t.Fatalf("want a header and 2 rows of 9 columns: got %+v", sheet.Rows)
+	}
+	dune := sheet.Rows[1].Cells
+	if dune[0].Number != "1" || dune[3].Ref != "D2" || dune[3].Type != "inlineStr" || dune[3].Text != "9780441013593" || dune[6].Number != "9.5" {
+		t.Errorf("got %+v", dune)
+	}
+	// Empty genre and price cells are left out.
+	if emma := sheet.Rows[2].Cells; len(emma) != 7 || emma[1].Text != "Emma, Volume 1" {
+		t.Errorf("got %+v", emma)
+	}
+}
@@ -0,0 +1,113 @@
+package bookio
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/adedaryorh/bookstore-app/pkg/models"
+)
+
+// The parts of a workbook other than its one sheet, which never change.
+var xlsxParts = []struct{ name, content string }{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Books" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`},
+}
+
+// XLSXWriter writes books as an Excel workbook with one sheet, laid out
+// like the CSV export. Text cells are stored as strings, so spreadsheets
+// don't turn ISBNs into numbers. Rows are compressed as they are written;
+// nothing is held back but the compressor's window.
+type XLSXWriter struct {
+	zw  *zip.Writer
+	out *bufio.Writer
+	row int
+}
+
+// NewXLSXWriter writes the fixed parts of the workbook and the header row
+// to w.
+func NewXLSXWriter(w io.Writer) (*XLSXWriter, error) {
+	zw := zip.NewWriter(w)
+	for _, part := range xlsxParts {
+		f, err := zw.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return nil, err
+		}
+	}
+	sheet, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	x := &XLSXWriter{zw: zw, out: bufio.NewWriter(sheet)}
+	x.out.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	header := append(append([]string{"id"}, Fields...), "created_at", "updated_at")
+	x.startRow()
+	for i, name := range header {
+		x.text(i, name)
+	}
+	x.out.WriteString("</row>")
+	return x, nil
+}
+
+func (x *XLSXWriter) Write(b *models.Book) error {
+	x.startRow()
+	x.number(0, strconv.FormatUint(uint64(b.ID), 10))
+	x.text(1, b.Title)
+	x.text(2, b.Author)
+	x.text(3, b.ISBN)
+	x.text(4, b.PublicationYear)
+	if b.Genre != nil {
+		x.text(5, *b.Genre)
+	}
+	if b.Price != nil {
+		x.number(6, strconv.FormatFloat(*b.Price, 'f', -1, 64))
+	}
+	x.text(7, b.CreatedAt.UTC().Format(time.RFC3339))
+	x.text(8, b.UpdatedAt.UTC().Format(time.RFC3339))
+	_, err := x.out.WriteString("</row>")
+	return err
+}
+
+// Close ends the sheet and the zip archive.
+func (x *XLSXWriter) Close() error {
+	x.out.WriteString("</sheetData></worksheet>")
+	if err := x.out.Flush(); err != nil {
+		return err
+	}
+	return x.zw.Close()
+}
+
+func (x *XLSXWriter) startRow() {
+	x.row++
+	x.out.WriteString(`<row r="` + strconv.Itoa(x.row) + `">`)
+}
+
+// cell returns the reference of column col, counted from 0, in the current
+// row. The sheet has fewer than 26 columns.
+func (x *XLSXWriter) cell(col int) string {
+	return string(rune('A'+col)) + strconv.Itoa(x.row)
+}
+
+func (x *XLSXWriter) text(col int, s string) {
+	x.out.WriteString(`<c r="` + x.cell(col) + `" t="inlineStr"><is><t xml:space="preserve">`)
+	// EscapeText also replaces characters XML can't hold.
+	xml.EscapeText(x.out, []byte(s))
+	x.out.WriteString(`</t></is></c>`)
+}
+
+func (x *XLSXWriter) number(col int, v string) {
+	x.out.WriteString(`<c r="` + x.cell(col) + `"><v>` + v + `</v></c>`)
+}
@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRU(2)
+
+	c.Set(ctx, "a", []byte("1"), 0)
+	c.Set(ctx, "b", []byte("2"), 0)
+	c.Get(ctx, "a") // a is now more recent than b
+	c.Set(ctx, "c", []byte("3"), 0)
+
+	if _, ok, _ := c.Get(ctx, "b"); ok {
+		t.Error("least recently used entry should have been evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok, _ := c.Get(ctx, key); !ok {
+			t.Errorf("entry %s should still be cached", key)
+		}
+	}
+	if c.Len() != 2 || c.Evictions() != 1 {
+		t.Errorf("wrong size or eviction count: len=%d evictions=%d", c.Len(), c.Evictions())
+	}
+}
+
+func TestLRUExpiresEntries(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewLRU(10)
+	c.now = func() time.Time { return now }
+
+	c.Set(ctx, "short", []byte("x"), time.Minute)
+	c.Set(ctx, "forever", []byte("y"), 0)
+
+	now = now.Add(59 * time.Second)
+	if _, ok, _ := c.Get(ctx, "short"); !ok {
+		t.Error("entry expired too early")
+	}
+
+	now = now.Add(time.Second)
+	if _, ok, _ := c.Get(ctx, "short"); ok {
+		t.Error("entry should have expired")
+	}
+	if _, ok, _ := c.Get(ctx, "forever"); !ok {
+		t.Error("entry without TTL should not expire")
+	}
+	if c.Len() != 1 {
+		t.Errorf("expired entry not removed: len=%d", c.Len())
+	}
+}
+
+func TestLRUSetReplacesAndDelete(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRU(10)
+
+	c.Set(ctx, "k", []byte("old"), 0)
+	c.Set(ctx, "k", []byte("new"), 0)
+	if v, _, _ := c.Get(ctx, "k"); string(v) != "new" {
+		t.Errorf("value not replaced: got %s", v)
+	}
+
+	c.Delete(ctx, "k")
+	c.Delete(ctx, "missing")
+	if _, ok, _ := c.Get(ctx, "k"); ok {
+		t.Error("deleted entry still cached")
+	}
+}
@@ -0,0 +1,672 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: bookstore/v1/catalog.proto
+
+// The typed RPC interface to the catalog, for services that would rather
+// not speak JSON. It is served on its own port beside the REST API and
+// backed by the same model layer.
+
+package catalogpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Book struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Id              uint32                 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Title           string                 `protobuf:"bytes,2,opt,name=title,proto3" json:"title,omitempty"`
+	Author          string                 `protobuf:"bytes,3,opt,name=author,proto3" json:"author,omitempty"`
+	Isbn            string                 `protobuf:"bytes,4,opt,name=isbn,proto3" json:"isbn,omitempty"`
+	PublicationYear string                 `protobuf:"bytes,5,opt,name=publication_year,json=publicationYear,proto3" json:"publication_year,omitempty"`
+	Genre           *string                `protobuf:"bytes,6,opt,name=genre,proto3,oneof" json:"genre,omitempty"`
+	Price           *float64               `protobuf:"fixed64,7,opt,name=price,proto3,oneof" json:"price,omitempty"`
+	CoverUrl        *string                `protobuf:"bytes,8,opt,name=cover_url,json=coverUrl,proto3,oneof" json:"cover_url,omitempty"`
+	CreatedAt       *timestamppb.Timestamp `protobuf:"bytes,9,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	UpdatedAt       *timestamppb.Timestamp `protobuf:"bytes,10,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *Book) Reset() {
+	*x = Book{}
+	mi := &file_bookstore_v1_catalog_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Book) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Book) ProtoMessage() {}
+
+func (x *Book) ProtoReflect() protoreflect.Message {
+	mi := &file_bookstore_v1_catalog_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Book.ProtoReflect.Descriptor instead.
+func (*Book) Descriptor() ([]byte, []int) {
+	return file_bookstore_v1_catalog_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Book) GetId() uint32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Book) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+func (x *Book) GetAuthor() string {
+	if x != nil {
+		return x.Author
+	}
+	return ""
+}
+
+func (x *Book) GetIsbn() string {
+	if x != nil {
+		return x.Isbn
+	}
+	return ""
+}
+
+func (x *Book) GetPublicationYear() string {
+	if x != nil {
+		return x.PublicationYear
+	}
+	return ""
+}
+
+func (x *Book) GetGenre() string {
+	if x != nil && x.Genre != nil {
+		return *x.Genre
+	}
+	return ""
+}
+
+func (x *Book) GetPrice() float64 {
+	if x != nil && x.Price != nil {
+		return *x.Price
+	}
+	return 0
+}
+
+func (x *Book) GetCoverUrl() string {
+	if x != nil && x.CoverUrl != nil {
+		return *x.CoverUrl
+	}
+	return ""
+}
+
+func (x *Book) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *Book) GetUpdatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return nil
+}
+
+type GetBookRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    uint32                 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	// If set, the book is returned as it was then, as with ?as_of.
+	AsOf          *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=as_of,json=asOf,proto3" json:"as_of,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetBookRequest) Reset() {
+	*x = GetBookRequest{}
+	mi := &file_bookstore_v1_catalog_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetBookRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetBookRequest) ProtoMessage() {}
+
+func (x *GetBookRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_bookstore_v1_catalog_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetBookRequest.ProtoReflect.Descriptor instead.
+func (*GetBookRequest) Descriptor() ([]byte, []int) {
+	return file_bookstore_v1_catalog_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *GetBookRequest) GetId() uint32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *GetBookRequest) GetAsOf() *timestamppb.Timestamp {
+	if x != nil {
+		return x.AsOf
+	}
+	return nil
+}
+
+// ListBooksRequest narrows the listing as the query string of GET /book
+// does. Empty fields match every book.
+type ListBooksRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Matches books whose title contains it, ignoring case.
+	Title string `protobuf:"bytes,1,opt,name=title,proto3" json:"title,omitempty"`
+	// Matches the whole author, ignoring case.
+	Author string `protobuf:"bytes,2,opt,name=author,proto3" json:"author,omitempty"`
+	// Matches the whole genre, ignoring case.
+	Genre string `protobuf:"bytes,3,opt,name=genre,proto3" json:"genre,omitempty"`
+	// Matches either form of the book's ISBN.
+	Isbn            string `protobuf:"bytes,4,opt,name=isbn,proto3" json:"isbn,omitempty"`
+	PublicationYear string `protobuf:"bytes,5,opt,name=publication_year,json=publicationYear,proto3" json:"publication_year,omitempty"`
+	// Matches books changed at or after it.
+	UpdatedSince  *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=updated_since,json=updatedSince,proto3" json:"updated_since,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListBooksRequest) Reset() {
+	*x = ListBooksRequest{}
+	mi := &file_bookstore_v1_catalog_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListBooksRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListBooksRequest) ProtoMessage() {}
+
+func (x *ListBooksRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_bookstore_v1_catalog_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListBooksRequest.ProtoReflect.Descriptor instead.
+func (*ListBooksRequest) Descriptor() ([]byte, []int) {
+	return file_bookstore_v1_catalog_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ListBooksRequest) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+func (x *ListBooksRequest) GetAuthor() string {
+	if x != nil {
+		return x.Author
+	}
+	return ""
+}
+
+func (x *ListBooksRequest) GetGenre() string {
+	if x != nil {
+		return x.Genre
+	}
+	return ""
+}
+
+func (x *ListBooksRequest) GetIsbn() string {
+	if x != nil {
+		return x.Isbn
+	}
+	return ""
+}
+
+func (x *ListBooksRequest) GetPublicationYear() string {
+	if x != nil {
+		return x.PublicationYear
+	}
+	return ""
+}
+
+func (x *ListBooksRequest) GetUpdatedSince() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdatedSince
+	}
+	return nil
+}
+
+type BatchGetBooksRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// At most 500 IDs.
+	Ids           []uint32 `protobuf:"varint,1,rep,packed,name=ids,proto3" json:"ids,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchGetBooksRequest) Reset() {
+	*x = BatchGetBooksRequest{}
+	mi := &file_bookstore_v1_catalog_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchGetBooksRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchGetBooksRequest) ProtoMessage() {}
+
+func (x *BatchGetBooksRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_bookstore_v1_catalog_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchGetBooksRequest.ProtoReflect.Descriptor instead.
+func (*BatchGetBooksRequest) Descriptor() ([]byte, []int) {
+	return file_bookstore_v1_catalog_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *BatchGetBooksRequest) GetIds() []uint32 {
+	if x != nil {
+		return x.Ids
+	}
+	return nil
+}
+
+type BatchGetBooksResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The books found, in the order their IDs were asked for.
+	Books []*Book `protobuf:"bytes,1,rep,name=books,proto3" json:"books,omitempty"`
+	// The IDs no book has.
+	MissingIds    []uint32 `protobuf:"varint,2,rep,packed,name=missing_ids,json=missingIds,proto3" json:"missing_ids,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchGetBooksResponse) Reset() {
+	*x = BatchGetBooksResponse{}
+	mi := &file_bookstore_v1_catalog_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchGetBooksResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchGetBooksResponse) ProtoMessage() {}
+
+func (x *BatchGetBooksResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_bookstore_v1_catalog_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchGetBooksResponse.ProtoReflect.Descriptor instead.
+func (*BatchGetBooksResponse) Descriptor() ([]byte, []int) {
+	return file_bookstore_v1_catalog_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *BatchGetBooksResponse) GetBooks() []*Book {
+	if x != nil {
+		return x.Books
+	}
+	return nil
+}
+
+func (x *BatchGetBooksResponse) GetMissingIds() []uint32 {
+	if x != nil {
+		return x.MissingIds
+	}
+	return nil
+}
+
+type CreateBookRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The ID and timestamps are ignored.
+	Book *Book `protobuf:"bytes,1,opt,name=book,proto3" json:"book,omitempty"`
+	// Replace the book with the same ISBN, if there is one, rather than
+	// failing with ALREADY_EXISTS, as ?upsert=true does.
+	Upsert        bool `protobuf:"varint,2,opt,name=upsert,proto3" json:"upsert,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateBookRequest) Reset() {
+	*x = CreateBookRequest{}
+	mi := &file_bookstore_v1_catalog_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateBookRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateBookRequest) ProtoMessage() {}
+
+func (x *CreateBookRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_bookstore_v1_catalog_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateBookRequest.ProtoReflect.Descriptor instead.
+func (*CreateBookRequest) Descriptor() ([]byte, []int) {
+	return file_bookstore_v1_catalog_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *CreateBookRequest) GetBook() *Book {
+	if x != nil {
+		return x.Book
+	}
+	return nil
+}
+
+func (x *CreateBookRequest) GetUpsert() bool {
+	if x != nil {
+		return x.Upsert
+	}
+	return false
+}
+
+type UpdateBookRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    uint32                 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	// The ID and timestamps are ignored.
+	Book          *Book `protobuf:"bytes,2,opt,name=book,proto3" json:"book,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateBookRequest) Reset() {
+	*x = UpdateBookRequest{}
+	mi := &file_bookstore_v1_catalog_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateBookRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateBookRequest) ProtoMessage() {}
+
+func (x *UpdateBookRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_bookstore_v1_catalog_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateBookRequest.ProtoReflect.Descriptor instead.
+func (*UpdateBookRequest) Descriptor() ([]byte, []int) {
+	return file_bookstore_v1_catalog_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *UpdateBookRequest) GetId() uint32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *UpdateBookRequest) GetBook() *Book {
+	if x != nil {
+		return x.Book
+	}
+	return nil
+}
+
+type DeleteBookRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            uint32                 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteBookRequest) Reset() {
+	*x = DeleteBookRequest{}
+	mi := &file_bookstore_v1_catalog_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteBookRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteBookRequest) ProtoMessage() {}
+
+func (x *DeleteBookRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_bookstore_v1_catalog_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteBookRequest.ProtoReflect.Descriptor instead.
+func (*DeleteBookRequest) Descriptor() ([]byte, []int) {
+	return file_bookstore_v1_catalog_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *DeleteBookRequest) GetId() uint32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+var File_bookstore_v1_catalog_proto protoreflect.FileDescriptor
+
+const file_bookstore_v1_catalog_proto_rawDesc = "" +
+	"\n" +
+	"\x1abookstore/v1/catalog.proto\x12\fbookstore.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xf3\x02\n" +
+	"\x04Book\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\rR\x02id\x12\x14\n" +
+	"\x05title\x18\x02 \x01(\tR\x05title\x12\x16\n" +
+	"\x06author\x18\x03 \x01(\tR\x06author\x12\x12\n" +
+	"\x04isbn\x18\x04 \x01(\tR\x04isbn\x12)\n" +
+	"\x10publication_year\x18\x05 \x01(\tR\x0fpublicationYear\x12\x19\n" +
+	"\x05genre\x18\x06 \x01(\tH\x00R\x05genre\x88\x01\x01\x12\x19\n" +
+	"\x05price\x18\a \x01(\x01H\x01R\x05price\x88\x01\x01\x12 \n" +
+	"\tcover_url\x18\b \x01(\tH\x02R\bcoverUrl\x88\x01\x01\x129\n" +
+	"\n" +
+	"created_at\x18\t \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x129\n" +
+	"\n" +
+	"updated_at\x18\n" +
+	" \x01(\v2\x1a.google.protobuf.TimestampR\tupdatedAtB\b\n" +
+	"\x06_genreB\b\n" +
+	"\x06_priceB\f\n" +
+	"\n" +
+	"_cover_url\"Q\n" +
+	"\x0eGetBookRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\rR\x02id\x12/\n" +
+	"\x05as_of\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\x04asOf\"\xd6\x01\n" +
+	"\x10ListBooksRequest\x12\x14\n" +
+	"\x05title\x18\x01 \x01(\tR\x05title\x12\x16\n" +
+	"\x06author\x18\x02 \x01(\tR\x06author\x12\x14\n" +
+	"\x05genre\x18\x03 \x01(\tR\x05genre\x12\x12\n" +
+	"\x04isbn\x18\x04 \x01(\tR\x04isbn\x12)\n" +
+	"\x10publication_year\x18\x05 \x01(\tR\x0fpublicationYear\x12?\n" +
+	"\rupdated_since\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\fupdatedSince\"(\n" +
+	"\x14BatchGetBooksRequest\x12\x10\n" +
+	"\x03ids\x18\x01 \x03(\rR\x03ids\"b\n" +
+	"\x15BatchGetBooksResponse\x12(\n" +
+	"\x05books\x18\x01 \x03(\v2\x12.bookstore.v1.BookR\x05books\x12\x1f\n" +
+	"\vmissing_ids\x18\x02 \x03(\rR\n" +
+	"missingIds\"S\n" +
+	"\x11CreateBookRequest\x12&\n" +
+	"\x04book\x18\x01 \x01(\v2\x12.bookstore.v1.BookR\x04book\x12\x16\n" +
+	"\x06upsert\x18\x02 \x01(\bR\x06upsert\"K\n" +
+	"\x11UpdateBookRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\rR\x02id\x12&\n" +
+	"\x04book\x18\x02 \x01(\v2\x12.bookstore.v1.BookR\x04book\"#\n" +
+	"\x11DeleteBookRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\rR\x02id2\xb0\x03\n" +
+	"\vBookCatalog\x12;\n" +
+	"\aGetBook\x12\x1c.bookstore.v1.GetBookRequest\x1a\x12.bookstore.v1.Book\x12A\n" +
+	"\tListBooks\x12\x1e.bookstore.v1.ListBooksRequest\x1a\x12.bookstore.v1.Book0\x01\x12X\n" +
+	"\rBatchGetBooks\x12\".bookstore.v1.BatchGetBooksRequest\x1a#.bookstore.v1.BatchGetBooksResponse\x12A\n" +
+	"\n" +
+	"CreateBook\x12\x1f.bookstore.v1.CreateBookRequest\x1a\x12.bookstore.v1.Book\x12A\n" +
+	"\n" +
+	"UpdateBook\x12\x1f.bookstore.v1.UpdateBookRequest\x1a\x12.bookstore.v1.Book\x12A\n" +
+	"\n" +
+	"DeleteBook\x12\x1f.bookstore.v1.DeleteBookRequest\x1a\x12.bookstore.v1.BookB=Z;github.com/adedaryorh/bookstore-app/pkg/catalogpb;catalogpbb\x06proto3"
+
+var (
+	file_bookstore_v1_catalog_proto_rawDescOnce sync.Once
+	file_bookstore_v1_catalog_proto_rawDescData []byte
+)
+
+func file_bookstore_v1_catalog_proto_rawDescGZIP() []byte {
+	file_bookstore_v1_catalog_proto_rawDescOnce.Do(func() {
+		file_bookstore_v1_catalog_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_bookstore_v1_catalog_proto_rawDesc), len(file_bookstore_v1_catalog_proto_rawDesc)))
+	})
+	return file_bookstore_v1_catalog_proto_rawDescData
+}
+
+var file_bookstore_v1_catalog_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
+var file_bookstore_v1_catalog_proto_goTypes = []any{
+	(*Book)(nil),                  // 0: bookstore.v1.Book
+	(*GetBookRequest)(nil),        // 1: bookstore.v1.GetBookRequest
+	(*ListBooksRequest)(nil),      // 2: bookstore.v1.ListBooksRequest
+	(*BatchGetBooksRequest)(nil),  // 3: bookstore.v1.BatchGetBooksRequest
+	(*BatchGetBooksResponse)(nil), // 4: bookstore.v1.BatchGetBooksResponse
+	(*CreateBookRequest)(nil),     // 5: bookstore.v1.CreateBookRequest
+	(*UpdateBookRequest)(nil),     // 6: bookstore.v1.UpdateBookRequest
+	(*DeleteBookRequest)(nil),     // 7: bookstore.v1.DeleteBookRequest
+	(*timestamppb.Timestamp)(nil), // 8: google.protobuf.Timestamp
+}
+var file_bookstore_v1_catalog_proto_depIdxs = []int32{
+	8,  // 0: bookstore.v1.Book.created_at:type_name -> google.protobuf.Timestamp
+	8,  // 1: bookstore.v1.Book.updated_at:type_name -> google.protobuf.Timestamp
+	8,  // 2: bookstore.v1.GetBookRequest.as_of:type_name -> google.protobuf.Timestamp
+	8,  // 3: bookstore.v1.ListBooksRequest.updated_since:type_name -> google.protobuf.Timestamp
+	0,  // 4: bookstore.v1.BatchGetBooksResponse.books:type_name -> bookstore.v1.Book
+	0,  // 5: bookstore.v1.CreateBookRequest.book:type_name -> bookstore.v1.Book
+	0,  // 6: bookstore.v1.UpdateBookRequest.book:type_name -> bookstore.v1.Book
+	1,  // 7: bookstore.v1.BookCatalog.GetBook:input_type -> bookstore.v1.GetBookRequest
+	2,  // 8: bookstore.v1.BookCatalog.ListBooks:input_type -> bookstore.v1.ListBooksRequest
+	3,  // 9: bookstore.v1.BookCatalog.BatchGetBooks:input_type -> bookstore.v1.BatchGetBooksRequest
+	5,  // 10: bookstore.v1.BookCatalog.CreateBook:input_type -> bookstore.v1.CreateBookRequest
+	6,  // 11: bookstore.v1.BookCatalog.UpdateBook:input_type -> bookstore.v1.UpdateBookRequest
+	7,  // 12: bookstore.v1.BookCatalog.DeleteBook:input_type -> bookstore.v1.DeleteBookRequest
+	0,  // 13: bookstore.v1.BookCatalog.GetBook:output_type -> bookstore.v1.Book
+	0,  // 14: bookstore.v1.BookCatalog.ListBooks:output_type -> bookstore.v1.Book
+	4,  // 15: bookstore.v1.BookCatalog.BatchGetBooks:output_type -> bookstore.v1.BatchGetBooksResponse
+	0,  // 16: bookstore.v1.BookCatalog.CreateBook:output_type -> bookstore.v1.Book
+	0,  // 17: bookstore.v1.BookCatalog.UpdateBook:output_type -> bookstore.v1.Book
+	0,  // 18: bookstore.v1.BookCatalog.DeleteBook:output_type -> bookstore.v1.Book
+	13, // [13:19] is the sub-list for method output_type
+	7,  // [7:13] is the sub-list for method input_type
+	7,  // [7:7] is the sub-list for extension type_name
+	7,  // [7:7] is the sub-list for extension extendee
+	0,  // [0:7] is the sub-list for field type_name
+}
+
+func init() { file_bookstore_v1_catalog_proto_init() }
+func file_bookstore_v1_catalog_proto_init() {
+	if File_bookstore_v1_catalog_proto != nil {
+		return
+	}
+	file_bookstore_v1_catalog_proto_msgTypes[0].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_bookstore_v1_catalog_proto_rawDesc), len(file_bookstore_v1_catalog_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   8,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_bookstore_v1_catalog_proto_goTypes,
+		DependencyIndexes: file_bookstore_v1_catalog_proto_depIdxs,
+		MessageInfos:      file_bookstore_v1_catalog_proto_msgTypes,
+	}.Build()
+	File_bookstore_v1_catalog_proto = out.File
+	file_bookstore_v1_catalog_proto_goTypes = nil
+	file_bookstore_v1_catalog_proto_depIdxs = nil
+}
@@ -0,0 +1,4 @@
+// Package catalogpb is the Go code generated from
+// proto/bookstore/v1/catalog.proto, the BookCatalog gRPC service. Edit the
+// proto and run make proto rather than editing the generated files.
+package catalogpb
@@ -1,38 +1,171 @@
 package config
 
 import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
-	"os"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"syscall"
+	"time"
 
+	"github.com/adedaryorh/bookstore-app/pkg/logging"
 	"github.com/jinzhu/gorm"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
-var db *gorm.DB
+var (
+	db       *gorm.DB
+	replicas []Replica
+)
 
-func Connect() {
-	dbHost := os.Getenv("DB_HOST")
-	dbPort := os.Getenv("DB_PORT")
-	dbUser := os.Getenv("DB_USER")
-	dbPassword := os.Getenv("DB_PASSWORD")
-	dbName := os.Getenv("DB_NAME")
+// Replica is a connection to a read-only replica of the primary database.
+type Replica struct {
+	// Name identifies the replica in logs; it never contains the password.
+	Name string
+	DB   *gorm.DB
+}
 
-	if dbHost == "" || dbPort == "" || dbUser == "" || dbPassword == "" || dbName == "" {
-		panic("One or more required database environment variables are missing")
+// Connect opens the shared database handle and applies the pool settings.
+// Postgres is often still starting when the application comes up, so failed
+// attempts are retried with exponential backoff up to cfg.ConnectAttempts
+// times or until ctx is cancelled.
+func Connect(ctx context.Context, cfg DatabaseConfig) error {
+	conn, err := open(ctx, cfg)
+	if err != nil {
+		return err
 	}
+	configurePool(conn, cfg)
+	db = conn
+	slog.Info("database connected", "host", cfg.Host, "port", cfg.Port, "database", cfg.Name, "sslmode", cfg.SSLMode)
 
-	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		dbHost, dbPort, dbUser, dbPassword, dbName)
+	replicas = nil
+	for _, dsn := range cfg.Replicas {
+		replica, err := openReplica(dsn)
+		if err != nil {
+			return err
+		}
+		configurePool(replica.DB, cfg)
+		replicas = append(replicas, replica)
+	}
+	return nil
+}
+
+func configurePool(conn *gorm.DB, cfg DatabaseConfig) {
+	conn.SetLogger(logging.GormLogger{})
+	sqlDB := conn.DB()
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+}
 
-	var err error
-	db, err = gorm.Open("postgres", dsn)
+// openReplica opens a replica without requiring it to be up: an unreachable
+// replica is skipped by the health checks instead of blocking startup.
+func openReplica(dsn string) (Replica, error) {
+	name := RedactDSN(dsn)
+	sqlDB, err := sql.Open("postgres", dsn)
 	if err != nil {
-		panic(fmt.Sprintf("Failed to connect to database: %v", err))
+		return Replica{}, fmt.Errorf("invalid replica %s: %w", name, err)
 	}
+	conn, err := gorm.Open("postgres", sqlDB)
+	if err != nil {
+		if !IsConnectionError(err) {
+			sqlDB.Close()
+			return Replica{}, fmt.Errorf("opening replica %s: %w", name, err)
+		}
+		slog.Warn("database replica not reachable", "replica", name, "error", err)
+	}
+	return Replica{Name: name, DB: conn}, nil
+}
+
+func open(ctx context.Context, cfg DatabaseConfig) (*gorm.DB, error) {
+	attempts := max(cfg.ConnectAttempts, 1)
+	var lastErr error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		conn, err := gorm.Open("postgres", cfg.DSN())
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+		if !IsConnectionError(err) {
+			// Bad credentials or an unknown database won't fix themselves.
+			break
+		}
+		if attempt == attempts {
+			break
+		}
 
-	fmt.Println("Database connected successfully!")
+		delay := backoff(cfg.RetryBackoff, cfg.RetryMaxBackoff, attempt)
+		slog.Warn("database not reachable, retrying",
+			"attempt", attempt, "max_attempts", attempts, "retry_in", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("connecting to database %s: %w", cfg, ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+	return nil, fmt.Errorf("failed to connect to database %s: %w", cfg, lastErr)
+}
+
+// backoff returns the delay before retry number attempt: base doubled for
+// every previous attempt, capped at limit, with up to 20% random jitter so
+// several instances don't retry in lockstep.
+func backoff(base, limit time.Duration, attempt int) time.Duration {
+	delay := base
+	for i := 1; i < attempt && delay < limit; i++ {
+		delay *= 2
+	}
+	if delay > limit {
+		delay = limit
+	}
+	jitter := time.Duration(rand.Int64N(int64(delay)/5 + 1))
+	return delay - jitter
 }
 
 func GetDb() *gorm.DB {
 	return db
 }
+
+// GetReplicas returns the read replicas opened by Connect.
+func GetReplicas() []Replica {
+	return replicas
+}
+
+// Ping checks that the database is reachable.
+func Ping(ctx context.Context) error {
+	if db == nil {
+		return errors.New("database is not connected")
+	}
+	return db.DB().PingContext(ctx)
+}
+
+// IsConnectionError reports whether err means the database could not be
+// reached or dropped the connection, as opposed to rejecting a query.
+func IsConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch {
+		case pqErr.Code.Class() == "08": // connection_exception
+			return true
+		case pqErr.Code == "57P01", pqErr.Code == "57P02", pqErr.Code == "57P03": // shutdown, crash, cannot connect now
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func TestBackoff(t *testing.T) {
+	base, limit := 100*time.Millisecond, time.Second
+	expected := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for i, want := range expected {
+		want *= time.Millisecond
+		got := backoff(base, limit, i+1)
+		if got > want || got < want-want/5 {
+			t.Errorf("attempt %d: got %v want %v minus at most 20%% jitter", i+1, got, want)
+		}
+	}
+}
+
+func TestConnectGivesUpAfterAttempts(t *testing.T) {
+	// Nothing listens on port 1, so every attempt is refused immediately.
+	cfg := Default().Database
+	cfg.Host = "127.0.0.1"
+	cfg.Port = 1
+	cfg.User = "bookstore_user"
+	cfg.Password = "secret"
+	cfg.Name = "bookstore"
+	cfg.ConnectAttempts = 3
+	cfg.RetryBackoff = time.Millisecond
+	cfg.RetryMaxBackoff = 2 * time.Millisecond
+
+	err := Connect(context.Background(), cfg)
+	if err == nil {
+		t.Fatal("expected connection error")
+	}
+	if !IsConnectionError(err) {
+		t.Errorf("error should be classified as a connection error: %v", err)
+	}
+	if strings.Contains(err.Error(), "secret") {
+		t.Errorf("password leaked into error: %v", err)
+	}
+}
+
+func TestConnectStopsWhenCancelled(t *testing.T) {
+	cfg := Default().Database
+	cfg.Host = "127.0.0.1"
+	cfg.Port = 1
+	cfg.ConnectAttempts = 100
+	cfg.RetryBackoff = time.Hour
+	cfg.RetryMaxBackoff = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := Connect(ctx, cfg)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline error, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("Connect did not stop when the context was cancelled")
+	}
+}
+
+func TestIsConnectionError(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{driver.ErrBadConn, true},
+		{fmt.Errorf("query: %w", driver.ErrBadConn), true},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{&pq.Error{Code: "08006"}, true},
+		{&pq.Error{Code: "57P01"}, true},
+		{&pq.Error{Code: "23505"}, false},
+		{&pq.Error{Code: "28P01"}, false},
+		{errors.New("record not found"), false},
+	}
+	for _, c := range cases {
+		if got := IsConnectionError(c.err); got != c.want {
+			t.Errorf("IsConnectionError(%v): got %v want %v", c.err, got, c.want)
+		}
+	}
+}
+
+func TestDSNIncludesTLSSettings(t *testing.T) {
+	cfg := Default().Database
+	cfg.Host = "db.internal"
+	cfg.User = "bookstore_user"
+	cfg.Password = "p@ss word"
+	cfg.Name = "bookstore"
+	cfg.SSLMode = "verify-full"
+	cfg.SSLRootCert = "/etc/ssl/ca.pem"
+	cfg.SSLCert = "/etc/ssl/client.pem"
+	cfg.SSLKey = "/etc/ssl/client.key"
+	cfg.ConnectTimeout = 1500 * time.Millisecond
+
+	dsn := cfg.DSN()
+	for _, want := range []string{
+		"sslmode=verify-full",
+		"sslrootcert=/etc/ssl/ca.pem",
+		"sslcert=/etc/ssl/client.pem",
+		"sslkey=/etc/ssl/client.key",
+		"connect_timeout=2",
+		"password='p@ss word'",
+	} {
+		if !strings.Contains(dsn, want) {
+			t.Errorf("DSN missing %q: %s", want, dsn)
+		}
+	}
+}
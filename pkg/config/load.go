@@ -0,0 +1,889 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds every setting the application reads at startup.
+type Config struct {
+	Server      ServerConfig      `yaml:"server" toml:"server"`
+	Database    DatabaseConfig    `yaml:"database" toml:"database"`
+	Log         LogConfig         `yaml:"log" toml:"log"`
+	Tracing     TracingConfig     `yaml:"tracing" toml:"tracing"`
+	Cache       CacheConfig       `yaml:"cache" toml:"cache"`
+	ONIX        ONIXConfig        `yaml:"onix" toml:"onix"`
+	Enrich      EnrichConfig      `yaml:"enrich" toml:"enrich"`
+	Covers      CoversConfig      `yaml:"covers" toml:"covers"`
+	Outbox      OutboxConfig      `yaml:"outbox" toml:"outbox"`
+	Webhooks    WebhooksConfig    `yaml:"webhooks" toml:"webhooks"`
+	Stream      StreamConfig      `yaml:"stream" toml:"stream"`
+	Bulk        BulkConfig        `yaml:"bulk" toml:"bulk"`
+	Idempotency IdempotencyConfig `yaml:"idempotency" toml:"idempotency"`
+	GraphQL     GraphQLConfig     `yaml:"graphql" toml:"graphql"`
+	GRPC        GRPCConfig        `yaml:"grpc" toml:"grpc"`
+}
+
+// ServerConfig controls the HTTP listener.
+type ServerConfig struct {
+	Addr              string        `yaml:"addr" toml:"addr"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" toml:"read_timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" toml:"read_header_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" toml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" toml:"idle_timeout"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	// CacheControl maps a GET route, as registered, to the Cache-Control
+	// header sent with its successful responses. It can only be set in the
+	// configuration file.
+	CacheControl map[string]string `yaml:"cache_control" toml:"cache_control"`
+	// AdminToken is the bearer token required by the /admin, /webhooks
+	// and /debug/vars endpoints; empty leaves them open.
+	AdminToken string `yaml:"admin_token" toml:"admin_token"`
+}
+
+// DatabaseConfig describes the Postgres connection and its pool.
+type DatabaseConfig struct {
+	Host            string        `yaml:"host" toml:"host"`
+	Port            int           `yaml:"port" toml:"port"`
+	User            string        `yaml:"user" toml:"user"`
+	Password        string        `yaml:"password" toml:"password"`
+	Name            string        `yaml:"name" toml:"name"`
+	SSLMode         string        `yaml:"sslmode" toml:"sslmode"`
+	SSLRootCert     string        `yaml:"sslrootcert" toml:"sslrootcert"`
+	SSLCert         string        `yaml:"sslcert" toml:"sslcert"`
+	SSLKey          string        `yaml:"sslkey" toml:"sslkey"`
+	ConnectTimeout  time.Duration `yaml:"connect_timeout" toml:"connect_timeout"`
+	ConnectAttempts int           `yaml:"connect_attempts" toml:"connect_attempts"`
+	RetryBackoff    time.Duration `yaml:"retry_backoff" toml:"retry_backoff"`
+	RetryMaxBackoff time.Duration `yaml:"retry_max_backoff" toml:"retry_max_backoff"`
+	MaxOpenConns    int           `yaml:"max_open_conns" toml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" toml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" toml:"conn_max_idle_time"`
+	// Replicas are connection strings for read-only replicas. Catalog reads
+	// are spread across the healthy ones; the settings above apply to the
+	// primary only, except for the pool limits.
+	Replicas              []string      `yaml:"replicas" toml:"replicas"`
+	ReplicaHealthInterval time.Duration `yaml:"replica_health_interval" toml:"replica_health_interval"`
+	ReadYourWritesWindow  time.Duration `yaml:"read_your_writes_window" toml:"read_your_writes_window"`
+}
+
+// LogConfig controls the default logger.
+type LogConfig struct {
+	Level  string `yaml:"level" toml:"level"`
+	Format string `yaml:"format" toml:"format"`
+}
+
+// TracingConfig selects the span exporter.
+type TracingConfig struct {
+	Exporter    string `yaml:"exporter" toml:"exporter"`
+	File        string `yaml:"file" toml:"file"`
+	ServiceName string `yaml:"service_name" toml:"service_name"`
+}
+
+// CacheConfig sizes the in-process book cache.
+type CacheConfig struct {
+	// Size is the maximum number of cached books; 0 disables the cache.
+	Size int           `yaml:"size" toml:"size"`
+	TTL  time.Duration `yaml:"ttl" toml:"ttl"`
+}
+
+// ONIXConfig describes the store in ONIX messages and the publisher feed
+// imported in the background.
+type ONIXConfig struct {
+	SenderName string `yaml:"sender_name" toml:"sender_name"`
+	// Currency selects which ONIX price becomes Book.Price.
+	Currency string `yaml:"currency" toml:"currency"`
+	// FeedURL is polled every FeedInterval when set.
+	FeedURL      string        `yaml:"feed_url" toml:"feed_url"`
+	FeedInterval time.Duration `yaml:"feed_interval" toml:"feed_interval"`
+}
+
+// EnrichConfig selects the external source of book metadata looked up by
+// ISBN.
+type EnrichConfig struct {
+	// Provider is openlibrary, googlebooks or none.
+	Provider string `yaml:"provider" toml:"provider"`
+	// BaseURL replaces the provider's public API, e.g. with a mirror.
+	BaseURL string        `yaml:"base_url" toml:"base_url"`
+	APIKey  string        `yaml:"api_key" toml:"api_key"`
+	Timeout time.Duration `yaml:"timeout" toml:"timeout"`
+	// OnCreate fills the blank fields of new books automatically.
+	OnCreate bool `yaml:"on_create" toml:"on_create"`
+	// CacheSize is the number of lookups remembered; 0 disables caching.
+	CacheSize int           `yaml:"cache_size" toml:"cache_size"`
+	CacheTTL  time.Duration `yaml:"cache_ttl" toml:"cache_ttl"`
+}
+
+// CoversConfig controls cover image uploads.
+type CoversConfig struct {
+	// Dir is where cover images are stored; empty disables uploads.
+	Dir string `yaml:"dir" toml:"dir"`
+	// MaxBytes is the largest upload accepted.
+	MaxBytes int `yaml:"max_bytes" toml:"max_bytes"`
+}
+
+// OutboxConfig controls the relay publishing book events from the outbox.
+type OutboxConfig struct {
+	// Publisher is log, http or none; none leaves events in the outbox.
+	Publisher string `yaml:"publisher" toml:"publisher"`
+	// URL receives events from the http publisher.
+	URL string `yaml:"url" toml:"url"`
+	// Interval is how often the outbox is polled when idle.
+	Interval  time.Duration `yaml:"interval" toml:"interval"`
+	BatchSize int           `yaml:"batch_size" toml:"batch_size"`
+	// Lease is how long a relay holds a batch of events it is publishing.
+	Lease time.Duration `yaml:"lease" toml:"lease"`
+	// MaxAttempts is how many tries an event gets before it is dead.
+	MaxAttempts int `yaml:"max_attempts" toml:"max_attempts"`
+	// Retention is how long published events are kept; 0 keeps them.
+	Retention time.Duration `yaml:"retention" toml:"retention"`
+}
+
+// WebhooksConfig controls delivery of book events to webhook
+// subscriptions.
+type WebhooksConfig struct {
+	Enabled bool `yaml:"enabled" toml:"enabled"`
+	// Interval is how often due deliveries are looked for when idle.
+	Interval  time.Duration `yaml:"interval" toml:"interval"`
+	BatchSize int           `yaml:"batch_size" toml:"batch_size"`
+	// Timeout bounds a single delivery attempt.
+	Timeout time.Duration `yaml:"timeout" toml:"timeout"`
+	// MaxAttempts is how many tries a delivery gets before it is dead.
+	MaxAttempts int `yaml:"max_attempts" toml:"max_attempts"`
+	// RetryBackoff doubles after each failure, up to RetryMaxBackoff.
+	RetryBackoff    time.Duration `yaml:"retry_backoff" toml:"retry_backoff"`
+	RetryMaxBackoff time.Duration `yaml:"retry_max_backoff" toml:"retry_max_backoff"`
+	// Retention is how long successful deliveries are logged; 0 keeps them.
+	Retention time.Duration `yaml:"retention" toml:"retention"`
+}
+
+// StreamConfig controls the live stream of book events.
+type StreamConfig struct {
+	// BufferSize is how many recent events a reconnecting client can
+	// catch up on.
+	BufferSize int `yaml:"buffer_size" toml:"buffer_size"`
+	// Heartbeat is how often an idle stream sends a comment.
+	Heartbeat time.Duration `yaml:"heartbeat" toml:"heartbeat"`
+}
+
+// BulkConfig controls POST /books/bulk.
+type BulkConfig struct {
+	// MaxOperations is the most operations one request may carry.
+	MaxOperations int `yaml:"max_operations" toml:"max_operations"`
+}
+
+// IdempotencyConfig controls Idempotency-Key handling.
+type IdempotencyConfig struct {
+	// TTL is how long a key's response is kept for replay; 0 turns
+	// Idempotency-Key handling off.
+	TTL time.Duration `yaml:"ttl" toml:"ttl"`
+}
+
+// GraphQLConfig limits the queries /graphql runs.
+type GraphQLConfig struct {
+	// MaxDepth is how deeply a query's selections may nest.
+	MaxDepth int `yaml:"max_depth" toml:"max_depth"`
+	// MaxComplexity bounds the fields a query may resolve, counting the
+	// fields under a list once per item of the page it asks for.
+	MaxComplexity int `yaml:"max_complexity" toml:"max_complexity"`
+}
+
+// GRPCConfig controls the gRPC listener serving the BookCatalog service.
+type GRPCConfig struct {
+	// Addr is the listen address, which must differ from the HTTP one;
+	// empty, the default, turns the gRPC server off. The service has no
+	// authentication or TLS of its own, so it belongs on a private
+	// network.
+	Addr string `yaml:"addr" toml:"addr"`
+	// Reflection lets tools such as grpcurl list and describe the services
+	// without the proto files.
+	Reflection bool `yaml:"reflection" toml:"reflection"`
+}
+
+const redacted = "REDACTED"
+
+// Default returns the configuration used when no source overrides a value.
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Addr:              ":8080",
+			ReadTimeout:       15 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       60 * time.Second,
+			ShutdownTimeout:   15 * time.Second,
+			CacheControl: map[string]string{
+				"/books":        "no-cache",
+				"/book":         "no-cache",
+				"/book/:bookId": "no-cache",
+			},
+		},
+		Database: DatabaseConfig{
+			Port:                  5432,
+			SSLMode:               "disable",
+			ConnectTimeout:        5 * time.Second,
+			ConnectAttempts:       10,
+			RetryBackoff:          500 * time.Millisecond,
+			RetryMaxBackoff:       15 * time.Second,
+			MaxOpenConns:          25,
+			MaxIdleConns:          5,
+			ConnMaxLifetime:       30 * time.Minute,
+			ConnMaxIdleTime:       5 * time.Minute,
+			ReplicaHealthInterval: 5 * time.Second,
+			ReadYourWritesWindow:  5 * time.Second,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "json",
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			ServiceName: "bookstore-app",
+		},
+		Cache: CacheConfig{
+			Size: 10000,
+			TTL:  time.Minute,
+		},
+		ONIX: ONIXConfig{
+			SenderName:   "bookstore-app",
+			Currency:     "USD",
+			FeedInterval: time.Hour,
+		},
+		Enrich: EnrichConfig{
+			Provider:  "none",
+			Timeout:   5 * time.Second,
+			CacheSize: 10000,
+			CacheTTL:  24 * time.Hour,
+		},
+		Covers: CoversConfig{
+			Dir:      "data/covers",
+			MaxBytes: 5 << 20,
+		},
+		Outbox: OutboxConfig{
+			Publisher:   "log",
+			Interval:    time.Second,
+			BatchSize:   100,
+			Lease:       5 * time.Minute,
+			MaxAttempts: 20,
+			Retention:   7 * 24 * time.Hour,
+		},
+		Webhooks: WebhooksConfig{
+			Enabled:         true,
+			Interval:        5 * time.Second,
+			BatchSize:       20,
+			Timeout:         10 * time.Second,
+			MaxAttempts:     10,
+			RetryBackoff:    30 * time.Second,
+			RetryMaxBackoff: 6 * time.Hour,
+			Retention:       30 * 24 * time.Hour,
+		},
+		Stream: StreamConfig{
+			BufferSize: 1000,
+			Heartbeat:  15 * time.Second,
+		},
+		Bulk: BulkConfig{
+			MaxOperations: 1000,
+		},
+		Idempotency: IdempotencyConfig{
+			TTL: 24 * time.Hour,
+		},
+		GraphQL: GraphQLConfig{
+			MaxDepth:      10,
+			MaxComplexity: 5000,
+		},
+	}
+}
+
+// Load builds the configuration from, in increasing order of precedence:
+// built-in defaults, a YAML or TOML file named by -config or CONFIG_FILE,
+// a .env file in the working directory, the process environment and the
+// command-line flags in args.
+func Load(args []string) (*Config, error) {
+	return load(args, os.LookupEnv, ".env")
+}
+
+func load(args []string, lookupEnv func(string) (string, bool), dotenvPath string) (*Config, error) {
+	dotenv, err := readDotenv(dotenvPath)
+	if err != nil {
+		return nil, err
+	}
+	env := func(key string) (string, bool) {
+		if v, ok := lookupEnv(key); ok {
+			return v, true
+		}
+		v, ok := dotenv[key]
+		return v, ok
+	}
+
+	cfg := Default()
+
+	path, _ := env("CONFIG_FILE")
+	if p := configFlag(args); p != "" {
+		path = p
+	}
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	fs := flag.NewFlagSet("bookstore-app", flag.ContinueOnError)
+	fs.String("config", path, "path to a YAML or TOML configuration file")
+	bindings := cfg.bind(fs)
+	for _, b := range bindings {
+		v, ok := env(b.env)
+		if !ok || v == "" {
+			continue
+		}
+		if err := fs.Lookup(b.flag).Value.Set(v); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", b.env, err)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+type binding struct {
+	env  string
+	flag string
+}
+
+// bind registers a flag for every setting, bound directly to the field so
+// that values set through the FlagSet land in cfg.
+func (c *Config) bind(fs *flag.FlagSet) []binding {
+	var bindings []binding
+	str := func(p *string, env, name, usage string) {
+		fs.StringVar(p, name, *p, usage+" ($"+env+")")
+		bindings = append(bindings, binding{env, name})
+	}
+	num := func(p *int, env, name, usage string) {
+		fs.IntVar(p, name, *p, usage+" ($"+env+")")
+		bindings = append(bindings, binding{env, name})
+	}
+	dur := func(p *time.Duration, env, name, usage string) {
+		fs.DurationVar(p, name, *p, usage+" ($"+env+")")
+		bindings = append(bindings, binding{env, name})
+	}
+	boolean := func(p *bool, env, name, usage string) {
+		fs.BoolVar(p, name, *p, usage+" ($"+env+")")
+		bindings = append(bindings, binding{env, name})
+	}
+	list := func(p *[]string, env, name, usage string) {
+		fs.Var((*stringList)(p), name, usage+", comma separated ($"+env+")")
+		bindings = append(bindings, binding{env, name})
+	}
+
+	str(&c.Server.Addr, "HTTP_ADDR", "http-addr", "HTTP listen address")
+	dur(&c.Server.ReadTimeout, "HTTP_READ_TIMEOUT", "http-read-timeout", "maximum time to read a request")
+	dur(&c.Server.ReadHeaderTimeout, "HTTP_READ_HEADER_TIMEOUT", "http-read-header-timeout", "maximum time to read request headers")
+	dur(&c.Server.WriteTimeout, "HTTP_WRITE_TIMEOUT", "http-write-timeout", "maximum time to write a response")
+	dur(&c.Server.IdleTimeout, "HTTP_IDLE_TIMEOUT", "http-idle-timeout", "keep-alive idle timeout")
+	dur(&c.Server.ShutdownTimeout, "HTTP_SHUTDOWN_TIMEOUT", "http-shutdown-timeout", "grace period for in-flight requests on shutdown")
+	str(&c.Server.AdminToken, "ADMIN_TOKEN", "admin-token", "bearer token required by the /admin, /webhooks and /debug/vars endpoints")
+
+	str(&c.Database.Host, "DB_HOST", "db-host", "database host")
+	num(&c.Database.Port, "DB_PORT", "db-port", "database port")
+	str(&c.Database.User, "DB_USER", "db-user", "database user")
+	str(&c.Database.Password, "DB_PASSWORD", "db-password", "database password")
+	str(&c.Database.Name, "DB_NAME", "db-name", "database name")
+	str(&c.Database.SSLMode, "DB_SSLMODE", "db-sslmode", "Postgres sslmode")
+	str(&c.Database.SSLRootCert, "DB_SSLROOTCERT", "db-sslrootcert", "CA certificate used to verify the server")
+	str(&c.Database.SSLCert, "DB_SSLCERT", "db-sslcert", "client certificate for TLS authentication")
+	str(&c.Database.SSLKey, "DB_SSLKEY", "db-sslkey", "client private key for TLS authentication")
+	dur(&c.Database.ConnectTimeout, "DB_CONNECT_TIMEOUT", "db-connect-timeout", "timeout for a single connection attempt")
+	num(&c.Database.ConnectAttempts, "DB_CONNECT_ATTEMPTS", "db-connect-attempts", "connection attempts at startup before giving up")
+	dur(&c.Database.RetryBackoff, "DB_RETRY_BACKOFF", "db-retry-backoff", "delay before the first connection retry")
+	dur(&c.Database.RetryMaxBackoff, "DB_RETRY_MAX_BACKOFF", "db-retry-max-backoff", "upper bound for the delay between connection retries")
+	num(&c.Database.MaxOpenConns, "DB_MAX_OPEN_CONNS", "db-max-open-conns", "maximum open connections (0 is unlimited)")
+	num(&c.Database.MaxIdleConns, "DB_MAX_IDLE_CONNS", "db-max-idle-conns", "maximum idle connections")
+	dur(&c.Database.ConnMaxLifetime, "DB_CONN_MAX_LIFETIME", "db-conn-max-lifetime", "maximum connection lifetime (0 is unlimited)")
+	dur(&c.Database.ConnMaxIdleTime, "DB_CONN_MAX_IDLE_TIME", "db-conn-max-idle-time", "maximum connection idle time (0 is unlimited)")
+	list(&c.Database.Replicas, "DB_REPLICAS", "db-replicas", "read replica connection strings")
+	dur(&c.Database.ReplicaHealthInterval, "DB_REPLICA_HEALTH_INTERVAL", "db-replica-health-interval", "how often replicas are health checked")
+	dur(&c.Database.ReadYourWritesWindow, "DB_READ_YOUR_WRITES_WINDOW", "db-read-your-writes-window", "how long a client's reads stay on the primary after it writes")
+
+	str(&c.Log.Level, "LOG_LEVEL", "log-level", "log level: debug, info, warn or error")
+	str(&c.Log.Format, "LOG_FORMAT", "log-format", "log format: json or text")
+
+	str(&c.Tracing.Exporter, "OTEL_TRACES_EXPORTER", "trace-exporter", "trace exporter: none, otlp, stdout or file")
+	str(&c.Tracing.File, "OTEL_TRACES_FILE", "trace-file", "output path for the file trace exporter")
+	str(&c.Tracing.ServiceName, "OTEL_SERVICE_NAME", "trace-service-name", "service name on exported spans")
+
+	num(&c.Cache.Size, "CACHE_SIZE", "cache-size", "maximum number of cached books (0 disables the cache)")
+	dur(&c.Cache.TTL, "CACHE_TTL", "cache-ttl", "how long a cached book is served")
+
+	str(&c.ONIX.SenderName, "ONIX_SENDER_NAME", "onix-sender-name", "sender name in exported ONIX messages")
+	str(&c.ONIX.Currency, "ONIX_CURRENCY", "onix-currency", "ISO 4217 currency of book prices in ONIX")
+	str(&c.ONIX.FeedURL, "ONIX_FEED_URL", "onix-feed-url", "publisher ONIX feed to import periodically")
+	dur(&c.ONIX.FeedInterval, "ONIX_FEED_INTERVAL", "onix-feed-interval", "how often the ONIX feed is polled")
+
+	str(&c.Enrich.Provider, "ENRICH_PROVIDER", "enrich-provider", "book metadata source: none, openlibrary or googlebooks")
+	str(&c.Enrich.BaseURL, "ENRICH_BASE_URL", "enrich-base-url", "base URL replacing the metadata source's public API")
+	str(&c.Enrich.APIKey, "ENRICH_API_KEY", "enrich-api-key", "API key for the metadata source")
+	dur(&c.Enrich.Timeout, "ENRICH_TIMEOUT", "enrich-timeout", "timeout for a metadata lookup")
+	boolean(&c.Enrich.OnCreate, "ENRICH_ON_CREATE", "enrich-on-create", "fill blank fields of new books from the metadata source")
+	num(&c.Enrich.CacheSize, "ENRICH_CACHE_SIZE", "enrich-cache-size", "metadata lookups remembered (0 disables caching)")
+	dur(&c.Enrich.CacheTTL, "ENRICH_CACHE_TTL", "enrich-cache-ttl", "how long a metadata lookup is remembered")
+
+	str(&c.Covers.Dir, "COVERS_DIR", "covers-dir", "directory cover images are stored in (empty disables uploads)")
+	num(&c.Covers.MaxBytes, "COVERS_MAX_BYTES", "covers-max-bytes", "largest cover image upload in bytes")
+
+	str(&c.Outbox.Publisher, "OUTBOX_PUBLISHER", "outbox-publisher", "where book events are published: log, http or none")
+	str(&c.Outbox.URL, "OUTBOX_URL", "outbox-url", "URL the http publisher posts book events to")
+	dur(&c.Outbox.Interval, "OUTBOX_INTERVAL", "outbox-interval", "how often the event outbox is polled")
+	num(&c.Outbox.BatchSize, "OUTBOX_BATCH_SIZE", "outbox-batch-size", "most events published per poll")
+	dur(&c.Outbox.Lease, "OUTBOX_LEASE", "outbox-lease", "how long a relay holds the events it is publishing")
+	num(&c.Outbox.MaxAttempts, "OUTBOX_MAX_ATTEMPTS", "outbox-max-attempts", "attempts before an outbox event is dead")
+	dur(&c.Outbox.Retention, "OUTBOX_RETENTION", "outbox-retention", "how long published events are kept (0 keeps them)")
+
+	boolean(&c.Webhooks.Enabled, "WEBHOOKS_ENABLED", "webhooks-enabled", "deliver book events to webhook subscriptions")
+	dur(&c.Webhooks.Interval, "WEBHOOKS_INTERVAL", "webhooks-interval", "how often due webhook deliveries are looked for")
+	num(&c.Webhooks.BatchSize, "WEBHOOKS_BATCH_SIZE", "webhooks-batch-size", "webhook deliveries sent at once")
+	dur(&c.Webhooks.Timeout, "WEBHOOKS_TIMEOUT", "webhooks-timeout", "timeout for a webhook delivery attempt")
+	num(&c.Webhooks.MaxAttempts, "WEBHOOKS_MAX_ATTEMPTS", "webhooks-max-attempts", "attempts before a webhook delivery is dead")
+	dur(&c.Webhooks.RetryBackoff, "WEBHOOKS_RETRY_BACKOFF", "webhooks-retry-backoff", "wait after a first failed webhook delivery")
+	dur(&c.Webhooks.RetryMaxBackoff, "WEBHOOKS_RETRY_MAX_BACKOFF", "webhooks-retry-max-backoff", "longest wait between webhook delivery attempts")
+	dur(&c.Webhooks.Retention, "WEBHOOKS_RETENTION", "webhooks-retention", "how long successful webhook deliveries are logged (0 keeps them)")
+
+	num(&c.Stream.BufferSize, "STREAM_BUFFER_SIZE", "stream-buffer-size", "recent book events a reconnecting stream client can catch up on")
+	dur(&c.Stream.Heartbeat, "STREAM_HEARTBEAT", "stream-heartbeat", "how often an idle event stream sends a heartbeat")
+
+	num(&c.Bulk.MaxOperations, "BULK_MAX_OPERATIONS", "bulk-max-operations", "most operations a bulk request may carry")
+
+	dur(&c.Idempotency.TTL, "IDEMPOTENCY_TTL", "idempotency-ttl", "how long responses are kept for Idempotency-Key replays (0 disables)")
+
+	num(&c.GraphQL.MaxDepth, "GRAPHQL_MAX_DEPTH", "graphql-max-depth", "how deeply GraphQL selections may nest")
+	num(&c.GraphQL.MaxComplexity, "GRAPHQL_MAX_COMPLEXITY", "graphql-max-complexity", "most fields a GraphQL query may resolve")
+
+	str(&c.GRPC.Addr, "GRPC_ADDR", "grpc-addr", "gRPC listen address, such as localhost:9090 (empty disables)")
+	boolean(&c.GRPC.Reflection, "GRPC_REFLECTION", "grpc-reflection", "serve gRPC server reflection")
+
+	return bindings
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("parsing %s: %w", path, err)
+		}
+	case ".toml":
+		md, err := toml.Decode(string(data), c)
+		if err != nil {
+			return fmt.Errorf("parsing %s: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("parsing %s: unknown keys %v", path, undecoded)
+		}
+	default:
+		return fmt.Errorf("unsupported config file type %q", filepath.Ext(path))
+	}
+	return nil
+}
+
+// configFlag finds the -config flag before the full flag set is parsed, as
+// the file has to be loaded first for flags to override it.
+func configFlag(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name := strings.TrimLeft(arg, "-")
+		if name == arg {
+			continue
+		}
+		if v, ok := strings.CutPrefix(name, "config="); ok {
+			return v
+		}
+		if name == "config" && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+func readDotenv(path string) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	values, err := godotenv.Read(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return values, nil
+}
+
+var (
+	sslModes       = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+	logLevels      = []string{"debug", "info", "warn", "error"}
+	logFormats     = []string{"json", "text"}
+	traceExporters = []string{"none", "otlp", "stdout", "file"}
+	enrichSources  = []string{"none", "openlibrary", "googlebooks"}
+	outboxTargets  = []string{"none", "log", "http"}
+)
+
+// Validate reports every invalid setting at once.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Addr != "", "server address is required")
+	check(c.Server.ReadTimeout >= 0, "server read timeout must not be negative")
+	check(c.Server.ReadHeaderTimeout >= 0, "server read header timeout must not be negative")
+	check(c.Server.WriteTimeout >= 0, "server write timeout must not be negative")
+	check(c.Server.IdleTimeout >= 0, "server idle timeout must not be negative")
+	check(c.Server.ShutdownTimeout >= 0, "server shutdown timeout must not be negative")
+	for route := range c.Server.CacheControl {
+		check(strings.HasPrefix(route, "/"), "cache control route %q must start with /", route)
+	}
+
+	db := c.Database
+	check(db.Host != "", "database host is required (DB_HOST)")
+	check(db.Port > 0 && db.Port < 65536, "database port %d is out of range", db.Port)
+	check(db.User != "", "database user is required (DB_USER)")
+	check(db.Password != "", "database password is required (DB_PASSWORD)")
+	check(db.Name != "", "database name is required (DB_NAME)")
+	check(oneOf(db.SSLMode, sslModes), "database sslmode %q must be one of %v", db.SSLMode, sslModes)
+	check((db.SSLCert == "") == (db.SSLKey == ""), "database sslcert and sslkey must be set together")
+	check(db.SSLMode != "disable" || (db.SSLRootCert == "" && db.SSLCert == ""),
+		"database TLS certificates are set but sslmode is disable")
+	check(db.ConnectTimeout >= 0, "database connect timeout must not be negative")
+	check(db.ConnectAttempts > 0, "database connect attempts must be at least 1")
+	check(db.RetryBackoff > 0, "database retry backoff must be positive")
+	check(db.RetryMaxBackoff >= db.RetryBackoff, "database retry max backoff must not be less than retry backoff")
+	check(db.MaxOpenConns >= 0, "database max open connections must not be negative")
+	check(db.MaxIdleConns >= 0, "database max idle connections must not be negative")
+	check(db.MaxOpenConns == 0 || db.MaxIdleConns <= db.MaxOpenConns,
+		"database max idle connections (%d) exceeds max open connections (%d)", db.MaxIdleConns, db.MaxOpenConns)
+	check(db.ConnMaxLifetime >= 0, "database connection lifetime must not be negative")
+	check(db.ConnMaxIdleTime >= 0, "database connection idle time must not be negative")
+	for i, replica := range db.Replicas {
+		check(strings.TrimSpace(replica) != "", "database replica %d is empty", i+1)
+	}
+	check(db.ReplicaHealthInterval > 0, "database replica health interval must be positive")
+	check(db.ReadYourWritesWindow >= 0, "database read-your-writes window must not be negative")
+
+	check(oneOf(strings.ToLower(c.Log.Level), logLevels), "log level %q must be one of %v", c.Log.Level, logLevels)
+	check(oneOf(strings.ToLower(c.Log.Format), logFormats), "log format %q must be one of %v", c.Log.Format, logFormats)
+
+	check(oneOf(c.Tracing.Exporter, traceExporters), "trace exporter %q must be one of %v", c.Tracing.Exporter, traceExporters)
+	check(c.Tracing.Exporter != "file" || c.Tracing.File != "", "trace file is required for the file exporter")
+
+	check(c.Cache.Size >= 0, "cache size must not be negative")
+	check(c.Cache.TTL > 0, "cache TTL must be positive")
+
+	check(c.ONIX.SenderName != "", "ONIX sender name is required")
+	check(len(c.ONIX.Currency) == 3, "ONIX currency %q must be a three-letter ISO 4217 code", c.ONIX.Currency)
+	if c.ONIX.FeedURL != "" {
+		u, err := url.Parse(c.ONIX.FeedURL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"ONIX feed URL %q must be an http or https URL", c.ONIX.FeedURL)
+	}
+	check(c.ONIX.FeedInterval > 0, "ONIX feed interval must be positive")
+
+	check(oneOf(c.Enrich.Provider, enrichSources), "enrichment provider %q must be one of %v", c.Enrich.Provider, enrichSources)
+	if c.Enrich.BaseURL != "" {
+		u, err := url.Parse(c.Enrich.BaseURL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"enrichment base URL %q must be an http or https URL", c.Enrich.BaseURL)
+	}
+	check(c.Enrich.Timeout > 0, "enrichment timeout must be positive")
+	check(c.Enrich.CacheSize >= 0, "enrichment cache size must not be negative")
+	check(c.Enrich.CacheTTL > 0, "enrichment cache TTL must be positive")
+
+	check(c.Covers.MaxBytes > 0, "cover max bytes must be positive")
+
+	check(oneOf(c.Outbox.Publisher, outboxTargets), "outbox publisher %q must be one of %v", c.Outbox.Publisher, outboxTargets)
+	if c.Outbox.Publisher == "http" {
+		u, err := url.Parse(c.Outbox.URL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"outbox URL %q must be an http or https URL", c.Outbox.URL)
+	}
+	check(c.Outbox.Interval > 0, "outbox interval must be positive")
+	check(c.Outbox.BatchSize > 0, "outbox batch size must be positive")
+	check(c.Outbox.Lease > 0, "outbox lease must be positive")
+	check(c.Outbox.MaxAttempts > 0, "outbox max attempts must be positive")
+	check(c.Outbox.Retention >= 0, "outbox retention must not be negative")
+
+	check(c.Webhooks.Interval > 0, "webhook interval must be positive")
+	check(c.Webhooks.BatchSize > 0, "webhook batch size must be positive")
+	check(c.Webhooks.Timeout > 0, "webhook timeout must be positive")
+	check(c.Webhooks.MaxAttempts > 0, "webhook max attempts must be positive")
+	check(c.Webhooks.RetryBackoff > 0, "webhook retry backoff must be positive")
+	check(c.Webhooks.RetryMaxBackoff >= c.Webhooks.RetryBackoff,
+		"webhook retry max backoff (%s) is less than retry backoff (%s)", c.Webhooks.RetryMaxBackoff, c.Webhooks.RetryBackoff)
+	check(c.Webhooks.Retention >= 0, "webhook retention must not be negative")
+
+	check(c.Stream.BufferSize >= 0, "stream buffer size must not be negative")
+	check(c.Stream.Heartbeat > 0, "stream heartbeat must be positive")
+
+	check(c.Bulk.MaxOperations > 0, "bulk max operations must be positive")
+
+	check(c.Idempotency.TTL >= 0, "idempotency TTL must not be negative")
+
+	check(c.GraphQL.MaxDepth > 0, "graphql max depth must be positive")
+	check(c.GraphQL.MaxComplexity > 0, "graphql max complexity must be positive")
+
+	check(c.GRPC.Addr == "" || c.GRPC.Addr != c.Server.Addr, "grpc address must differ from the server address")
+
+	return errors.Join(errs...)
+}
+
+func oneOf(v string, allowed []string) bool {
+	for _, a := range allowed {
+		if v == a {
+			return true
+		}
+	}
+	return false
+}
+
+// LogValue renders the configuration for logging with secrets redacted.
+func (c Config) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Group("server",
+			slog.String("addr", c.Server.Addr),
+			slog.Duration("read_timeout", c.Server.ReadTimeout),
+			slog.Duration("read_header_timeout", c.Server.ReadHeaderTimeout),
+			slog.Duration("write_timeout", c.Server.WriteTimeout),
+			slog.Duration("idle_timeout", c.Server.IdleTimeout),
+			slog.Duration("shutdown_timeout", c.Server.ShutdownTimeout),
+			slog.Any("cache_control", c.Server.CacheControl),
+			slog.String("admin_token", redactSecret(c.Server.AdminToken)),
+		),
+		slog.Any("database", c.Database),
+		slog.Group("log",
+			slog.String("level", c.Log.Level),
+			slog.String("format", c.Log.Format),
+		),
+		slog.Group("tracing",
+			slog.String("exporter", c.Tracing.Exporter),
+			slog.String("file", c.Tracing.File),
+			slog.String("service_name", c.Tracing.ServiceName),
+		),
+		slog.Group("cache",
+			slog.Int("size", c.Cache.Size),
+			slog.Duration("ttl", c.Cache.TTL),
+		),
+		slog.Group("onix",
+			slog.String("sender_name", c.ONIX.SenderName),
+			slog.String("currency", c.ONIX.Currency),
+			slog.String("feed_url", redactURL(c.ONIX.FeedURL)),
+			slog.Duration("feed_interval", c.ONIX.FeedInterval),
+		),
+		slog.Group("enrich",
+			slog.String("provider", c.Enrich.Provider),
+			slog.String("base_url", redactURL(c.Enrich.BaseURL)),
+			slog.String("api_key", redactSecret(c.Enrich.APIKey)),
+			slog.Duration("timeout", c.Enrich.Timeout),
+			slog.Bool("on_create", c.Enrich.OnCreate),
+			slog.Int("cache_size", c.Enrich.CacheSize),
+			slog.Duration("cache_ttl", c.Enrich.CacheTTL),
+		),
+		slog.Group("covers",
+			slog.String("dir", c.Covers.Dir),
+			slog.Int("max_bytes", c.Covers.MaxBytes),
+		),
+		slog.Group("outbox",
+			slog.String("publisher", c.Outbox.Publisher),
+			slog.String("url", redactURL(c.Outbox.URL)),
+			slog.Duration("interval", c.Outbox.Interval),
+			slog.Int("batch_size", c.Outbox.BatchSize),
+			slog.Duration("lease", c.Outbox.Lease),
+			slog.Int("max_attempts", c.Outbox.MaxAttempts),
+			slog.Duration("retention", c.Outbox.Retention),
+		),
+		slog.Group("webhooks",
+			slog.Bool("enabled", c.Webhooks.Enabled),
+			slog.Duration("interval", c.Webhooks.Interval),
+			slog.Int("batch_size", c.Webhooks.BatchSize),
+			slog.Duration("timeout", c.Webhooks.Timeout),
+			slog.Int("max_attempts", c.Webhooks.MaxAttempts),
+			slog.Duration("retry_backoff", c.Webhooks.RetryBackoff),
+			slog.Duration("retry_max_backoff", c.Webhooks.RetryMaxBackoff),
+			slog.Duration("retention", c.Webhooks.Retention),
+		),
+		slog.Group("stream",
+			slog.Int("buffer_size", c.Stream.BufferSize),
+			slog.Duration("heartbeat", c.Stream.Heartbeat),
+		),
+		slog.Group("bulk",
+			slog.Int("max_operations", c.Bulk.MaxOperations),
+		),
+		slog.Group("idempotency",
+			slog.Duration("ttl", c.Idempotency.TTL),
+		),
+		slog.Group("graphql",
+			slog.Int("max_depth", c.GraphQL.MaxDepth),
+			slog.Int("max_complexity", c.GraphQL.MaxComplexity),
+		),
+		slog.Group("grpc",
+			slog.String("addr", c.GRPC.Addr),
+			slog.Bool("reflection", c.GRPC.Reflection),
+		),
+	)
+}
+
+// redactSecret hides a secret while showing whether it is set.
+func redactSecret(s string) string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+// redactURL hides the password in a URL's user info.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	return u.Redacted()
+}
+
+// LogValue renders the database settings with the password redacted.
+func (d DatabaseConfig) LogValue() slog.Value {
+	password := ""
+	if d.Password != "" {
+		password = redacted
+	}
+	return slog.GroupValue(
+		slog.String("host", d.Host),
+		slog.Int("port", d.Port),
+		slog.String("user", d.User),
+		slog.String("password", password),
+		slog.String("name", d.Name),
+		slog.String("sslmode", d.SSLMode),
+		slog.String("sslrootcert", d.SSLRootCert),
+		slog.String("sslcert", d.SSLCert),
+		slog.String("sslkey", d.SSLKey),
+		slog.Duration("connect_timeout", d.ConnectTimeout),
+		slog.Int("connect_attempts", d.ConnectAttempts),
+		slog.Duration("retry_backoff", d.RetryBackoff),
+		slog.Duration("retry_max_backoff", d.RetryMaxBackoff),
+		slog.Int("max_open_conns", d.MaxOpenConns),
+		slog.Int("max_idle_conns", d.MaxIdleConns),
+		slog.Duration("conn_max_lifetime", d.ConnMaxLifetime),
+		slog.Duration("conn_max_idle_time", d.ConnMaxIdleTime),
+		slog.Any("replicas", redactDSNs(d.Replicas)),
+		slog.Duration("replica_health_interval", d.ReplicaHealthInterval),
+		slog.Duration("read_your_writes_window", d.ReadYourWritesWindow),
+	)
+}
+
+// String implements fmt.Stringer without exposing the password.
+func (d DatabaseConfig) String() string {
+	return fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=%s",
+		d.User, redacted, d.Host, d.Port, d.Name, d.SSLMode)
+}
+
+// DSN returns the lib/pq connection string.
+func (d DatabaseConfig) DSN() string {
+	params := []string{
+		"host=" + quoteDSN(d.Host),
+		"port=" + strconv.Itoa(d.Port),
+		"user=" + quoteDSN(d.User),
+		"password=" + quoteDSN(d.Password),
+		"dbname=" + quoteDSN(d.Name),
+		"sslmode=" + quoteDSN(d.SSLMode),
+	}
+	if d.SSLRootCert != "" {
+		params = append(params, "sslrootcert="+quoteDSN(d.SSLRootCert))
+	}
+	if d.SSLCert != "" {
+		params = append(params, "sslcert="+quoteDSN(d.SSLCert), "sslkey="+quoteDSN(d.SSLKey))
+	}
+	if d.ConnectTimeout > 0 {
+		// lib/pq takes whole seconds; round up so sub-second values still apply.
+		seconds := int((d.ConnectTimeout + time.Second - 1) / time.Second)
+		params = append(params, "connect_timeout="+strconv.Itoa(seconds))
+	}
+	return strings.Join(params, " ")
+}
+
+// RedactDSN hides the password in a URL or keyword/value connection string.
+func RedactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+		}
+		return u.String()
+	}
+	return dsnPassword.ReplaceAllString(dsn, "${1}"+redacted)
+}
+
+var dsnPassword = regexp.MustCompile(`(password\s*=\s*)('(?:[^'\\]|\\.)*'|\S+)`)
+
+func redactDSNs(dsns []string) []string {
+	out := make([]string, len(dsns))
+	for i, dsn := range dsns {
+		out[i] = RedactDSN(dsn)
+	}
+	return out
+}
+
+// stringList is a flag.Value holding a comma separated list.
+type stringList []string
+
+func (l *stringList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(redactDSNs(*l), ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = nil
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// quoteDSN quotes a keyword/value connection string value when needed.
+func quoteDSN(v string) string {
+	if v != "" && !strings.ContainsAny(v, ` '\`) {
+		return v
+	}
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `'`, `\'`)
+	return "'" + v + "'"
+}
@@ -0,0 +1,210 @@
+package config
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func envMap(values map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := values[key]
+		return v, ok
+	}
+}
+
+func requiredEnv() map[string]string {
+	return map[string]string{
+		"DB_HOST":     "localhost",
+		"DB_USER":     "bookstore_user",
+		"DB_PASSWORD": "bookstore_pass",
+		"DB_NAME":     "bookstore",
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := load(nil, envMap(requiredEnv()), "")
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if cfg.Server.Addr != ":8080" {
+		t.Errorf("wrong default address: got %v want %v", cfg.Server.Addr, ":8080")
+	}
+	if cfg.Database.Port != 5432 || cfg.Database.SSLMode != "disable" {
+		t.Errorf("wrong database defaults: %+v", cfg.Database)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := writeFile(t, "bookstore.yaml", `
+server:
+  addr: ":9000"
+  write_timeout: 45s
+database:
+  host: file-host
+  port: 6543
+  name: file-db
+log:
+  level: debug
+`)
+	dotenv := writeFile(t, ".env", "DB_NAME=dotenv-db\nDB_PORT=7000\nLOG_LEVEL=warn\n")
+
+	env := requiredEnv()
+	delete(env, "DB_HOST")
+	delete(env, "DB_NAME")
+	env["CONFIG_FILE"] = file
+	env["DB_PORT"] = "7543"
+	env["ENRICH_ON_CREATE"] = "true"
+
+	cfg, err := load([]string{"-log-level", "error"}, envMap(env), dotenv)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+
+	checks := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"file overrides default", cfg.Server.Addr, ":9000"},
+		{"file duration", cfg.Server.WriteTimeout, 45 * time.Second},
+		{"untouched default", cfg.Server.ReadTimeout, 15 * time.Second},
+		{"file value without overrides", cfg.Database.Host, "file-host"},
+		{".env overrides file", cfg.Database.Name, "dotenv-db"},
+		{"environment overrides .env", cfg.Database.Port, 7543},
+		{"flag overrides environment", cfg.Log.Level, "error"},
+		{"boolean from environment", cfg.Enrich.OnCreate, true},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("%s: got %v want %v", c.name, c.got, c.want)
+		}
+	}
+}
+
+func TestLoadConfigFlagAndTOML(t *testing.T) {
+	file := writeFile(t, "bookstore.toml", `
+[server]
+addr = ":7070"
+
+[database]
+sslmode = "require"
+max_open_conns = 50
+conn_max_lifetime = "1h"
+`)
+
+	cfg, err := load([]string{"--config=" + file, "-db-max-idle-conns", "10"}, envMap(requiredEnv()), "")
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if cfg.Server.Addr != ":7070" {
+		t.Errorf("wrong address: got %v want %v", cfg.Server.Addr, ":7070")
+	}
+	if cfg.Database.SSLMode != "require" || cfg.Database.MaxOpenConns != 50 || cfg.Database.MaxIdleConns != 10 {
+		t.Errorf("wrong database settings: %+v", cfg.Database)
+	}
+	if cfg.Database.ConnMaxLifetime != time.Hour {
+		t.Errorf("wrong lifetime: got %v want %v", cfg.Database.ConnMaxLifetime, time.Hour)
+	}
+}
+
+func TestLoadCacheControlMergesDefaults(t *testing.T) {
+	file := writeFile(t, "bookstore.yaml", `
+server:
+  cache_control:
+    /books: "public, max-age=30"
+`)
+	cfg, err := load([]string{"-config", file}, envMap(requiredEnv()), "")
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if got := cfg.Server.CacheControl["/books"]; got != "public, max-age=30" {
+		t.Errorf("wrong /books policy: got %v want %v", got, "public, max-age=30")
+	}
+	if got := cfg.Server.CacheControl["/book/:bookId"]; got != "no-cache" {
+		t.Errorf("default policy lost: got %v want %v", got, "no-cache")
+	}
+
+	file = writeFile(t, "bad.yaml", "server:\n  cache_control:\n    books: no-store\n")
+	if _, err := load([]string{"-config", file}, envMap(requiredEnv()), ""); err == nil {
+		t.Error("expected error for route without leading slash")
+	}
+}
+
+func TestLoadRejectsUnknownFileKeys(t *testing.T) {
+	file := writeFile(t, "bookstore.yaml", "database:\n  hots: typo\n")
+	if _, err := load([]string{"-config", file}, envMap(requiredEnv()), ""); err == nil {
+		t.Error("expected error for unknown key")
+	}
+}
+
+func TestLoadInvalidEnvironment(t *testing.T) {
+	env := requiredEnv()
+	env["DB_PORT"] = "five"
+	if _, err := load(nil, envMap(env), ""); err == nil || !strings.Contains(err.Error(), "DB_PORT") {
+		t.Errorf("expected DB_PORT error, got %v", err)
+	}
+}
+
+func TestValidateReportsAllErrors(t *testing.T) {
+	cfg := Default()
+	cfg.Database.SSLMode = "sometimes"
+	cfg.Database.MaxIdleConns = 100
+	cfg.Log.Format = "xml"
+	cfg.Outbox.Publisher = "http"
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, want := range []string{"DB_HOST", "DB_PASSWORD", "sslmode", "max idle", "log format", "outbox URL"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("validation error missing %q: %v", want, err)
+		}
+	}
+}
+
+func TestSecretsRedacted(t *testing.T) {
+	env := requiredEnv()
+	env["ENRICH_API_KEY"] = "enrich-secret"
+	env["ADMIN_TOKEN"] = "admin-secret"
+	cfg, err := load(nil, envMap(env), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	slog.New(slog.NewJSONHandler(&buf, nil)).Info("configuration loaded", "config", cfg)
+	if strings.Contains(buf.String(), "bookstore_pass") {
+		t.Errorf("password leaked into log output: %s", buf.String())
+	}
+	if strings.Contains(buf.String(), "enrich-secret") {
+		t.Errorf("enrichment API key leaked into log output: %s", buf.String())
+	}
+	if strings.Contains(buf.String(), "admin-secret") {
+		t.Errorf("admin token leaked into log output: %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), redacted) {
+		t.Errorf("password should be shown as %s: %s", redacted, buf.String())
+	}
+
+	if s := cfg.Database.String(); strings.Contains(s, "bookstore_pass") {
+		t.Errorf("password leaked through String: %s", s)
+	}
+	if dsn := cfg.Database.DSN(); !strings.Contains(dsn, "password=bookstore_pass") {
+		t.Errorf("DSN should contain the real password: %s", dsn)
+	}
+}
@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/adedaryorh/bookstore-app/pkg/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// GetBookHistory lists a book's audit entries, newest first, paged with
+// limit and offset. The history of a deleted book is still available.
+func GetBookHistory(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	bookId, err := strconv.ParseUint(ps.ByName("bookId"), 10, 32)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid book ID")
+		return
+	}
+	f := models.AuditFilter{BookID: uint(bookId)}
+	if f.Limit, f.Offset, err = parsePage(r); err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	entries, err := models.SearchAudit(r.Context(), f)
+	if err != nil {
+		writeModelError(w, r, err, "Failed to fetch history")
+		return
+	}
+	if len(entries) == 0 && f.Offset == 0 {
+		// Books from before the audit trail have no entries until they
+		// change; anything else doesn't exist.
+		if _, err := models.GetBookByID(r.Context(), uint(bookId)); err != nil {
+			writeModelError(w, r, err, "Failed to fetch history")
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(append([]models.AuditEntry{}, entries...))
+}
+
+// getBookAsOf serves GET /book/:bookId?as_of=, the book as it was at an
+// RFC 3339 timestamp.
+func getBookAsOf(w http.ResponseWriter, r *http.Request, bookId uint, asOf string) {
+	t, err := time.Parse(time.RFC3339, asOf)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid as_of, want an RFC 3339 timestamp")
+		return
+	}
+	book, err := models.BookAsOf(r.Context(), bookId, t)
+	if err != nil {
+		writeModelError(w, r, err, "Failed to fetch book")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(book)
+}
+
+// RevertBook restores the fields a book had at a revision from its history,
+// recorded as a new update, and returns the book.
+func RevertBook(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	bookId, err := strconv.ParseUint(ps.ByName("bookId"), 10, 32)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid book ID")
+		return
+	}
+	revision, err := strconv.Atoi(ps.ByName("revision"))
+	if err != nil || revision < 1 {
+		writeError(w, r, http.StatusBadRequest, "Invalid revision")
+		return
+	}
+	book, err := models.RevertBook(r.Context(), uint(bookId), revision)
+	if err != nil {
+		writeModelError(w, r, err, "Failed to revert book")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(book)
+}
+
+// SearchAudit lists audit entries across the catalog, newest first. They
+// can be narrowed by book_id, actor, action, request_id, field (entries
+// that changed it) and an RFC 3339 since/until range, and paged with limit
+// and offset.
+func SearchAudit(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	q := r.URL.Query()
+	f := models.AuditFilter{
+		Actor:     q.Get("actor"),
+		Action:    q.Get("action"),
+		RequestID: q.Get("request_id"),
+		Field:     q.Get("field"),
+	}
+	var err error
+	if v := q.Get("book_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "Invalid book_id")
+			return
+		}
+		f.BookID = uint(id)
+	}
+	switch f.Action {
+	case "", models.AuditCreated, models.AuditUpdated, models.AuditDeleted:
+	default:
+		writeError(w, r, http.StatusBadRequest, "Invalid action, want created, updated or deleted")
+		return
+	}
+	for name, t := range map[string]*time.Time{"since": &f.Since, "until": &f.Until} {
+		if v := q.Get(name); v != "" {
+			if *t, err = time.Parse(time.RFC3339, v); err != nil {
+				writeError(w, r, http.StatusBadRequest, "Invalid "+name+", want an RFC 3339 timestamp")
+				return
+			}
+		}
+	}
+	if f.Limit, f.Offset, err = parsePage(r); err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	entries, err := models.SearchAudit(r.Context(), f)
+	if err != nil {
+		writeModelError(w, r, err, "Failed to search audit trail")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(append([]models.AuditEntry{}, entries...))
+}
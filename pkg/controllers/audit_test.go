@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/adedaryorh/bookstore-app/pkg/logging"
+	"github.com/adedaryorh/bookstore-app/pkg/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestBookHistory(t *testing.T) {
+	ctx := logging.WithRequestID(logging.WithClaimedCaller(context.Background(), "alice"), "req-audit-1")
+	price := 30.0
+	book := &models.Book{Title: "Audited", Author: "Author", ISBN: "9781234567958", Price: &price}
+	book.CreateBook(ctx)
+	price = 25.0
+	book.UpdateBook(ctx)
+	models.DeleteBook(context.Background(), book.ID)
+
+	router := httprouter.New()
+	router.GET("/book/:bookId/history", GetBookHistory)
+	router.GET("/admin/audit", SearchAudit)
+	get := func(path string) (int, []models.AuditEntry) {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		var entries []models.AuditEntry
+		json.Unmarshal(rr.Body.Bytes(), &entries)
+		return rr.Code, entries
+	}
+
+	id := strconv.Itoa(int(book.ID))
+	code, entries := get("/book/" + id + "/history")
+	if code != http.StatusOK || len(entries) != 3 {
+		t.Fatalf("got %v with %d entries want %v with 3", code, len(entries), http.StatusOK)
+	}
+	for i, want := range []string{models.AuditDeleted, models.AuditUpdated, models.AuditCreated} {
+		if entries[i].Action != want || entries[i].Revision != 3-i {
+			t.Errorf("entry %d: got %s revision %d want %s revision %d", i, entries[i].Action, entries[i].Revision, want, 3-i)
+		}
+	}
+	update := entries[1]
+	if update.Actor != "alice" || update.ActorVerified || update.RequestID != "req-audit-1" {
+		t.Errorf("wrong actor or request ID: %+v", update)
+	}
+	if c := update.Changes["price"]; len(update.Changes) != 1 || c.Old != 30.0 || c.New != 25.0 {
+		t.Errorf("wrong changes: %+v", update.Changes)
+	}
+	if entries[0].Actor != "system" || !entries[0].ActorVerified || entries[0].Changes["title"].Old != "Audited" {
+		t.Errorf("wrong delete entry: %+v", entries[0])
+	}
+
+	if _, entries := get("/admin/audit?field=price&actor=alice&book_id=" + id); len(entries) != 2 {
+		t.Errorf("search by field: got %d entries want 2", len(entries))
+	}
+	if code, _ := get("/book/999999/history"); code != http.StatusNotFound {
+		t.Errorf("unknown book: got %v want %v", code, http.StatusNotFound)
+	}
+	if code, _ := get("/admin/audit?since=yesterday"); code != http.StatusBadRequest {
+		t.Errorf("invalid since: got %v want %v", code, http.StatusBadRequest)
+	}
+}
+
+func TestBookRevisions(t *testing.T) {
+	book := &models.Book{Title: "First edition", Author: "Author", ISBN: "9781234567965"}
+	book.CreateBook(context.Background())
+	defer models.DeleteBook(context.Background(), book.ID)
+	asOf := time.Now().UTC().Format(time.RFC3339Nano)
+	time.Sleep(10 * time.Millisecond)
+	book.Title = "Bulk edited"
+	book.UpdateBook(context.Background())
+
+	router := httprouter.New()
+	router.GET("/book/:bookId", GetBookByID)
+	router.POST("/book/:bookId/revert/:revision", RevertBook)
+	do := func(method, path string) (int, models.Book) {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(method, path, nil))
+		var got models.Book
+		json.Unmarshal(rr.Body.Bytes(), &got)
+		return rr.Code, got
+	}
+
+	id := strconv.Itoa(int(book.ID))
+	if code, got := do(http.MethodGet, "/book/"+id+"?as_of="+asOf); code != http.StatusOK || got.Title != "First edition" {
+		t.Errorf("as_of: got %v %q want %v %q", code, got.Title, http.StatusOK, "First edition")
+	}
+	if code, _ := do(http.MethodGet, "/book/"+id+"?as_of=2000-01-01T00:00:00Z"); code != http.StatusNotFound {
+		t.Errorf("as_of before creation: got %v want %v", code, http.StatusNotFound)
+	}
+
+	if code, got := do(http.MethodPost, "/book/"+id+"/revert/1"); code != http.StatusOK || got.Title != "First edition" {
+		t.Fatalf("revert: got %v %q want %v %q", code, got.Title, http.StatusOK, "First edition")
+	}
+	if got, _ := models.GetBookByID(models.UsePrimary(context.Background()), book.ID); got.Title != "First edition" {
+		t.Errorf("revert not saved: got %q", got.Title)
+	}
+	history, _ := models.SearchAudit(context.Background(), models.AuditFilter{BookID: book.ID})
+	if len(history) != 3 || history[0].Action != models.AuditUpdated || history[0].Changes["title"].New != "First edition" {
+		t.Errorf("revert should be recorded as an update: %+v", history)
+	}
+	if code, _ := do(http.MethodPost, "/book/"+id+"/revert/9"); code != http.StatusNotFound {
+		t.Errorf("unknown revision: got %v want %v", code, http.StatusNotFound)
+	}
+}
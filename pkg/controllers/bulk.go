@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/adedaryorh/bookstore-app/pkg/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// Bulk modes.
+const (
+	bulkAtomic     = "atomic"
+	bulkBestEffort = "best_effort"
+)
+
+// maxBulkOps caps the operations in one bulk request.
+var maxBulkOps = 1000
+
+// UseBulk sets the largest number of operations a bulk request may carry.
+func UseBulk(maxOps int) {
+	maxBulkOps = maxOps
+}
+
+// bulkResult is the outcome of one operation, with the status the
+// equivalent single request would have answered.
+type bulkResult struct {
+	Index  int          `json:"index"`
+	Op     string       `json:"op"`
+	Status int          `json:"status"`
+	Book   *models.Book `json:"book,omitempty"`
+	Error  string       `json:"error,omitempty"`
+}
+
+type bulkResponse struct {
+	Mode    string       `json:"mode"`
+	Applied int          `json:"applied"`
+	Failed  int          `json:"failed"`
+	Results []bulkResult `json:"results"`
+}
+
+// BulkBooks applies a JSON array of create, update and delete operations.
+// In the default atomic mode they commit together or not at all, and the
+// response takes the status of the operation that failed. With
+// mode=best_effort each one commits on its own and the response is 200
+// whatever the outcome of the individual operations, which is in their
+// results.
+func BulkBooks(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	mode := r.URL.Query().Get("mode")
+	switch mode {
+	case "":
+		mode = bulkAtomic
+	case bulkAtomic, bulkBestEffort:
+	default:
+		writeError(w, r, http.StatusBadRequest, "Invalid mode, want atomic or best_effort")
+		return
+	}
+	var ops []models.BulkOp
+	if err := json.NewDecoder(r.Body).Decode(&ops); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid JSON format, want an array of operations")
+		return
+	}
+	if len(ops) == 0 {
+		writeError(w, r, http.StatusBadRequest, "No operations")
+		return
+	}
+	if len(ops) > maxBulkOps {
+		writeError(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("Too many operations, at most %d are allowed", maxBulkOps))
+		return
+	}
+
+	resp := bulkResponse{Mode: mode, Results: make([]bulkResult, len(ops))}
+	var valid []models.BulkOp
+	var index []int
+	for i, op := range ops {
+		resp.Results[i] = bulkResult{Index: i, Op: op.Op}
+		if err := op.Check(); err != nil {
+			resp.Results[i].Status = http.StatusBadRequest
+			resp.Results[i].Error = strings.ReplaceAll(err.Error(), "\n", "; ")
+			continue
+		}
+		valid = append(valid, op)
+		index = append(index, i)
+	}
+	status := http.StatusOK
+	if mode == bulkAtomic && len(valid) < len(ops) {
+		// Nothing is applied if any operation is invalid.
+		status = http.StatusBadRequest
+		for i := range resp.Results {
+			if resp.Results[i].Status == 0 {
+				resp.Results[i].Status = http.StatusFailedDependency
+				resp.Results[i].Error = models.ErrBulkAborted.Error()
+			}
+		}
+		valid = nil
+	}
+
+	var results []models.BulkResult
+	if len(valid) > 0 {
+		results = models.ApplyBulk(r.Context(), valid, mode == bulkAtomic)
+	}
+	for j, res := range results {
+		out := &resp.Results[index[j]]
+		switch {
+		case errors.Is(res.Err, models.ErrBulkAborted):
+			out.Status, out.Error = http.StatusFailedDependency, res.Err.Error()
+		case res.Err != nil:
+			out.Status, out.Error = modelErrorStatus(r.Context(), res.Err, "Failed to apply operation")
+			if mode == bulkAtomic {
+				status = out.Status
+			}
+		default:
+			out.Status, out.Book = http.StatusOK, res.Book
+			switch out.Op {
+			case models.BulkCreate:
+				out.Status = http.StatusCreated
+			case models.BulkDelete:
+				removeCover(r.Context(), res.Book.ID)
+			}
+		}
+	}
+	for _, res := range resp.Results {
+		if res.Error == "" {
+			resp.Applied++
+		} else {
+			resp.Failed++
+		}
+	}
+
+	if status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", "5")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
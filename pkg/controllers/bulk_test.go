@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/adedaryorh/bookstore-app/pkg/models"
+)
+
+func TestBulkBooks(t *testing.T) {
+	existing := &models.Book{Title: "Bulk target", Author: "Author", ISBN: "9781234567972"}
+	existing.CreateBook(context.Background())
+	defer models.DeleteBook(context.Background(), existing.ID)
+
+	post := func(query, body string) (int, bulkResponse) {
+		rr := httptest.NewRecorder()
+		BulkBooks(rr, httptest.NewRequest(http.MethodPost, "/books/bulk"+query, strings.NewReader(body)), nil)
+		var resp bulkResponse
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		for _, res := range resp.Results {
+			if res.Op == models.BulkCreate && res.Book != nil {
+				t.Cleanup(func() { models.DeleteBook(context.Background(), res.Book.ID) })
+			}
+		}
+		return rr.Code, resp
+	}
+
+	// A missing book fails the batch, so the create before it is undone.
+	code, resp := post("", fmt.Sprintf(`[
+		{"op": "create", "book": {"title": "Bulk new", "author": "Author"}},
+		{"op": "update", "id": %d, "book": {"title": "Bulk renamed", "author": "Author"}},
+		{"op": "delete", "id": 999999}]`, existing.ID))
+	if code != http.StatusNotFound || resp.Applied != 0 || resp.Failed != 3 {
+		t.Fatalf("atomic failure: got %v %+v", code, resp)
+	}
+	if resp.Results[0].Status != http.StatusFailedDependency || resp.Results[2].Status != http.StatusNotFound {
+		t.Errorf("wrong results: %+v", resp.Results)
+	}
+	if got, _ := models.GetBookByID(models.UsePrimary(context.Background()), existing.ID); got.Title != "Bulk target" {
+		t.Errorf("rolled back update was saved: %q", got.Title)
+	}
+
+	// Best effort applies what it can.
+	code, resp = post("?mode=best_effort", fmt.Sprintf(`[
+		{"op": "create", "book": {"title": "Bulk new", "author": "Author"}},
+		{"op": "update", "id": %d, "book": {"title": "Bulk renamed", "author": "Author", "isbn": "9781234567972"}},
+		{"op": "delete", "id": 999999},
+		{"op": "create", "book": {"author": "Author"}}]`, existing.ID))
+	if code != http.StatusOK || resp.Applied != 2 || resp.Failed != 2 {
+		t.Fatalf("best effort: got %v %+v", code, resp)
+	}
+	for i, want := range []int{http.StatusCreated, http.StatusOK, http.StatusNotFound, http.StatusBadRequest} {
+		if resp.Results[i].Status != want {
+			t.Errorf("result %d: got status %v want %v", i, resp.Results[i].Status, want)
+		}
+	}
+	got, _ := models.GetBookByID(models.UsePrimary(context.Background()), existing.ID)
+	if got.Title != "Bulk renamed" || !got.CreatedAt.Equal(existing.CreatedAt) {
+		t.Errorf("update not saved as expected: %+v", got)
+	}
+
+	UseBulk(1)
+	defer UseBulk(1000)
+	if code, _ := post("", `[{"op": "delete", "id": 1}, {"op": "delete", "id": 2}]`); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized batch: got %v want %v", code, http.StatusRequestEntityTooLarge)
+	}
+}
@@ -0,0 +1,209 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/adedaryorh/bookstore-app/pkg/catalogpb"
+	"github.com/adedaryorh/bookstore-app/pkg/models"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// CatalogServer serves the BookCatalog gRPC service. Each method does what
+// the REST handler it mirrors does, through the same models and with the
+// same side effects, so the two APIs can't drift apart.
+type CatalogServer struct {
+	catalogpb.UnimplementedBookCatalogServer
+}
+
+// GetBook mirrors GET /book/{id}.
+func (CatalogServer) GetBook(ctx context.Context, req *catalogpb.GetBookRequest) (*catalogpb.Book, error) {
+	if req.AsOf != nil {
+		if err := req.AsOf.CheckValid(); err != nil {
+			return nil, status.Error(codes.InvalidArgument, "Invalid as_of")
+		}
+		book, err := models.BookAsOf(ctx, uint(req.Id), req.AsOf.AsTime())
+		if err != nil {
+			return nil, modelStatus(ctx, err, "Failed to fetch book")
+		}
+		return bookToProto(book), nil
+	}
+	book, err := models.GetBookByID(ctx, uint(req.Id))
+	if err != nil {
+		return nil, modelStatus(ctx, err, "Failed to fetch book")
+	}
+	return bookToProto(book), nil
+}
+
+// ListBooks mirrors GET /book, streaming the books from a database cursor
+// as the exports do rather than loading the catalog first.
+func (CatalogServer) ListBooks(req *catalogpb.ListBooksRequest, stream grpc.ServerStreamingServer[catalogpb.Book]) error {
+	ctx := stream.Context()
+	filter := models.BookFilter{
+		Title:           req.Title,
+		Author:          req.Author,
+		Genre:           req.Genre,
+		ISBN:            req.Isbn,
+		PublicationYear: req.PublicationYear,
+	}
+	if req.UpdatedSince != nil {
+		if err := req.UpdatedSince.CheckValid(); err != nil {
+			return status.Error(codes.InvalidArgument, "Invalid updated_since")
+		}
+		filter.UpdatedSince = req.UpdatedSince.AsTime()
+	}
+	var sendErr error
+	err := models.EachBook(ctx, filter, func(book *models.Book) error {
+		sendErr = stream.Send(bookToProto(book))
+		return sendErr
+	})
+	switch {
+	case sendErr != nil:
+		// The client went away; its error says why.
+		return sendErr
+	case err != nil:
+		return modelStatus(ctx, err, "Failed to list books")
+	}
+	return nil
+}
+
+// BatchGetBooks fetches up to maxPageLimit books in one query.
+func (CatalogServer) BatchGetBooks(ctx context.Context, req *catalogpb.BatchGetBooksRequest) (*catalogpb.BatchGetBooksResponse, error) {
+	if len(req.Ids) > maxPageLimit {
+		return nil, status.Errorf(codes.InvalidArgument, "Too many ids, at most %d are allowed", maxPageLimit)
+	}
+	resp := &catalogpb.BatchGetBooksResponse{}
+	if len(req.Ids) == 0 {
+		return resp, nil
+	}
+	ids := make([]uint, len(req.Ids))
+	for i, id := range req.Ids {
+		ids[i] = uint(id)
+	}
+	books, err := models.GetBooksByIDs(ctx, ids)
+	if err != nil {
+		return nil, modelStatus(ctx, err, "Failed to fetch books")
+	}
+	for _, id := range ids {
+		if book, ok := books[id]; ok {
+			resp.Books = append(resp.Books, bookToProto(book))
+		} else {
+			resp.MissingIds = append(resp.MissingIds, uint32(id))
+		}
+	}
+	return resp, nil
+}
+
+// CreateBook mirrors POST /book, with ?upsert=true when req.Upsert is set.
+func (CatalogServer) CreateBook(ctx context.Context, req *catalogpb.CreateBookRequest) (*catalogpb.Book, error) {
+	book := bookFromProto(req.Book)
+	if err := book.NormalizeISBN(); err != nil {
+		return nil, modelStatus(ctx, err, "Failed to create book")
+	}
+	if req.Upsert && book.ISBN == "" {
+		return nil, status.Error(codes.InvalidArgument, "An isbn is required to upsert")
+	}
+	enrichNewBook(ctx, &book)
+
+	if req.Upsert {
+		if _, err := models.UpsertBookByISBN(ctx, &book, false); err != nil {
+			return nil, modelStatus(ctx, err, "Failed to save book")
+		}
+	} else if err := book.CreateBook(ctx); err != nil {
+		return nil, modelStatus(ctx, err, "Failed to create book")
+	}
+	return bookToProto(&book), nil
+}
+
+// UpdateBook mirrors PUT /book/{id}.
+func (CatalogServer) UpdateBook(ctx context.Context, req *catalogpb.UpdateBookRequest) (*catalogpb.Book, error) {
+	existing, err := models.GetBookByID(models.UsePrimary(ctx), uint(req.Id))
+	if err != nil {
+		return nil, modelStatus(ctx, err, "Failed to fetch book")
+	}
+	book := bookFromProto(req.Book)
+	book.ID = existing.ID
+	book.CreatedAt = existing.CreatedAt
+	if err := book.UpdateBook(ctx); err != nil {
+		return nil, modelStatus(ctx, err, "Failed to update book")
+	}
+	return bookToProto(&book), nil
+}
+
+// DeleteBook mirrors DELETE /book/{id}.
+func (CatalogServer) DeleteBook(ctx context.Context, req *catalogpb.DeleteBookRequest) (*catalogpb.Book, error) {
+	book, err := models.DeleteBook(ctx, uint(req.Id))
+	if err != nil {
+		return nil, modelStatus(ctx, err, "Failed to delete book")
+	}
+	removeCover(ctx, book.ID)
+	return bookToProto(book), nil
+}
+
+// grpcCodes maps the statuses modelErrorStatus picks onto gRPC codes.
+var grpcCodes = map[int]codes.Code{
+	http.StatusBadRequest:          codes.InvalidArgument,
+	http.StatusNotFound:            codes.NotFound,
+	http.StatusConflict:            codes.AlreadyExists,
+	http.StatusServiceUnavailable:  codes.Unavailable,
+	http.StatusInternalServerError: codes.Internal,
+}
+
+// modelStatus is writeModelError for gRPC: the code matches the status the
+// REST API answers with, and the message is the same. A duplicate ISBN
+// carries the ID of the book in the way in an ErrorInfo, as the REST body
+// does.
+func modelStatus(ctx context.Context, err error, message string) error {
+	code, msg := modelErrorStatus(ctx, err, message)
+	st := status.New(grpcCodes[code], msg)
+	var dup *models.DuplicateISBNError
+	if errors.As(err, &dup) && dup.BookID != 0 {
+		info := &errdetails.ErrorInfo{
+			Reason:   "DUPLICATE_ISBN",
+			Domain:   "bookstore",
+			Metadata: map[string]string{"book_id": strconv.FormatUint(uint64(dup.BookID), 10), "isbn": dup.ISBN},
+		}
+		if detailed, err := st.WithDetails(info); err == nil {
+			st = detailed
+		}
+	}
+	return st.Err()
+}
+
+func bookToProto(b *models.Book) *catalogpb.Book {
+	return &catalogpb.Book{
+		Id:              uint32(b.ID),
+		Title:           b.Title,
+		Author:          b.Author,
+		Isbn:            b.ISBN,
+		PublicationYear: b.PublicationYear,
+		Genre:           b.Genre,
+		Price:           b.Price,
+		CoverUrl:        b.CoverURL,
+		CreatedAt:       timestamppb.New(b.CreatedAt),
+		UpdatedAt:       timestamppb.New(b.UpdatedAt),
+	}
+}
+
+// bookFromProto copies the fields a client may set; the ID and timestamps
+// are the server's to pick, as they are over REST.
+func bookFromProto(b *catalogpb.Book) models.Book {
+	if b == nil {
+		return models.Book{}
+	}
+	return models.Book{
+		Title:           b.GetTitle(),
+		Author:          b.GetAuthor(),
+		ISBN:            b.GetIsbn(),
+		PublicationYear: b.GetPublicationYear(),
+		Genre:           b.Genre,
+		Price:           b.Price,
+		CoverURL:        b.CoverUrl,
+	}
+}
@@ -0,0 +1,281 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/adedaryorh/bookstore-app/pkg/catalogpb"
+	"github.com/adedaryorh/bookstore-app/pkg/models"
+	"github.com/julienschmidt/httprouter"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+// catalogClient serves CatalogServer in memory and returns a client for it.
+func catalogClient(t *testing.T) catalogpb.BookCatalogClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	catalogpb.RegisterBookCatalogServer(srv, CatalogServer{})
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return catalogpb.NewBookCatalogClient(conn)
+}
+
+// callREST runs a REST handler as the router would.
+func callREST(h httprouter.Handle, method, target string, body interface{}, id uint32) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	rr := httptest.NewRecorder()
+	h(rr, httptest.NewRequest(method, target, &buf), httprouter.Params{{Key: "bookId", Value: strconv.FormatUint(uint64(id), 10)}})
+	return rr
+}
+
+func restBook(t *testing.T, rr *httptest.ResponseRecorder) models.Book {
+	t.Helper()
+	var book models.Book
+	if err := json.Unmarshal(rr.Body.Bytes(), &book); err != nil {
+		t.Fatalf("decoding %s: %v", rr.Body, err)
+	}
+	return book
+}
+
+// sameBook reports how a book from the REST API and one from the gRPC
+// service differ.
+func sameBook(t *testing.T, what string, want models.Book, got *catalogpb.Book) {
+	t.Helper()
+	if !proto.Equal(bookToProto(&want), got) {
+		t.Errorf("%s: REST has %+v, gRPC %v", what, want, got)
+	}
+}
+
+func TestCatalogParity(t *testing.T) {
+	ctx := context.Background()
+	client := catalogClient(t)
+	author := "Catalog Parity Author"
+
+	created, err := client.CreateBook(ctx, &catalogpb.CreateBookRequest{Book: &catalogpb.Book{
+		Title: "Parity", Author: author, Isbn: "978-1-234-56804-7", Genre: proto.String("Fiction"), Price: proto.Float64(12.5),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer models.DeleteBook(ctx, uint(created.Id))
+	if created.Isbn != "9781234568047" {
+		t.Errorf("isbn should be normalized as over REST: got %q", created.Isbn)
+	}
+	rr := callREST(CreateBook, http.MethodPost, "/book", models.Book{Title: "Parity 2", Author: author, ISBN: "9781234568054"}, 0)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("REST create: got %v %s", rr.Code, rr.Body)
+	}
+	second := restBook(t, rr)
+	defer models.DeleteBook(ctx, second.ID)
+
+	rr = callREST(GetBookByID, http.MethodGet, "/book/x", nil, created.Id)
+	got, err := client.GetBook(ctx, &catalogpb.GetBookRequest{Id: created.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameBook(t, "get", restBook(t, rr), got)
+
+	// An update through either API reads back the same through the other.
+	// Updates answer with the timestamps set before saving, which the
+	// database rounds, so reads are compared.
+	rr = callREST(UpdateBook, http.MethodPut, "/book/x", models.Book{Title: "Parity renamed", Author: author, ISBN: "9781234568047"}, created.Id)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("REST update: got %v %s", rr.Code, rr.Body)
+	}
+	got, _ = client.GetBook(ctx, &catalogpb.GetBookRequest{Id: created.Id})
+	sameBook(t, "get after a REST update", restBook(t, callREST(GetBookByID, http.MethodGet, "/book/x", nil, created.Id)), got)
+	updated, err := client.UpdateBook(ctx, &catalogpb.UpdateBookRequest{Id: uint32(second.ID), Book: &catalogpb.Book{Title: "Parity 2 renamed", Author: author, Isbn: "9781234568054"}})
+	if err != nil || updated.Title != "Parity 2 renamed" {
+		t.Fatalf("gRPC update: got %v %v", updated, err)
+	}
+	got, _ = client.GetBook(ctx, &catalogpb.GetBookRequest{Id: updated.Id})
+	sameBook(t, "get after a gRPC update", restBook(t, callREST(GetBookByID, http.MethodGet, "/book/x", nil, updated.Id)), got)
+
+	// The streamed listing holds what GET /book lists, in ID order.
+	var listed []models.Book
+	rr = callREST(GetAllBooks, http.MethodGet, "/book?author=Catalog+Parity+Author", nil, 0)
+	json.Unmarshal(rr.Body.Bytes(), &listed)
+	stream, err := client.ListBooks(ctx, &catalogpb.ListBooksRequest{Author: author})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var streamed []*catalogpb.Book
+	for {
+		book, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		streamed = append(streamed, book)
+	}
+	if len(listed) != 2 || len(streamed) != 2 || streamed[0].Id > streamed[1].Id {
+		t.Fatalf("REST listed %d books, gRPC streamed %v", len(listed), streamed)
+	}
+	byID := map[uint32]models.Book{}
+	for _, b := range listed {
+		byID[uint32(b.ID)] = b
+	}
+	for _, b := range streamed {
+		sameBook(t, fmt.Sprintf("listed book %d", b.Id), byID[b.Id], b)
+	}
+
+	batch, err := client.BatchGetBooks(ctx, &catalogpb.BatchGetBooksRequest{Ids: []uint32{uint32(second.ID), 999999, created.Id}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batch.Books) != 2 || batch.Books[0].Id != uint32(second.ID) || batch.Books[1].Id != created.Id || len(batch.MissingIds) != 1 || batch.MissingIds[0] != 999999 {
+		t.Errorf("batch get: got %v", batch)
+	}
+
+	// Both APIs refuse a second book with the ISBN, naming the first.
+	rr = callREST(CreateBook, http.MethodPost, "/book", models.Book{Title: "Again", ISBN: "9781234568047"}, 0)
+	_, err = client.CreateBook(ctx, &catalogpb.CreateBookRequest{Book: &catalogpb.Book{Title: "Again", Isbn: "9781234568047"}})
+	var body struct {
+		BookID uint32 `json:"book_id"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &body)
+	var info *errdetails.ErrorInfo
+	for _, d := range status.Convert(err).Details() {
+		if i, ok := d.(*errdetails.ErrorInfo); ok {
+			info = i
+		}
+	}
+	if body.BookID != created.Id || info == nil || info.Metadata["book_id"] != strconv.FormatUint(uint64(created.Id), 10) {
+		t.Errorf("duplicate: REST body %s, gRPC details %v", rr.Body, info)
+	}
+
+	// Upserting the ISBN replaces the book, as with ?upsert=true.
+	upserted, err := client.CreateBook(ctx, &catalogpb.CreateBookRequest{Book: &catalogpb.Book{Title: "Upserted", Author: author, Isbn: "9781234568047"}, Upsert: true})
+	if err != nil || upserted.Id != created.Id || upserted.Title != "Upserted" {
+		t.Errorf("upsert: got %v %v", upserted, err)
+	}
+
+	rr = callREST(GetBookByID, http.MethodGet, "/book/x", nil, created.Id)
+	deleted, err := client.DeleteBook(ctx, &catalogpb.DeleteBookRequest{Id: created.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameBook(t, "delete", restBook(t, rr), deleted)
+	if rr := callREST(GetBookByID, http.MethodGet, "/book/x", nil, created.Id); rr.Code != http.StatusNotFound {
+		t.Errorf("REST get after a gRPC delete: got %v", rr.Code)
+	}
+}
+
+// TestCatalogErrorParity checks every failure of the gRPC service carries
+// the code matching the REST status and the same message, as a gateway in
+// front of the service would need.
+func TestCatalogErrorParity(t *testing.T) {
+	ctx := context.Background()
+	client := catalogClient(t)
+	const missing = 999999
+
+	tests := []struct {
+		name   string
+		rest   func() *httptest.ResponseRecorder
+		rpc    func() error
+		status int
+	}{
+		{
+			"get a missing book",
+			func() *httptest.ResponseRecorder {
+				return callREST(GetBookByID, http.MethodGet, "/book/x", nil, missing)
+			},
+			func() error {
+				_, err := client.GetBook(ctx, &catalogpb.GetBookRequest{Id: missing})
+				return err
+			},
+			http.StatusNotFound,
+		},
+		{
+			"create with an invalid isbn",
+			func() *httptest.ResponseRecorder {
+				return callREST(CreateBook, http.MethodPost, "/book", models.Book{Title: "Bad", ISBN: "9781234568040"}, 0)
+			},
+			func() error {
+				_, err := client.CreateBook(ctx, &catalogpb.CreateBookRequest{Book: &catalogpb.Book{Title: "Bad", Isbn: "9781234568040"}})
+				return err
+			},
+			http.StatusBadRequest,
+		},
+		{
+			"upsert without an isbn",
+			func() *httptest.ResponseRecorder {
+				return callREST(CreateBook, http.MethodPost, "/book?upsert=true", models.Book{Title: "No ISBN"}, 0)
+			},
+			func() error {
+				_, err := client.CreateBook(ctx, &catalogpb.CreateBookRequest{Book: &catalogpb.Book{Title: "No ISBN"}, Upsert: true})
+				return err
+			},
+			http.StatusBadRequest,
+		},
+		{
+			"update a missing book",
+			func() *httptest.ResponseRecorder {
+				return callREST(UpdateBook, http.MethodPut, "/book/x", models.Book{Title: "Gone"}, missing)
+			},
+			func() error {
+				_, err := client.UpdateBook(ctx, &catalogpb.UpdateBookRequest{Id: missing, Book: &catalogpb.Book{Title: "Gone"}})
+				return err
+			},
+			http.StatusNotFound,
+		},
+		{
+			"delete a missing book",
+			func() *httptest.ResponseRecorder {
+				return callREST(DeleteBook, http.MethodDelete, "/book/x", nil, missing)
+			},
+			func() error {
+				_, err := client.DeleteBook(ctx, &catalogpb.DeleteBookRequest{Id: missing})
+				return err
+			},
+			http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := tt.rest()
+			var body struct{ Error string }
+			json.Unmarshal(rr.Body.Bytes(), &body)
+			st := status.Convert(tt.rpc())
+			if rr.Code != tt.status || st.Code() != grpcCodes[tt.status] {
+				t.Errorf("REST got %v, gRPC %v; want %v and %v", rr.Code, st.Code(), tt.status, grpcCodes[tt.status])
+			}
+			if st.Message() != body.Error {
+				t.Errorf("REST says %q, gRPC %q", body.Error, st.Message())
+			}
+		})
+	}
+
+	_, err := client.BatchGetBooks(ctx, &catalogpb.BatchGetBooksRequest{Ids: make([]uint32, maxPageLimit+1)})
+	if st := status.Convert(err); st.Code() != grpcCodes[http.StatusBadRequest] {
+		t.Errorf("batch over the limit: got %v", st)
+	}
+}
@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// collectionETag is a weak validator for a list of count books whose newest
+// change was at lastModified. It is weak because it identifies the data,
+// not the exact bytes of the response.
+func collectionETag(count int, lastModified time.Time) string {
+	return fmt.Sprintf(`W/"%d-%x"`, count, lastModified.UnixNano())
+}
+
+// notModified sets the Last-Modified and, when given, ETag validators and
+// reports whether the request's conditional headers show the client's copy
+// is current, in which case a 304 has been written. If-None-Match takes
+// precedence over If-Modified-Since, as RFC 9110 requires.
+func notModified(w http.ResponseWriter, r *http.Request, lastModified time.Time, etag string) bool {
+	lastModified = lastModified.UTC().Truncate(time.Second)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+	}
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if etag == "" || !etagMatches(inm, etag) {
+			return false
+		}
+	} else {
+		since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+		if err != nil || lastModified.IsZero() || lastModified.After(since) {
+			return false
+		}
+	}
+
+	// A 304 carries the validators but no body or content headers.
+	w.Header().Del("Content-Type")
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatches compares a If-None-Match header against etag using the weak
+// comparison function.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNotModified(t *testing.T) {
+	modified := time.Date(2024, 3, 1, 12, 0, 0, 500, time.UTC)
+	etag := collectionETag(3, modified)
+
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   bool
+	}{
+		{"unconditional", nil, false},
+		{"same time", map[string]string{"If-Modified-Since": "Fri, 01 Mar 2024 12:00:00 GMT"}, true},
+		{"later time", map[string]string{"If-Modified-Since": "Sat, 02 Mar 2024 12:00:00 GMT"}, true},
+		{"earlier time", map[string]string{"If-Modified-Since": "Fri, 01 Mar 2024 11:59:59 GMT"}, false},
+		{"bad time", map[string]string{"If-Modified-Since": "yesterday"}, false},
+		{"matching etag", map[string]string{"If-None-Match": etag}, true},
+		{"strong form of etag", map[string]string{"If-None-Match": `"other", ` + etag[2:]}, true},
+		{"changed etag", map[string]string{"If-None-Match": collectionETag(4, modified)}, false},
+		{"etag wins over time", map[string]string{
+			"If-None-Match":     collectionETag(4, modified),
+			"If-Modified-Since": "Sat, 02 Mar 2024 12:00:00 GMT",
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/books", nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			rr := httptest.NewRecorder()
+
+			if got := notModified(rr, req, modified, etag); got != tt.want {
+				t.Errorf("got %v want %v", got, tt.want)
+			}
+			if tt.want && rr.Code != http.StatusNotModified {
+				t.Errorf("got status %v want %v", rr.Code, http.StatusNotModified)
+			}
+			if got := rr.Header().Get("Last-Modified"); got != "Fri, 01 Mar 2024 12:00:00 GMT" {
+				t.Errorf("got Last-Modified %q", got)
+			}
+			if got := rr.Header().Get("ETag"); got != etag {
+				t.Errorf("got ETag %q want %q", got, etag)
+			}
+		})
+	}
+}
@@ -1,16 +1,43 @@
 package controllers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/adedaryorh/bookstore-app/pkg/isbn"
+	"github.com/adedaryorh/bookstore-app/pkg/logging"
 	"github.com/adedaryorh/bookstore-app/pkg/models"
 	"github.com/julienschmidt/httprouter"
 )
 
+// GetAllBooks lists the catalog, narrowed by the filters parseBookFilter
+// accepts.
 func GetAllBooks(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	books := models.GetAllBooks()
+	filter, err := parseBookFilter(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	count, lastModified, err := models.CatalogVersion(r.Context(), filter)
+	if err != nil {
+		writeModelError(w, r, err, "Failed to list books")
+		return
+	}
+	if notModified(w, r, lastModified, collectionETag(count, lastModified)) {
+		return
+	}
+
+	books, err := models.GetAllBooks(r.Context(), filter)
+	if err != nil {
+		writeModelError(w, r, err, "Failed to list books")
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(books)
 }
@@ -19,19 +46,42 @@ func GetBooks(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	GetAllBooks(w, r, nil)
 }
 
+// GetBookByID returns a book, or with as_of, an RFC 3339 timestamp, the
+// book as it was then.
 func GetBookByID(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	bookIdStr := ps.ByName("bookId")
 	bookId, err := strconv.ParseUint(bookIdStr, 10, 32)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid book ID"})
+		writeError(w, r, http.StatusBadRequest, "Invalid book ID")
+		return
+	}
+	if asOf := r.URL.Query().Get("as_of"); asOf != "" {
+		getBookAsOf(w, r, uint(bookId), asOf)
+		return
+	}
+
+	book, err := models.GetBookByID(r.Context(), uint(bookId))
+	if err != nil {
+		writeModelError(w, r, err, "Failed to fetch book")
 		return
 	}
+	if notModified(w, r, book.UpdatedAt, "") {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(book)
+}
 
-	book, err := models.GetBookByID(uint(bookId))
+// GetBookByISBN looks a book up by its ISBN-10 or ISBN-13, with or without
+// hyphens.
+func GetBookByISBN(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	book, err := models.GetBookByISBN(r.Context(), ps.ByName("isbn"))
 	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Book not found"})
+		writeModelError(w, r, err, "Failed to fetch book")
+		return
+	}
+	if notModified(w, r, book.UpdatedAt, "") {
 		return
 	}
 
@@ -39,49 +89,77 @@ func GetBookByID(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	json.NewEncoder(w).Encode(book)
 }
 
+// CreateBook adds a book. A book with the ISBN of an existing one is refused
+// with 409, unless upsert=true asks for the existing book to be replaced
+// instead, as with PUT; the status then tells which happened.
 func CreateBook(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	upsert := false
+	if v := r.URL.Query().Get("upsert"); v != "" {
+		var err error
+		if upsert, err = strconv.ParseBool(v); err != nil {
+			writeError(w, r, http.StatusBadRequest, "Invalid upsert value")
+			return
+		}
+	}
 	var book models.Book
 	if err := json.NewDecoder(r.Body).Decode(&book); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid JSON format"})
+		writeError(w, r, http.StatusBadRequest, "Invalid JSON format")
+		return
+	}
+	if err := book.NormalizeISBN(); err != nil {
+		writeModelError(w, r, err, "Failed to create book")
+		return
+	}
+	if upsert && book.ISBN == "" {
+		writeError(w, r, http.StatusBadRequest, "An isbn is required to upsert")
 		return
 	}
+	enrichNewBook(r.Context(), &book)
 
-	createdBook := book.CreateBook()
+	status := http.StatusCreated
+	if upsert {
+		created, err := models.UpsertBookByISBN(r.Context(), &book, false)
+		if err != nil {
+			writeModelError(w, r, err, "Failed to save book")
+			return
+		}
+		if !created {
+			status = http.StatusOK
+		}
+	} else if err := book.CreateBook(r.Context()); err != nil {
+		writeModelError(w, r, err, "Failed to create book")
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(createdBook)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(book)
 }
 
 func UpdateBook(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	bookIdStr := ps.ByName("bookId")
 	bookId, err := strconv.ParseUint(bookIdStr, 10, 32)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid book ID"})
+		writeError(w, r, http.StatusBadRequest, "Invalid book ID")
 		return
 	}
 
-	existingBook, err := models.GetBookByID(uint(bookId))
+	existingBook, err := models.GetBookByID(models.UsePrimary(r.Context()), uint(bookId))
 	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Book not found"})
+		writeModelError(w, r, err, "Failed to fetch book")
 		return
 	}
 
 	var updatedBook models.Book
 	if err := json.NewDecoder(r.Body).Decode(&updatedBook); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid JSON format"})
+		writeError(w, r, http.StatusBadRequest, "Invalid JSON format")
 		return
 	}
 
 	updatedBook.ID = existingBook.ID
 	updatedBook.CreatedAt = existingBook.CreatedAt
 
-	if err := updatedBook.UpdateBook(); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to update book"})
+	if err := updatedBook.UpdateBook(r.Context()); err != nil {
+		writeModelError(w, r, err, "Failed to update book")
 		return
 	}
 
@@ -93,21 +171,126 @@ func DeleteBook(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	bookIdStr := ps.ByName("bookId")
 	bookId, err := strconv.ParseUint(bookIdStr, 10, 32)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid book ID"})
+		writeError(w, r, http.StatusBadRequest, "Invalid book ID")
 		return
 	}
-	_, err = models.GetBookByID(uint(bookId))
+	deletedBook, err := models.DeleteBook(r.Context(), uint(bookId))
 	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Book not found"})
+		writeModelError(w, r, err, "Failed to delete book")
 		return
 	}
+	removeCover(r.Context(), deletedBook.ID)
 
-	deletedBook := models.DeleteBook(uint(bookId))
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"message": "Book deleted successfully",
 		"book":    deletedBook,
 	})
 }
+
+// parseBookFilter reads the catalog filters shared by the list and export
+// endpoints from the query string.
+func parseBookFilter(r *http.Request) (models.BookFilter, error) {
+	q := r.URL.Query()
+	f := models.BookFilter{
+		Title:           q.Get("title"),
+		Author:          q.Get("author"),
+		Genre:           q.Get("genre"),
+		ISBN:            q.Get("isbn"),
+		PublicationYear: q.Get("publication_year"),
+	}
+	if v := q.Get("updated_since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return f, errors.New("Invalid updated_since, want an RFC 3339 timestamp")
+		}
+		f.UpdatedSince = t
+	}
+	return f, nil
+}
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
+// parsePage reads the limit and offset of a paged listing.
+func parsePage(r *http.Request) (limit, offset int, err error) {
+	q := r.URL.Query()
+	limit = defaultPageLimit
+	if v := q.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > maxPageLimit {
+			return 0, 0, fmt.Errorf("Invalid limit, want 1 to %d", maxPageLimit)
+		}
+	}
+	if v := q.Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			return 0, 0, errors.New("Invalid offset")
+		}
+	}
+	return limit, offset, nil
+}
+
+// writeError sends a JSON error body tagged with the request ID so clients
+// can quote it when reporting problems.
+func writeError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	body := map[string]string{"error": message}
+	if id := logging.RequestID(r.Context()); id != "" {
+		body["request_id"] = id
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeModelError maps an error from the models package onto a response.
+// Unexpected errors are logged and reported with the generic message.
+func writeModelError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	status, msg := modelErrorStatus(r.Context(), err, message)
+	if status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", "5")
+	}
+	var dup *models.DuplicateISBNError
+	if errors.As(err, &dup) && dup.BookID != 0 {
+		// Point at the book in the way.
+		link := fmt.Sprintf("/book/%d", dup.BookID)
+		w.Header().Set("Link", "<"+link+`>; rel="duplicate"`)
+		body := map[string]interface{}{"error": msg, "book_id": dup.BookID, "book_url": link}
+		if id := logging.RequestID(r.Context()); id != "" {
+			body["request_id"] = id
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+		return
+	}
+	writeError(w, r, status, msg)
+}
+
+// modelErrorStatus picks the status and client message for an error from
+// the models package, logging the ones that shouldn't happen.
+func modelErrorStatus(ctx context.Context, err error, message string) (int, string) {
+	switch {
+	case errors.Is(err, models.ErrBookNotFound):
+		return http.StatusNotFound, "Book not found"
+	case errors.Is(err, models.ErrRevisionNotFound):
+		return http.StatusNotFound, "Revision not found"
+	case errors.Is(err, models.ErrWebhookNotFound):
+		return http.StatusNotFound, "Webhook not found"
+	case errors.Is(err, models.ErrDeliveryNotFound):
+		return http.StatusNotFound, "Delivery not found"
+	case errors.Is(err, models.ErrDuplicateISBN):
+		var dup *models.DuplicateISBNError
+		if errors.As(err, &dup) && dup.BookID != 0 {
+			return http.StatusConflict, fmt.Sprintf("A book with ISBN %s already exists (book %d)", dup.ISBN, dup.BookID)
+		}
+		return http.StatusConflict, "A book with this ISBN already exists"
+	case errors.Is(err, isbn.ErrInvalid), errors.Is(err, isbn.ErrChecksum):
+		return http.StatusBadRequest, "Invalid " + err.Error()
+	case errors.Is(err, models.ErrDatabaseUnavailable):
+		slog.WarnContext(ctx, "database unavailable", "error", err)
+		return http.StatusServiceUnavailable, "Database unavailable, please retry"
+	}
+	slog.ErrorContext(ctx, message, "error", err)
+	return http.StatusInternalServerError, message
+}
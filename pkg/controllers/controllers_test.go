@@ -2,13 +2,19 @@ package controllers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/adedaryorh/bookstore-app/pkg/config"
+	"github.com/adedaryorh/bookstore-app/pkg/idempotency"
 	"github.com/adedaryorh/bookstore-app/pkg/models"
 	"github.com/julienschmidt/httprouter"
 )
@@ -22,6 +28,17 @@ func TestMain(m *testing.M) {
 	os.Setenv("DB_PASSWORD", "bookstore_pass")
 	os.Setenv("DB_NAME", "bookstore_test")
 
+	cfg, err := config.Load(nil)
+	if err != nil {
+		panic(err)
+	}
+	if err := config.Connect(context.Background(), cfg.Database); err != nil {
+		panic(err)
+	}
+	if err := models.Init(); err != nil {
+		panic(err)
+	}
+
 	// Run tests
 	code := m.Run()
 	os.Exit(code)
@@ -91,7 +108,7 @@ func TestCreateBook(t *testing.T) {
 	testBook := models.Book{
 		Title:           "Test Book",
 		Author:          "Test Author",
-		ISBN:            "1234567890123",
+		ISBN:            "9781234567897",
 		PublicationYear: "2023",
 		Genre:           stringPtr("Fiction"),
 		Price:           float64Ptr(29.99),
@@ -127,6 +144,8 @@ func TestCreateBook(t *testing.T) {
 	if err := json.Unmarshal(rr.Body.Bytes(), &createdBook); err != nil {
 		t.Errorf("Response is not valid JSON: %v", err)
 	}
+	// ISBNs are unique, so the book must not outlive the test.
+	defer models.DeleteBook(context.Background(), createdBook.ID)
 
 	// Verify book data
 	if createdBook.Title != testBook.Title {
@@ -239,12 +258,55 @@ func TestGetBookByIDInvalidID(t *testing.T) {
 	}
 }
 
+func TestGetBookByISBN(t *testing.T) {
+	// Created from an ISBN-10, stored as the ISBN-13
+	book := &models.Book{Title: "Left Hand of Darkness", Author: "Ursula K. Le Guin", ISBN: "0-441-47812-3"}
+	body, _ := json.Marshal(book)
+	rr := httptest.NewRecorder()
+	CreateBook(rr, httptest.NewRequest(http.MethodPost, "/book", bytes.NewReader(body)), nil)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create returned wrong status code: got %v want %v", rr.Code, http.StatusCreated)
+	}
+	json.Unmarshal(rr.Body.Bytes(), book)
+	defer models.DeleteBook(context.Background(), book.ID)
+	if book.ISBN != "9780441478125" {
+		t.Errorf("ISBN not stored in canonical form: got %v want %v", book.ISBN, "9780441478125")
+	}
+
+	router := httprouter.New()
+	router.GET("/book/isbn/:isbn", GetBookByISBN)
+	for _, lookup := range []string{"9780441478125", "978-0-441-47812-5", "0441478123"} {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/book/isbn/"+lookup, nil))
+		var got models.Book
+		json.Unmarshal(rr.Body.Bytes(), &got)
+		if rr.Code != http.StatusOK || got.ID != book.ID {
+			t.Errorf("%s: got status %v book %v want %v book %v", lookup, rr.Code, got.ID, http.StatusOK, book.ID)
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/book/isbn/0441478124", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("bad check digit returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestCreateBookInvalidISBN(t *testing.T) {
+	body := `{"title":"Bad ISBN","author":"Someone","isbn":"1234567890123"}`
+	rr := httptest.NewRecorder()
+	CreateBook(rr, httptest.NewRequest(http.MethodPost, "/book", strings.NewReader(body)), nil)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
+
 func TestUpdateBook(t *testing.T) {
 	// First, create a book to update
 	testBook := models.Book{
 		Title:           "Original Title",
 		Author:          "Original Author",
-		ISBN:            "1234567890124",
+		ISBN:            "9781234567903",
 		PublicationYear: "2023",
 	}
 
@@ -262,12 +324,13 @@ func TestUpdateBook(t *testing.T) {
 	// Get the created book ID
 	var createdBook models.Book
 	json.Unmarshal(createRR.Body.Bytes(), &createdBook)
+	defer models.DeleteBook(context.Background(), createdBook.ID)
 
 	// Prepare update data
 	updateBook := models.Book{
 		Title:           "Updated Title",
 		Author:          "Updated Author",
-		ISBN:            "1234567890124",
+		ISBN:            "9781234567903",
 		PublicationYear: "2024",
 	}
 
@@ -393,6 +456,161 @@ func TestDeleteBookInvalidID(t *testing.T) {
 	}
 }
 
+func TestBookMutationsRecordEvents(t *testing.T) {
+	ctx := context.Background()
+	book := &models.Book{Title: "Outbox", Author: "Author", ISBN: "9781234567927"}
+	if err := book.CreateBook(ctx); err != nil {
+		t.Fatal(err)
+	}
+	book.Title = "Outbox, revised"
+	if err := book.UpdateBook(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := models.DeleteBook(ctx, book.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Drain the outbox, keeping this book's events.
+	var events []models.Event
+	for {
+		n, err := models.PublishEvents(ctx, 100, time.Minute, 3, func(ev models.Event) error {
+			if ev.BookID == book.ID {
+				events = append(events, ev)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n == 0 {
+			break
+		}
+	}
+
+	if len(events) != 3 {
+		t.Fatalf("got %d events want 3: %+v", len(events), events)
+	}
+	for i, want := range []string{models.EventBookCreated, models.EventBookUpdated, models.EventBookDeleted} {
+		if events[i].Type != want {
+			t.Errorf("event %d: got %v want %v", i, events[i].Type, want)
+		}
+	}
+	if c := events[1].Changes; len(c) != 1 || c["title"].New != "Outbox, revised" {
+		t.Errorf("wrong update changes: %+v", c)
+	}
+	if events[0].ID == events[1].ID {
+		t.Error("events should have distinct IDs")
+	}
+}
+
+func TestCreateBookIdempotent(t *testing.T) {
+	create := idempotency.Handle(models.IdempotencyKeys{TTL: time.Hour, Lease: time.Minute}, CreateBook)
+	key := strconv.FormatInt(time.Now().UnixNano(), 10)
+	post := func(body string) (*httptest.ResponseRecorder, models.Book) {
+		req := httptest.NewRequest(http.MethodPost, "/book", strings.NewReader(body))
+		req.Header.Set(idempotency.Header, key)
+		rr := httptest.NewRecorder()
+		create(rr, req, nil)
+		var book models.Book
+		json.Unmarshal(rr.Body.Bytes(), &book)
+		return rr, book
+	}
+
+	body := `{"title": "Idempotent", "author": "Author", "isbn": "9781234567989"}`
+	first, created := post(body)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("got %v want %v", first.Code, http.StatusCreated)
+	}
+	defer models.DeleteBook(context.Background(), created.ID)
+
+	retry, replayed := post(body)
+	if retry.Code != http.StatusCreated || replayed.ID != created.ID || retry.Header().Get(idempotency.ReplayedHeader) != "true" {
+		t.Errorf("retry created another book or wasn't replayed: %v %+v", retry.Code, replayed)
+	}
+	if rr, _ := post(`{"title": "Something else", "author": "Author"}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("key reused with another body: got %v want %v", rr.Code, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestCreateBookDuplicateISBN(t *testing.T) {
+	existing := &models.Book{Title: "Original", Author: "Author", ISBN: "9781234567996"}
+	if err := existing.CreateBook(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer models.DeleteBook(context.Background(), existing.ID)
+	post := func(query, body string) (*httptest.ResponseRecorder, models.Book) {
+		rr := httptest.NewRecorder()
+		CreateBook(rr, httptest.NewRequest(http.MethodPost, "/book"+query, strings.NewReader(body)), nil)
+		var book models.Book
+		json.Unmarshal(rr.Body.Bytes(), &book)
+		return rr, book
+	}
+
+	// The same ISBN, written as an ISBN-13 with hyphens.
+	rr, _ := post("", `{"title": "Copy", "author": "Author", "isbn": "978-1-234-56799-6"}`)
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("duplicate ISBN: got %v want %v", rr.Code, http.StatusConflict)
+	}
+	link := "/book/" + strconv.Itoa(int(existing.ID))
+	var body struct {
+		BookID  uint   `json:"book_id"`
+		BookURL string `json:"book_url"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &body)
+	if body.BookID != existing.ID || body.BookURL != link || rr.Header().Get("Link") != "<"+link+`>; rel="duplicate"` {
+		t.Errorf("conflict doesn't point at the existing book: %s %v", rr.Body, rr.Header())
+	}
+
+	rr, book := post("?upsert=true", `{"title": "Revised", "author": "Author", "isbn": "9781234567996"}`)
+	if rr.Code != http.StatusOK || book.ID != existing.ID || book.Title != "Revised" {
+		t.Errorf("upsert of an existing ISBN: got %v %+v", rr.Code, book)
+	}
+	if rr, _ := post("?upsert=true", `{"title": "No ISBN", "author": "Author"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("upsert without an ISBN: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
+
+// TestOutboxDeadLettersRejectedEvents checks an event the publisher keeps
+// rejecting is set aside after its attempts, letting later events through.
+func TestOutboxDeadLettersRejectedEvents(t *testing.T) {
+	ctx := context.Background()
+	book := &models.Book{Title: "Rejected", Author: "Author", ISBN: "9781234568108"}
+	if err := book.CreateBook(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer models.DeleteBook(ctx, book.ID)
+	book.Title = "Rejected, revised"
+	if err := book.UpdateBook(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	attempts := 0
+	var published []string
+	for i := 0; i < 10; i++ {
+		n, err := models.PublishEvents(ctx, 100, time.Minute, 2, func(ev models.Event) error {
+			if ev.BookID != book.ID {
+				return nil
+			}
+			if ev.Type == models.EventBookCreated {
+				attempts++
+				return errors.New("rejected")
+			}
+			published = append(published, ev.Type)
+			return nil
+		})
+		if err == nil && n == 0 {
+			break
+		}
+	}
+
+	if attempts != 2 {
+		t.Errorf("the rejected event should be tried twice, got %d", attempts)
+	}
+	if len(published) != 1 || published[0] != models.EventBookUpdated {
+		t.Errorf("the update should be published after the dead event, got %v", published)
+	}
+}
+
 // Helper functions for pointer types
 func stringPtr(s string) *string {
 	return &s
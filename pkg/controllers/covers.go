@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/adedaryorh/bookstore-app/pkg/covers"
+	"github.com/adedaryorh/bookstore-app/pkg/models"
+	"github.com/adedaryorh/bookstore-app/pkg/storage"
+	"github.com/julienschmidt/httprouter"
+)
+
+var (
+	// coverStore holds cover images; nil disables cover uploads.
+	coverStore storage.Store
+	// maxCoverBytes caps the size of an uploaded cover.
+	maxCoverBytes int64 = 5 << 20
+)
+
+// UseCovers sets where cover images are stored and the largest upload
+// accepted.
+func UseCovers(store storage.Store, maxBytes int64) {
+	coverStore = store
+	maxCoverBytes = maxBytes
+}
+
+// UploadCover replaces a book's cover with the JPEG or PNG image in the
+// request body, or in the "file" part of a multipart form, and points the
+// book's cover_url at it.
+func UploadCover(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	bookId, err := strconv.ParseUint(ps.ByName("bookId"), 10, 32)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid book ID")
+		return
+	}
+	if coverStore == nil {
+		writeError(w, r, http.StatusNotImplemented, "Cover uploads are not configured")
+		return
+	}
+	book, err := models.GetBookByID(models.UsePrimary(r.Context()), uint(bookId))
+	if err != nil {
+		writeModelError(w, r, err, "Failed to fetch book")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxCoverBytes)
+	body, err := uploadedFile(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		writeError(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("Cover image is larger than %d bytes", maxCoverBytes))
+		return
+	case err != nil:
+		writeError(w, r, http.StatusBadRequest, "Failed to read cover image")
+		return
+	}
+
+	cover, err := covers.Process(data)
+	switch {
+	case errors.Is(err, covers.ErrUnsupportedType):
+		writeError(w, r, http.StatusUnsupportedMediaType, "Cover must be a JPEG or PNG image")
+		return
+	case errors.Is(err, covers.ErrInvalid), errors.Is(err, covers.ErrTooLarge):
+		writeError(w, r, http.StatusUnprocessableEntity, "Invalid cover image: "+err.Error())
+		return
+	case err != nil:
+		slog.ErrorContext(r.Context(), "processing cover failed", "book_id", book.ID, "error", err)
+		writeError(w, r, http.StatusInternalServerError, "Failed to process cover image")
+		return
+	}
+	if err := covers.Save(r.Context(), coverStore, book.ID, cover); err != nil {
+		slog.ErrorContext(r.Context(), "storing cover failed", "book_id", book.ID, "error", err)
+		writeError(w, r, http.StatusInternalServerError, "Failed to store cover image")
+		return
+	}
+
+	// The version changes with the image, so clients can cache a cover URL
+	// forever. Only the URL is set on the book as it is now, since it may
+	// have been edited during the upload.
+	url := fmt.Sprintf("/book/%d/cover?v=%s", book.ID, cover.Version)
+	book, err = models.ModifyBook(r.Context(), book.ID, func(b *models.Book) error {
+		b.CoverURL = &url
+		return nil
+	})
+	if err != nil {
+		writeModelError(w, r, err, "Failed to update book")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(book)
+}
+
+// GetCover serves a book's cover image. size picks the original (default)
+// or one of the generated renditions. Requests for a versioned URL, as
+// given in cover_url, may be cached indefinitely.
+func GetCover(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	bookId, err := strconv.ParseUint(ps.ByName("bookId"), 10, 32)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid book ID")
+		return
+	}
+	q := r.URL.Query()
+	size := q.Get("size")
+	if size == "" {
+		size = covers.Original
+	}
+	if !covers.ValidSize(size) {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("Unknown cover size %q", size))
+		return
+	}
+	if coverStore == nil {
+		writeError(w, r, http.StatusNotFound, "Cover not found")
+		return
+	}
+
+	obj, err := coverStore.Get(r.Context(), covers.Key(uint(bookId), size))
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		writeError(w, r, http.StatusNotFound, "Cover not found")
+		return
+	case err != nil:
+		slog.ErrorContext(r.Context(), "reading cover failed", "book_id", bookId, "error", err)
+		writeError(w, r, http.StatusInternalServerError, "Failed to read cover image")
+		return
+	}
+	defer obj.Close()
+
+	if q.Get("v") != "" {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "public, no-cache")
+	}
+	http.ServeContent(w, r, "", obj.ModTime, obj)
+}
+
+// removeCover deletes a deleted book's cover images. Failures are only
+// logged, since the book itself is already gone.
+func removeCover(ctx context.Context, bookID uint) {
+	if coverStore == nil {
+		return
+	}
+	if err := covers.Remove(ctx, coverStore, bookID); err != nil {
+		slog.WarnContext(ctx, "removing cover failed", "book_id", bookID, "error", err)
+	}
+}
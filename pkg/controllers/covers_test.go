@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/adedaryorh/bookstore-app/pkg/models"
+	"github.com/adedaryorh/bookstore-app/pkg/storage"
+	"github.com/julienschmidt/httprouter"
+)
+
+func coverRouter(t *testing.T, maxBytes int64) *httprouter.Router {
+	store, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	UseCovers(store, maxBytes)
+	t.Cleanup(func() { UseCovers(nil, 5<<20) })
+
+	router := httprouter.New()
+	router.POST("/book/:bookId/cover", UploadCover)
+	router.GET("/book/:bookId/cover", GetCover)
+	return router
+}
+
+func TestUploadCover(t *testing.T) {
+	router := coverRouter(t, 5<<20)
+	book := &models.Book{Title: "Covered", Author: "Cover Author", ISBN: "9780000000033"}
+	book.CreateBook(context.Background())
+	defer models.DeleteBook(context.Background(), book.ID)
+	path := "/book/" + strconv.Itoa(int(book.ID)) + "/cover"
+
+	var img bytes.Buffer
+	png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 400, 600)))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(img.Bytes())))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	var updated models.Book
+	json.Unmarshal(rr.Body.Bytes(), &updated)
+	if updated.CoverURL == nil || !strings.HasPrefix(*updated.CoverURL, path+"?v=") {
+		t.Fatalf("cover_url not set: %v", updated.CoverURL)
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, *updated.CoverURL+"&size=thumb", nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "image/jpeg" {
+		t.Errorf("thumbnail: got %v %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	if cc := rr.Header().Get("Cache-Control"); !strings.Contains(cc, "immutable") {
+		t.Errorf("versioned cover should be cached for good, got Cache-Control %q", cc)
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "image/png" || !bytes.Equal(rr.Body.Bytes(), img.Bytes()) {
+		t.Errorf("original: got %v %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("If-Modified-Since", rr.Header().Get("Last-Modified"))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("conditional request: got %v want %v", rr.Code, http.StatusNotModified)
+	}
+}
+
+func TestCoverSurvivesUpdates(t *testing.T) {
+	router := coverRouter(t, 5<<20)
+	router.POST("/books/import", ImportBooks)
+	book := &models.Book{Title: "Kept cover", Author: "Cover Author", ISBN: "9780000000057"}
+	book.CreateBook(context.Background())
+	defer models.DeleteBook(context.Background(), book.ID)
+
+	var img bytes.Buffer
+	png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 40, 60)))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/book/"+strconv.Itoa(int(book.ID))+"/cover", bytes.NewReader(img.Bytes())))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("upload: got %v %s", rr.Code, rr.Body)
+	}
+	var uploaded models.Book
+	json.Unmarshal(rr.Body.Bytes(), &uploaded)
+
+	req := httptest.NewRequest(http.MethodPost, "/books/import", strings.NewReader("title,author,isbn\nKept cover reissued,Cover Author,9780000000057\n"))
+	req.Header.Set("Content-Type", "text/csv")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("import: got %v %s", rr.Code, rr.Body)
+	}
+	edited := uploaded
+	edited.Price = nil
+	edited.CoverURL = nil
+	if err := edited.UpdateBook(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := models.GetBookByID(models.UsePrimary(context.Background()), book.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.CoverURL == nil || uploaded.CoverURL == nil || *saved.CoverURL != *uploaded.CoverURL {
+		t.Errorf("cover_url should survive a re-import and an update: got %v want %v", saved.CoverURL, uploaded.CoverURL)
+	}
+}
+
+func TestUploadCoverRejects(t *testing.T) {
+	router := coverRouter(t, 1024)
+	book := &models.Book{Title: "Uncovered", Author: "Cover Author", ISBN: "9780000000040"}
+	book.CreateBook(context.Background())
+	defer models.DeleteBook(context.Background(), book.ID)
+	path := "/book/" + strconv.Itoa(int(book.ID)) + "/cover"
+
+	tests := []struct {
+		name string
+		body []byte
+		want int
+	}{
+		{"not an image", []byte("GIF89a not really"), http.StatusUnsupportedMediaType},
+		{"truncated", []byte("\x89PNG\r\n\x1a\n\x00\x00"), http.StatusUnprocessableEntity},
+		{"too large", append([]byte("\xff\xd8\xff"), make([]byte, 2048)...), http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(tt.body)))
+		if rr.Code != tt.want {
+			t.Errorf("%s: got %v want %v", tt.name, rr.Code, tt.want)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path+"?size=huge", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("unknown size: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/adedaryorh/bookstore-app/pkg/enrich"
+	"github.com/adedaryorh/bookstore-app/pkg/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+var (
+	// enricher looks up book metadata by ISBN; nil disables enrichment.
+	enricher enrich.Provider
+	// enrichOnCreate fills the blank fields of new books from enricher.
+	enrichOnCreate bool
+)
+
+// UseEnrichment sets the source of book metadata and whether new books are
+// enriched as they are created.
+func UseEnrichment(p enrich.Provider, onCreate bool) {
+	enricher = p
+	enrichOnCreate = onCreate
+}
+
+// errISBNChanged stops an enrichment whose book got another ISBN while its
+// metadata was looked up.
+var errISBNChanged = errors.New("isbn changed")
+
+// EnrichBook fills in a book's blank fields from the metadata source, by its
+// ISBN. With overwrite=true fields that are already set are replaced too.
+func EnrichBook(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	bookId, err := strconv.ParseUint(ps.ByName("bookId"), 10, 32)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid book ID")
+		return
+	}
+	overwrite := false
+	if v := r.URL.Query().Get("overwrite"); v != "" {
+		if overwrite, err = strconv.ParseBool(v); err != nil {
+			writeError(w, r, http.StatusBadRequest, "Invalid overwrite value")
+			return
+		}
+	}
+	if enricher == nil {
+		writeError(w, r, http.StatusNotImplemented, "Enrichment is not configured")
+		return
+	}
+
+	book, err := models.GetBookByID(models.UsePrimary(r.Context()), uint(bookId))
+	if err != nil {
+		writeModelError(w, r, err, "Failed to fetch book")
+		return
+	}
+	if book.ISBN == "" {
+		writeError(w, r, http.StatusUnprocessableEntity, "Book has no ISBN to look up")
+		return
+	}
+
+	meta, err := enricher.Lookup(r.Context(), book.ISBN)
+	switch {
+	case errors.Is(err, enrich.ErrNotFound):
+		writeError(w, r, http.StatusNotFound, "No metadata found for ISBN "+book.ISBN)
+		return
+	case err != nil:
+		slog.WarnContext(r.Context(), "enrichment lookup failed", "isbn", book.ISBN, "error", err)
+		writeError(w, r, http.StatusBadGateway, "Metadata source unavailable")
+		return
+	}
+
+	// The lookup can take a while, so the metadata is applied to the book
+	// as it is now, keeping edits made meanwhile.
+	var changed []string
+	book, err = models.ModifyBook(r.Context(), book.ID, func(b *models.Book) error {
+		if b.ISBN != book.ISBN {
+			return errISBNChanged
+		}
+		changed = enrich.Apply(b, meta, overwrite)
+		return nil
+	})
+	switch {
+	case errors.Is(err, errISBNChanged):
+		writeError(w, r, http.StatusConflict, "Book's ISBN changed during the lookup")
+		return
+	case err != nil:
+		writeModelError(w, r, err, "Failed to update book")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"book":    book,
+		"source":  meta.Source,
+		"updated": append([]string{}, changed...),
+	})
+}
+
+// enrichNewBook fills the blank fields of a book about to be created. A
+// failed lookup is logged and the book is created as it was sent.
+func enrichNewBook(ctx context.Context, book *models.Book) {
+	if !enrichOnCreate || enricher == nil || book.ISBN == "" {
+		return
+	}
+	meta, err := enricher.Lookup(ctx, book.ISBN)
+	switch {
+	case errors.Is(err, enrich.ErrNotFound):
+		return
+	case err != nil:
+		slog.WarnContext(ctx, "enrichment lookup failed", "isbn", book.ISBN, "error", err)
+		return
+	}
+	if changed := enrich.Apply(book, meta, false); len(changed) > 0 {
+		slog.InfoContext(ctx, "new book enriched", "isbn", book.ISBN, "source", meta.Source, "fields", changed)
+	}
+}
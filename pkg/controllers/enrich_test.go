@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/adedaryorh/bookstore-app/pkg/enrich"
+	"github.com/adedaryorh/bookstore-app/pkg/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// useStandInProvider points enrichment at a local server answering Open
+// Library requests for a single ISBN.
+func useStandInProvider(t *testing.T, onCreate bool) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("bibkeys") != "ISBN:9780441013593" {
+			w.Write([]byte(`{}`))
+			return
+		}
+		w.Write([]byte(`{"ISBN:9780441013593": {"title": "Dune", "authors": [{"name": "Frank Herbert"}],
+			"publish_date": "1965", "subjects": [{"name": "Science fiction"}],
+			"cover": {"large": "https://covers.example/dune.jpg"}}}`))
+	}))
+	UseEnrichment(&enrich.OpenLibrary{BaseURL: srv.URL, Client: srv.Client()}, onCreate)
+	t.Cleanup(func() {
+		UseEnrichment(nil, false)
+		srv.Close()
+	})
+}
+
+func TestEnrichBook(t *testing.T) {
+	useStandInProvider(t, false)
+	book := &models.Book{Title: "Dune (hardback)", Author: "", ISBN: "0441013597"}
+	book.CreateBook(context.Background())
+	defer models.DeleteBook(context.Background(), book.ID)
+
+	router := httprouter.New()
+	router.POST("/book/:bookId/enrich", EnrichBook)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/book/"+strconv.Itoa(int(book.ID))+"/enrich", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	var resp struct {
+		Book    models.Book `json:"book"`
+		Source  string      `json:"source"`
+		Updated []string    `json:"updated"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	if resp.Source != "openlibrary" || len(resp.Updated) != 4 {
+		t.Errorf("wrong summary: %+v", resp)
+	}
+	saved, err := models.GetBookByID(models.UsePrimary(context.Background()), book.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Title != "Dune (hardback)" || saved.Author != "Frank Herbert" || saved.CoverURL == nil {
+		t.Errorf("blank fields not filled, or title overwritten: %+v", saved)
+	}
+}
+
+// providerFunc adapts a function to an enrich.Provider.
+type providerFunc func(ctx context.Context, isbn string) (*enrich.Metadata, error)
+
+func (f providerFunc) Lookup(ctx context.Context, isbn string) (*enrich.Metadata, error) {
+	return f(ctx, isbn)
+}
+
+func TestEnrichBookKeepsEditsMadeDuringTheLookup(t *testing.T) {
+	book := &models.Book{Title: "Slow lookup", Author: "", ISBN: "9780441013593"}
+	book.CreateBook(context.Background())
+	defer models.DeleteBook(context.Background(), book.ID)
+	UseEnrichment(providerFunc(func(ctx context.Context, _ string) (*enrich.Metadata, error) {
+		// Someone edits the book while the source is asked.
+		edited := *book
+		price := 9.99
+		edited.Price = &price
+		if err := edited.UpdateBook(ctx); err != nil {
+			t.Error(err)
+		}
+		return &enrich.Metadata{Source: "stand-in", Authors: []string{"Frank Herbert"}}, nil
+	}), false)
+	t.Cleanup(func() { UseEnrichment(nil, false) })
+
+	router := httprouter.New()
+	router.POST("/book/:bookId/enrich", EnrichBook)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/book/"+strconv.Itoa(int(book.ID))+"/enrich", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	saved, err := models.GetBookByID(models.UsePrimary(context.Background()), book.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Author != "Frank Herbert" || saved.Price == nil || *saved.Price != 9.99 {
+		t.Errorf("the edit or the enrichment was lost: %+v", saved)
+	}
+}
+
+func TestEnrichBookErrors(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/book/:bookId/enrich", EnrichBook)
+	post := func(path string) int {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, path, nil))
+		return rr.Code
+	}
+
+	if code := post("/book/1/enrich"); code != http.StatusNotImplemented {
+		t.Errorf("unconfigured: got %v want %v", code, http.StatusNotImplemented)
+	}
+
+	useStandInProvider(t, false)
+	unknown := &models.Book{Title: "Unknown", Author: "Nobody", ISBN: "9780000000026"}
+	unknown.CreateBook(context.Background())
+	defer models.DeleteBook(context.Background(), unknown.ID)
+	if code := post("/book/" + strconv.Itoa(int(unknown.ID)) + "/enrich"); code != http.StatusNotFound {
+		t.Errorf("unknown ISBN: got %v want %v", code, http.StatusNotFound)
+	}
+	if code := post("/book/abc/enrich"); code != http.StatusBadRequest {
+		t.Errorf("invalid ID: got %v want %v", code, http.StatusBadRequest)
+	}
+}
+
+func TestCreateBookEnriches(t *testing.T) {
+	useStandInProvider(t, true)
+	rr := httptest.NewRecorder()
+	CreateBook(rr, httptest.NewRequest(http.MethodPost, "/book", strings.NewReader(`{"isbn": "978-0-441-01359-3"}`)), nil)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusCreated)
+	}
+	var created models.Book
+	json.Unmarshal(rr.Body.Bytes(), &created)
+	defer models.DeleteBook(context.Background(), created.ID)
+	if created.Title != "Dune" || created.Author != "Frank Herbert" || created.PublicationYear != "1965" {
+		t.Errorf("new book not enriched: %+v", created)
+	}
+}
@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/adedaryorh/bookstore-app/pkg/bookio"
+	"github.com/adedaryorh/bookstore-app/pkg/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// exportFormats maps each export format to its content type and file
+// extension.
+var exportFormats = map[string]struct{ contentType, ext string }{
+	"csv":     {"text/csv; charset=utf-8", "csv"},
+	"ndjson":  {"application/x-ndjson", "ndjson"},
+	"json":    {"application/json", "json"},
+	"onix":    {"application/xml", "xml"},
+	"marc":    {"application/marc", "mrc"},
+	"marcxml": {"application/marcxml+xml", "xml"},
+	"xlsx":    {"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "xlsx"},
+}
+
+var (
+	// onixSender names this store as the sender of ONIX messages.
+	onixSender = "bookstore-app"
+	// defaultCurrency is the currency Book.Price is stored in. ONIX exports
+	// always label prices with it; an import's currency parameter only
+	// chooses which of a product's prices to read.
+	defaultCurrency = bookio.DefaultCurrency
+)
+
+// UseONIX sets the sender name and default price currency for ONIX
+// imports and exports.
+func UseONIX(sender, currency string) {
+	onixSender = sender
+	defaultCurrency = currency
+}
+
+func newExportWriter(format string, w io.Writer) (bookio.Writer, error) {
+	switch format {
+	case "csv":
+		return bookio.NewCSVWriter(w)
+	case "ndjson":
+		return bookio.NewNDJSONWriter(w), nil
+	case "onix":
+		return bookio.NewONIXWriter(w, onixSender, defaultCurrency), nil
+	case "marc":
+		return bookio.NewMARCWriter(w), nil
+	case "marcxml":
+		return bookio.NewMARCXMLWriter(w), nil
+	case "xlsx":
+		return bookio.NewXLSXWriter(w)
+	default:
+		return bookio.NewJSONWriter(w), nil
+	}
+}
+
+// ExportBooks streams the books matching the list filters as a download,
+// reading them from a database cursor so memory use is flat however large
+// the catalog is. Large exports outlast the server's write timeout, so it
+// is lifted once the request is known to be good.
+func ExportBooks(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	filter, err := parseBookFilter(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	spec, ok := exportFormats[format]
+	if !ok {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("Unsupported export format %q", format))
+		return
+	}
+	// Prices are not converted, so the only currency they can be exported
+	// in is the one they are stored in.
+	if c := r.URL.Query().Get("currency"); c != "" && !strings.EqualFold(c, defaultCurrency) {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("Prices are stored in %s and can't be exported in %q", defaultCurrency, c))
+		return
+	}
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	// Headers are sent with the first book, so a query that fails up front
+	// still gets a proper error response.
+	var out bookio.Writer
+	start := func() error {
+		w.Header().Set("Content-Type", spec.contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="books.%s"`, spec.ext))
+		out, err = newExportWriter(format, w)
+		return err
+	}
+	count := 0
+	err = models.EachBook(r.Context(), filter, func(b *models.Book) error {
+		if out == nil {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		count++
+		return out.Write(b)
+	})
+	if err == nil && out == nil {
+		err = start()
+	}
+	if err == nil {
+		err = out.Close()
+	}
+
+	switch {
+	case err == nil:
+		slog.InfoContext(r.Context(), "books exported", "format", format, "books", count)
+	case out == nil:
+		writeModelError(w, r, err, "Failed to export books")
+	default:
+		// The status line has gone out; dropping the connection is the only
+		// way left to tell the client the file is incomplete.
+		slog.ErrorContext(r.Context(), "export interrupted", "format", format, "books", count, "error", err)
+		panic(http.ErrAbortHandler)
+	}
+}
@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/adedaryorh/bookstore-app/pkg/models"
+)
+
+func TestExportBooks(t *testing.T) {
+	genre := "Export Test"
+	book := &models.Book{Title: "Exported", Author: "Export Author", ISBN: "9780000000019", Genre: &genre}
+	book.CreateBook(context.Background())
+	defer models.DeleteBook(context.Background(), book.ID)
+
+	rr := httptest.NewRecorder()
+	ExportBooks(rr, httptest.NewRequest(http.MethodGet, "/books/export?format=ndjson&genre=export+test", nil), nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if ctype := rr.Header().Get("Content-Type"); ctype != "application/x-ndjson" {
+		t.Errorf("handler returned wrong content type: got %v want %v", ctype, "application/x-ndjson")
+	}
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("filter not applied: got %d books want 1", len(lines))
+	}
+	var got models.Book
+	if err := json.Unmarshal([]byte(lines[0]), &got); err != nil || got.ID != book.ID {
+		t.Errorf("got %+v, %v want book %d", got, err, book.ID)
+	}
+
+	rr = httptest.NewRecorder()
+	ExportBooks(rr, httptest.NewRequest(http.MethodGet, "/books/export?isbn=none", nil), nil)
+	if body := rr.Body.String(); !strings.HasPrefix(body, "id,title,author,isbn") || strings.Count(body, "\n") != 1 {
+		t.Errorf("empty CSV export should only have a header: %q", body)
+	}
+}
+
+func TestExportBooksInvalidRequest(t *testing.T) {
+	for _, query := range []string{"format=pdf", "updated_since=yesterday", "format=onix&currency=XXX"} {
+		rr := httptest.NewRecorder()
+		ExportBooks(rr, httptest.NewRequest(http.MethodGet, "/books/export?"+query, nil), nil)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v", query, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
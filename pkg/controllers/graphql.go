@@ -0,0 +1,227 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/julienschmidt/httprouter"
+)
+
+// Limits on the queries /graphql runs, checked before anything is fetched.
+var (
+	graphQLMaxDepth      = 10
+	graphQLMaxComplexity = 5000
+)
+
+// UseGraphQL sets how deeply GraphQL selections may nest and how much a
+// query may cost, as complexity counts it.
+func UseGraphQL(maxDepth, maxComplexity int) {
+	graphQLMaxDepth = maxDepth
+	graphQLMaxComplexity = maxComplexity
+}
+
+// maxGraphQLRequest bounds the body of a GraphQL request.
+const maxGraphQLRequest = 1 << 20
+
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// GraphQL runs a GraphQL query or mutation, sent as a JSON body or, for
+// queries only, in the query string. Requests that can't run at all are
+// answered with 400; errors from resolving fields come back with 200 beside
+// the data that could be resolved, as GraphQL clients expect.
+func GraphQL(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var req graphQLRequest
+	if r.Method == http.MethodGet {
+		q := r.URL.Query()
+		req.Query, req.OperationName = q.Get("query"), q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				writeGraphQLErrors(w, http.StatusBadRequest, "Invalid variables")
+				return
+			}
+		}
+	} else if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxGraphQLRequest)).Decode(&req); err != nil {
+		writeGraphQLErrors(w, http.StatusBadRequest, "Invalid JSON format")
+		return
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		writeGraphQLErrors(w, http.StatusBadRequest, "A query is required")
+		return
+	}
+
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{Body: []byte(req.Query), Name: "GraphQL request"})})
+	if err != nil {
+		writeGraphQLResult(w, http.StatusBadRequest, &graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+		return
+	}
+	if v := graphql.ValidateDocument(&schema, doc, nil); !v.IsValid {
+		writeGraphQLResult(w, http.StatusBadRequest, &graphql.Result{Errors: v.Errors})
+		return
+	}
+	op := operation(doc, req.OperationName)
+	switch {
+	case op == nil && req.OperationName == "":
+		writeGraphQLErrors(w, http.StatusBadRequest, "An operationName is required to pick one of several operations")
+		return
+	case op == nil:
+		writeGraphQLErrors(w, http.StatusBadRequest, "Unknown operation "+strconv.Quote(req.OperationName))
+		return
+	}
+	if op.Operation != ast.OperationTypeQuery && r.Method == http.MethodGet {
+		w.Header().Set("Allow", http.MethodPost)
+		writeGraphQLErrors(w, http.StatusMethodNotAllowed, "Mutations must be sent with POST")
+		return
+	}
+	cost := newCostCounter(doc, op, req.Variables)
+	if depth := cost.depth(op.SelectionSet); depth > graphQLMaxDepth {
+		writeGraphQLErrors(w, http.StatusBadRequest, fmt.Sprintf("Query is nested %d levels deep, at most %d are allowed", depth, graphQLMaxDepth))
+		return
+	}
+	if c := cost.complexity(op.SelectionSet); c > graphQLMaxComplexity {
+		writeGraphQLErrors(w, http.StatusBadRequest, fmt.Sprintf("Query complexity is %d, at most %d is allowed", c, graphQLMaxComplexity))
+		return
+	}
+
+	result := graphql.Execute(graphql.ExecuteParams{
+		Schema:        schema,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       withLoaders(r.Context()),
+	})
+	writeGraphQLResult(w, http.StatusOK, result)
+}
+
+func writeGraphQLResult(w http.ResponseWriter, status int, result *graphql.Result) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
+
+func writeGraphQLErrors(w http.ResponseWriter, status int, message string) {
+	writeGraphQLResult(w, status, &graphql.Result{Errors: gqlerrors.FormatErrors(fmt.Errorf("%s", message))})
+}
+
+// operation returns the operation of doc to run: the one named, or the
+// only one.
+func operation(doc *ast.Document, name string) *ast.OperationDefinition {
+	var found *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if name == "" && found != nil {
+			return nil
+		}
+		if name == "" || (op.Name != nil && op.Name.Value == name) {
+			found = op
+		}
+	}
+	return found
+}
+
+// costCounter measures a query before it runs. Depth counts the fields
+// nested in each other; complexity counts every field the query could
+// resolve, multiplying what lists select by the page size they ask for.
+// Introspection fields are free, since the schema bounds them.
+type costCounter struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+}
+
+func newCostCounter(doc *ast.Document, op *ast.OperationDefinition, variables map[string]interface{}) costCounter {
+	c := costCounter{fragments: map[string]*ast.FragmentDefinition{}, variables: map[string]interface{}{}}
+	for _, def := range doc.Definitions {
+		if f, ok := def.(*ast.FragmentDefinition); ok {
+			c.fragments[f.Name.Value] = f
+		}
+	}
+	// Variables the request leaves out take the operation's defaults, as
+	// they will when it runs.
+	for _, def := range op.VariableDefinitions {
+		if v, ok := def.DefaultValue.(*ast.IntValue); ok {
+			if n, err := strconv.Atoi(v.Value); err == nil {
+				c.variables[def.Variable.Name.Value] = float64(n)
+			}
+		}
+	}
+	maps.Copy(c.variables, variables)
+	return c
+}
+
+// fields lists the fields of set, looking into fragments. Validation has
+// ruled out fragment cycles.
+func (c costCounter) fields(set *ast.SelectionSet) []*ast.Field {
+	if set == nil {
+		return nil
+	}
+	var out []*ast.Field
+	for _, sel := range set.Selections {
+		switch sel := sel.(type) {
+		case *ast.Field:
+			if !strings.HasPrefix(sel.Name.Value, "__") {
+				out = append(out, sel)
+			}
+		case *ast.InlineFragment:
+			out = append(out, c.fields(sel.SelectionSet)...)
+		case *ast.FragmentSpread:
+			if f := c.fragments[sel.Name.Value]; f != nil {
+				out = append(out, c.fields(f.SelectionSet)...)
+			}
+		}
+	}
+	return out
+}
+
+func (c costCounter) depth(set *ast.SelectionSet) int {
+	deepest := 0
+	for _, f := range c.fields(set) {
+		deepest = max(deepest, 1+c.depth(f.SelectionSet))
+	}
+	return deepest
+}
+
+func (c costCounter) complexity(set *ast.SelectionSet) int {
+	total := 0
+	for _, f := range c.fields(set) {
+		total += 1 + c.pageSize(f)*c.complexity(f.SelectionSet)
+	}
+	return total
+}
+
+// pageSize is the limit a field asks for, if it takes one, or 1.
+func (c costCounter) pageSize(f *ast.Field) int {
+	size := 1
+	switch f.Name.Value {
+	case "books", "history":
+		size = defaultPageLimit
+	}
+	for _, arg := range f.Arguments {
+		if arg.Name.Value != "limit" {
+			continue
+		}
+		switch v := arg.Value.(type) {
+		case *ast.IntValue:
+			size, _ = strconv.Atoi(v.Value)
+		case *ast.Variable:
+			if n, ok := c.variables[v.Name.Value].(float64); ok {
+				size = int(n)
+			}
+		}
+	}
+	return min(max(size, 1), maxPageLimit)
+}
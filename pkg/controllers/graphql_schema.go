@@ -0,0 +1,611 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adedaryorh/bookstore-app/pkg/dataloader"
+	"github.com/adedaryorh/bookstore-app/pkg/models"
+	"github.com/graphql-go/graphql"
+)
+
+// author is the source of the Author type. Authors aren't stored on their
+// own; an author is the books sharing a name, ignoring case.
+type author struct {
+	Name string
+}
+
+// fieldChange is the source of the FieldChange type.
+type fieldChange struct {
+	Field string
+	// OldValue and NewValue are JSON text, or nil.
+	OldValue interface{}
+	NewValue interface{}
+}
+
+// page is a slice of a list, as requested with limit and offset.
+type page struct {
+	Limit, Offset int
+}
+
+// loaders batch the lookups of one GraphQL request.
+type loaders struct {
+	books       *dataloader.Loader[uint, *models.Book]
+	authorBooks *dataloader.Loader[authorPage, []models.Book]
+	authorCount *dataloader.Loader[string, int]
+	history     *dataloader.Loader[historyPage, []models.AuditEntry]
+}
+
+type authorPage struct {
+	Author string
+	page
+}
+
+type historyPage struct {
+	BookID uint
+	page
+}
+
+type loadersKey struct{}
+
+func withLoaders(ctx context.Context) context.Context {
+	l := &loaders{
+		books: dataloader.New(ctx, models.GetBooksByIDs),
+		authorBooks: dataloader.New(ctx, func(ctx context.Context, keys []authorPage) (map[authorPage][]models.Book, error) {
+			out := map[authorPage][]models.Book{}
+			for p, authors := range groupPages(keys, func(k authorPage) (page, string) { return k.page, k.Author }) {
+				books, err := models.GetBooksByAuthors(ctx, authors, p.Limit, p.Offset)
+				if err != nil {
+					return nil, err
+				}
+				for _, a := range authors {
+					out[authorPage{a, p}] = books[strings.ToLower(a)]
+				}
+			}
+			return out, nil
+		}),
+		authorCount: dataloader.New(ctx, func(ctx context.Context, authors []string) (map[string]int, error) {
+			counts, err := models.CountBooksByAuthors(ctx, authors)
+			if err != nil {
+				return nil, err
+			}
+			out := make(map[string]int, len(authors))
+			for _, a := range authors {
+				out[a] = counts[strings.ToLower(a)]
+			}
+			return out, nil
+		}),
+		history: dataloader.New(ctx, func(ctx context.Context, keys []historyPage) (map[historyPage][]models.AuditEntry, error) {
+			out := map[historyPage][]models.AuditEntry{}
+			for p, ids := range groupPages(keys, func(k historyPage) (page, uint) { return k.page, k.BookID }) {
+				entries, err := models.GetBookHistories(ctx, ids, p.Limit, p.Offset)
+				if err != nil {
+					return nil, err
+				}
+				for _, id := range ids {
+					out[historyPage{id, p}] = entries[id]
+				}
+			}
+			return out, nil
+		}),
+	}
+	l.books.MaxBatch = maxPageLimit
+	l.authorBooks.MaxBatch = maxPageLimit
+	l.authorCount.MaxBatch = maxPageLimit
+	l.history.MaxBatch = maxPageLimit
+	return context.WithValue(ctx, loadersKey{}, l)
+}
+
+func loadersFrom(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey{}).(*loaders)
+}
+
+// groupPages groups keys asking for the same page, which are then fetched
+// in one query.
+func groupPages[K any, V any](keys []K, split func(K) (page, V)) map[page][]V {
+	out := map[page][]V{}
+	for _, k := range keys {
+		p, v := split(k)
+		out[p] = append(out[p], v)
+	}
+	return out
+}
+
+// gqlError is an error reported to GraphQL clients with the code and HTTP
+// status the REST endpoints would have answered with.
+type gqlError struct {
+	message    string
+	extensions map[string]interface{}
+}
+
+func (e *gqlError) Error() string {
+	return e.message
+}
+
+func (e *gqlError) Extensions() map[string]interface{} {
+	return e.extensions
+}
+
+var errorCodes = map[int]string{
+	http.StatusBadRequest:          "BAD_USER_INPUT",
+	http.StatusNotFound:            "NOT_FOUND",
+	http.StatusConflict:            "CONFLICT",
+	http.StatusServiceUnavailable:  "UNAVAILABLE",
+	http.StatusInternalServerError: "INTERNAL_SERVER_ERROR",
+}
+
+func newGQLError(status int, message string) *gqlError {
+	return &gqlError{message, map[string]interface{}{"code": errorCodes[status], "status": status}}
+}
+
+// modelGQLError maps an error from the models package as writeModelError
+// does.
+func modelGQLError(ctx context.Context, err error, message string) error {
+	status, msg := modelErrorStatus(ctx, err, message)
+	e := newGQLError(status, msg)
+	var dup *models.DuplicateISBNError
+	if errors.As(err, &dup) && dup.BookID != 0 {
+		e.extensions["book_id"] = strconv.FormatUint(uint64(dup.BookID), 10)
+	}
+	return e
+}
+
+func idArg(p graphql.ResolveParams, name string) (uint, error) {
+	id, err := strconv.ParseUint(fmt.Sprint(p.Args[name]), 10, 32)
+	if err != nil {
+		return 0, newGQLError(http.StatusBadRequest, "Invalid "+name)
+	}
+	return uint(id), nil
+}
+
+// pageArgs reads the limit and offset arguments, bounded as parsePage
+// bounds them.
+func pageArgs(p graphql.ResolveParams) (page, error) {
+	limit, _ := p.Args["limit"].(int)
+	offset, _ := p.Args["offset"].(int)
+	if limit < 1 || limit > maxPageLimit {
+		return page{}, newGQLError(http.StatusBadRequest, fmt.Sprintf("Invalid limit, want 1 to %d", maxPageLimit))
+	}
+	if offset < 0 {
+		return page{}, newGQLError(http.StatusBadRequest, "Invalid offset")
+	}
+	return page{limit, offset}, nil
+}
+
+var pageFieldArgs = graphql.FieldConfigArgument{
+	"limit":  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultPageLimit, Description: fmt.Sprintf("Page size, 1 to %d", maxPageLimit)},
+	"offset": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0, Description: "Entries to skip"},
+}
+
+// bookThunk resolves to the book loaded by thunk, or null if there is none.
+func bookThunk(thunk func() (*models.Book, bool, error)) func() (interface{}, error) {
+	return func() (interface{}, error) {
+		book, found, err := thunk()
+		if err != nil || !found {
+			return nil, err
+		}
+		return book, nil
+	}
+}
+
+var (
+	fieldChangeType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "FieldChange",
+		Description: "A field's value before and after a change, as JSON.",
+		Fields: graphql.Fields{
+			"field":    &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"oldValue": &graphql.Field{Type: graphql.String, Description: "JSON value before the change; null for new books."},
+			"newValue": &graphql.Field{Type: graphql.String, Description: "JSON value after the change; null for deleted books."},
+		},
+	})
+
+	auditEntryType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "AuditEntry",
+		Description: "One change in a book's audit trail.",
+		Fields: graphql.Fields{
+			"revision": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"action":   &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"actor":    &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"actorVerified": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.Boolean),
+				Description: "False when the actor is only who the caller claimed to be.",
+			},
+			"requestId":  &graphql.Field{Type: graphql.String},
+			"occurredAt": &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+			"changes": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(fieldChangeType))),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					entry := p.Source.(models.AuditEntry)
+					out := []fieldChange{}
+					for field, c := range entry.Changes {
+						out = append(out, fieldChange{field, jsonText(c.Old), jsonText(c.New)})
+					}
+					sort.Slice(out, func(i, j int) bool { return out[i].Field < out[j].Field })
+					return out, nil
+				},
+			},
+		},
+	})
+
+	authorType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Author",
+		Description: "The books sharing an author name, ignoring case.",
+		Fields: graphql.Fields{
+			"name": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"bookCount": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Int),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					thunk := loadersFrom(p.Context).authorCount.Load(p.Source.(author).Name)
+					return func() (interface{}, error) {
+						count, _, err := thunk()
+						return count, err
+					}, nil
+				},
+			},
+		},
+	})
+
+	bookType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Book",
+		Fields: graphql.Fields{
+			"id":              &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"title":           &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"isbn":            &graphql.Field{Type: graphql.NewNonNull(graphql.String), Description: "ISBN-13, or empty."},
+			"publicationYear": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"genre":           &graphql.Field{Type: graphql.String},
+			"price":           &graphql.Field{Type: graphql.Float},
+			"coverUrl":        &graphql.Field{Type: graphql.String},
+			"createdAt":       &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+			"updatedAt":       &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+			"author": &graphql.Field{
+				Type: graphql.NewNonNull(authorType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return author{p.Source.(*models.Book).Author}, nil
+				},
+			},
+			"history": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(auditEntryType))),
+				Description: "The book's audit trail, newest first.",
+				Args:        pageFieldArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					pg, err := pageArgs(p)
+					if err != nil {
+						return nil, err
+					}
+					thunk := loadersFrom(p.Context).history.Load(historyPage{p.Source.(*models.Book).ID, pg})
+					return func() (interface{}, error) {
+						entries, _, err := thunk()
+						return append([]models.AuditEntry{}, entries...), err
+					}, nil
+				},
+			},
+		},
+	})
+
+	bookPageType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "BookPage",
+		Description: "A page of books, by ID.",
+		Fields: graphql.Fields{
+			"items": &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(bookType)))},
+			"totalCount": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.Int),
+				Description: "Books matching the filter, on every page.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					count, _, err := models.CatalogVersion(p.Context, p.Source.(*bookPage).filter)
+					if err != nil {
+						return nil, modelGQLError(p.Context, err, "Failed to count books")
+					}
+					return count, nil
+				},
+			},
+			"hasNextPage": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+		},
+	})
+
+	bookFilterType = graphql.NewInputObject(graphql.InputObjectConfig{
+		Name:        "BookFilter",
+		Description: "The filters of GET /books.",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"title":           &graphql.InputObjectFieldConfig{Type: graphql.String, Description: "Title contains, ignoring case"},
+			"author":          &graphql.InputObjectFieldConfig{Type: graphql.String, Description: "Author, ignoring case"},
+			"genre":           &graphql.InputObjectFieldConfig{Type: graphql.String, Description: "Genre, ignoring case"},
+			"isbn":            &graphql.InputObjectFieldConfig{Type: graphql.String, Description: "ISBN-10 or ISBN-13"},
+			"publicationYear": &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"updatedSince":    &graphql.InputObjectFieldConfig{Type: graphql.DateTime, Description: "Changed at or after this time"},
+		},
+	})
+
+	bookInputType = graphql.NewInputObject(graphql.InputObjectConfig{
+		Name:        "BookInput",
+		Description: "A book's fields, as sent to POST /book and PUT /book/:id.",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"title":           &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"author":          &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"isbn":            &graphql.InputObjectFieldConfig{Type: graphql.String, Description: "ISBN-10 or ISBN-13, hyphens allowed"},
+			"publicationYear": &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"genre":           &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"price":           &graphql.InputObjectFieldConfig{Type: graphql.Float},
+		},
+	})
+)
+
+// bookPage is the source of the BookPage type.
+type bookPage struct {
+	Items       []*models.Book
+	HasNextPage bool
+	filter      models.BookFilter
+}
+
+func bookList(books []models.Book) []*models.Book {
+	out := make([]*models.Book, len(books))
+	for i := range books {
+		out[i] = &books[i]
+	}
+	return out
+}
+
+func jsonText(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+func bookFilterArg(p graphql.ResolveParams) models.BookFilter {
+	in, _ := p.Args["filter"].(map[string]interface{})
+	str := func(name string) string {
+		s, _ := in[name].(string)
+		return s
+	}
+	f := models.BookFilter{
+		Title:           str("title"),
+		Author:          str("author"),
+		Genre:           str("genre"),
+		ISBN:            str("isbn"),
+		PublicationYear: str("publicationYear"),
+	}
+	if t, ok := in["updatedSince"].(time.Time); ok {
+		f.UpdatedSince = t
+	}
+	return f
+}
+
+func bookInputArg(p graphql.ResolveParams) models.Book {
+	in := p.Args["input"].(map[string]interface{})
+	book := models.Book{}
+	book.Title, _ = in["title"].(string)
+	book.Author, _ = in["author"].(string)
+	book.ISBN, _ = in["isbn"].(string)
+	book.PublicationYear, _ = in["publicationYear"].(string)
+	if s, ok := in["genre"].(string); ok {
+		book.Genre = &s
+	}
+	if f, ok := in["price"].(float64); ok {
+		book.Price = &f
+	}
+	return book
+}
+
+var queryType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Query",
+	Fields: graphql.Fields{
+		"book": &graphql.Field{
+			Type:        bookType,
+			Description: "A book by ID, or with asOf, the book as it was then. Null if there is none.",
+			Args: graphql.FieldConfigArgument{
+				"id":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				"asOf": &graphql.ArgumentConfig{Type: graphql.DateTime},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				id, err := idArg(p, "id")
+				if err != nil {
+					return nil, err
+				}
+				if asOf, ok := p.Args["asOf"].(time.Time); ok {
+					book, err := models.BookAsOf(p.Context, id, asOf)
+					if errors.Is(err, models.ErrBookNotFound) {
+						return nil, nil
+					}
+					if err != nil {
+						return nil, modelGQLError(p.Context, err, "Failed to fetch book")
+					}
+					return book, nil
+				}
+				return bookThunk(loadersFrom(p.Context).books.Load(id)), nil
+			},
+		},
+		"bookByIsbn": &graphql.Field{
+			Type:        bookType,
+			Description: "A book by ISBN-10 or ISBN-13, with or without hyphens. Null if there is none.",
+			Args: graphql.FieldConfigArgument{
+				"isbn": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				book, err := models.GetBookByISBN(p.Context, p.Args["isbn"].(string))
+				if errors.Is(err, models.ErrBookNotFound) {
+					return nil, nil
+				}
+				if err != nil {
+					return nil, modelGQLError(p.Context, err, "Failed to fetch book")
+				}
+				return book, nil
+			},
+		},
+		"books": &graphql.Field{
+			Type:        graphql.NewNonNull(bookPageType),
+			Description: "A page of the books matching filter.",
+			Args: graphql.FieldConfigArgument{
+				"filter": &graphql.ArgumentConfig{Type: bookFilterType},
+				"limit":  pageFieldArgs["limit"],
+				"offset": pageFieldArgs["offset"],
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				pg, err := pageArgs(p)
+				if err != nil {
+					return nil, err
+				}
+				f := bookFilterArg(p)
+				// One more than asked tells whether there is a next page.
+				books, err := models.GetBooksPage(p.Context, f, pg.Limit+1, pg.Offset)
+				if err != nil {
+					return nil, modelGQLError(p.Context, err, "Failed to list books")
+				}
+				res := &bookPage{HasNextPage: len(books) > pg.Limit, filter: f}
+				if res.HasNextPage {
+					books = books[:pg.Limit]
+				}
+				res.Items = bookList(books)
+				// Books fetched here needn't be fetched again by ID.
+				for _, b := range res.Items {
+					loadersFrom(p.Context).books.Prime(b.ID, b)
+				}
+				return res, nil
+			},
+		},
+		"author": &graphql.Field{
+			Type:        graphql.NewNonNull(authorType),
+			Description: "The books by an author, ignoring case.",
+			Args: graphql.FieldConfigArgument{
+				"name": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return author{p.Args["name"].(string)}, nil
+			},
+		},
+	},
+})
+
+// The mutations do what the REST endpoints of the same names do.
+var mutationType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Mutation",
+	Fields: graphql.Fields{
+		"createBook": &graphql.Field{
+			Type:        graphql.NewNonNull(bookType),
+			Description: "Add a book, or with upsert, replace the book with the same ISBN.",
+			Args: graphql.FieldConfigArgument{
+				"input":  &graphql.ArgumentConfig{Type: graphql.NewNonNull(bookInputType)},
+				"upsert": &graphql.ArgumentConfig{Type: graphql.Boolean, DefaultValue: false},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				book := bookInputArg(p)
+				if err := book.NormalizeISBN(); err != nil {
+					return nil, modelGQLError(p.Context, err, "Failed to create book")
+				}
+				upsert := p.Args["upsert"].(bool)
+				if upsert && book.ISBN == "" {
+					return nil, newGQLError(http.StatusBadRequest, "An isbn is required to upsert")
+				}
+				enrichNewBook(p.Context, &book)
+				var err error
+				if upsert {
+					_, err = models.UpsertBookByISBN(p.Context, &book, false)
+				} else {
+					err = book.CreateBook(p.Context)
+				}
+				if err != nil {
+					return nil, modelGQLError(p.Context, err, "Failed to create book")
+				}
+				return &book, nil
+			},
+		},
+		"updateBook": &graphql.Field{
+			Type:        graphql.NewNonNull(bookType),
+			Description: "Replace a book's fields.",
+			Args: graphql.FieldConfigArgument{
+				"id":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(bookInputType)},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				id, err := idArg(p, "id")
+				if err != nil {
+					return nil, err
+				}
+				existing, err := models.GetBookByID(models.UsePrimary(p.Context), id)
+				if err != nil {
+					return nil, modelGQLError(p.Context, err, "Failed to fetch book")
+				}
+				book := bookInputArg(p)
+				book.ID, book.CreatedAt = existing.ID, existing.CreatedAt
+				if err := book.UpdateBook(p.Context); err != nil {
+					return nil, modelGQLError(p.Context, err, "Failed to update book")
+				}
+				return &book, nil
+			},
+		},
+		"deleteBook": &graphql.Field{
+			Type:        graphql.NewNonNull(bookType),
+			Description: "Delete a book and its cover, returning the book.",
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				id, err := idArg(p, "id")
+				if err != nil {
+					return nil, err
+				}
+				book, err := models.DeleteBook(p.Context, id)
+				if err != nil {
+					return nil, modelGQLError(p.Context, err, "Failed to delete book")
+				}
+				removeCover(p.Context, book.ID)
+				return book, nil
+			},
+		},
+		"revertBook": &graphql.Field{
+			Type:        graphql.NewNonNull(bookType),
+			Description: "Restore a book's fields from an earlier revision, as a new update.",
+			Args: graphql.FieldConfigArgument{
+				"id":       &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				"revision": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				id, err := idArg(p, "id")
+				if err != nil {
+					return nil, err
+				}
+				book, err := models.RevertBook(p.Context, id, p.Args["revision"].(int))
+				if err != nil {
+					return nil, modelGQLError(p.Context, err, "Failed to revert book")
+				}
+				return book, nil
+			},
+		},
+	},
+})
+
+// authorBooksField lists an author's books. It is added to Author once
+// Book, which refers to Author, exists.
+var authorBooksField = &graphql.Field{
+	Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(bookType))),
+	Description: "The author's books, by ID.",
+	Args:        pageFieldArgs,
+	Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+		pg, err := pageArgs(p)
+		if err != nil {
+			return nil, err
+		}
+		thunk := loadersFrom(p.Context).authorBooks.Load(authorPage{p.Source.(author).Name, pg})
+		return func() (interface{}, error) {
+			books, _, err := thunk()
+			return bookList(books), err
+		}, nil
+	},
+}
+
+// schema is the GraphQL schema served at /graphql.
+var schema = func() graphql.Schema {
+	authorType.AddFieldConfig("books", authorBooksField)
+	s, err := graphql.NewSchema(graphql.SchemaConfig{Query: queryType, Mutation: mutationType})
+	if err != nil {
+		panic(err)
+	}
+	return s
+}()
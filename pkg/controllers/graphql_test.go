@@ -0,0 +1,194 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/adedaryorh/bookstore-app/pkg/models"
+	"github.com/jinzhu/gorm"
+)
+
+type graphQLResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string                 `json:"message"`
+		Extensions map[string]interface{} `json:"extensions"`
+	} `json:"errors"`
+}
+
+func postGraphQL(t *testing.T, query string, variables map[string]interface{}) (int, graphQLResponse) {
+	t.Helper()
+	body, _ := json.Marshal(graphQLRequest{Query: query, Variables: variables})
+	rr := httptest.NewRecorder()
+	GraphQL(rr, httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body))), nil)
+	var resp graphQLResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding %s: %v", rr.Body, err)
+	}
+	return rr.Code, resp
+}
+
+// countQueries counts the SELECTs run until the returned func is called.
+func countQueries(t *testing.T) func() int64 {
+	var n atomic.Int64
+	name := "count_queries_" + t.Name()
+	models.Db.Callback().Query().After("gorm:query").Register(name, func(*gorm.Scope) { n.Add(1) })
+	return func() int64 {
+		models.Db.Callback().Query().Remove(name)
+		return n.Load()
+	}
+}
+
+func TestGraphQLBooks(t *testing.T) {
+	ctx := context.Background()
+	author := "GraphQL Author"
+	var ids []uint
+	for i, isbn := range []string{"9781234568009", "9781234568016", "9781234568023"} {
+		book := &models.Book{Title: fmt.Sprintf("GraphQL book %d", i), Author: author, ISBN: isbn}
+		if err := book.CreateBook(ctx); err != nil {
+			t.Fatal(err)
+		}
+		defer models.DeleteBook(ctx, book.ID)
+		ids = append(ids, book.ID)
+	}
+	book := &models.Book{ID: ids[0], Title: "GraphQL book renamed", Author: author, ISBN: "9781234568009"}
+	if err := book.UpdateBook(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	done := countQueries(t)
+	code, resp := postGraphQL(t, `query($author: String) {
+		books(filter: {author: $author}, limit: 2) {
+			totalCount
+			hasNextPage
+			items { id title author { name bookCount books(limit: 5) { id } } history { revision action } }
+		}
+	}`, map[string]interface{}{"author": author})
+	queries := done()
+	if code != http.StatusOK || len(resp.Errors) > 0 {
+		t.Fatalf("got %v %+v", code, resp)
+	}
+	var data struct {
+		Books struct {
+			TotalCount  int
+			HasNextPage bool
+			Items       []struct {
+				ID     string
+				Title  string
+				Author struct {
+					Name      string
+					BookCount int
+					Books     []struct{ ID string }
+				}
+				History []struct {
+					Revision int
+					Action   string
+				}
+			}
+		}
+	}
+	json.Unmarshal(resp.Data, &data)
+	page := data.Books
+	if page.TotalCount != 3 || !page.HasNextPage || len(page.Items) != 2 {
+		t.Fatalf("wrong page: %+v", page)
+	}
+	first := page.Items[0]
+	if first.Title != "GraphQL book renamed" || first.Author.BookCount != 3 || len(first.Author.Books) != 3 {
+		t.Errorf("wrong first book: %+v", first)
+	}
+	if len(first.History) != 2 || first.History[0].Action != models.AuditUpdated {
+		t.Errorf("wrong history, want newest first: %+v", first.History)
+	}
+	// The page, its count, and one batch each for the authors' books, their
+	// counts and the histories, however many books there are.
+	if queries > 5 {
+		t.Errorf("resolving the page took %d queries, want at most 5", queries)
+	}
+
+	// Aliases of the same field are batched too.
+	_, resp = postGraphQL(t, fmt.Sprintf(`{ a: book(id: %d) { title } b: book(id: %d) { title } c: book(id: 999999) { title } }`, ids[1], ids[2]), nil)
+	if string(resp.Data) != `{"a":{"title":"GraphQL book 1"},"b":{"title":"GraphQL book 2"},"c":null}` {
+		t.Errorf("got %s %+v", resp.Data, resp.Errors)
+	}
+}
+
+func TestGraphQLMutations(t *testing.T) {
+	code, resp := postGraphQL(t, `mutation($input: BookInput!) { createBook(input: $input) { id isbn author { name } } }`,
+		map[string]interface{}{"input": map[string]interface{}{"title": "GraphQL created", "author": "Author", "isbn": "978-1-234-56803-0", "price": 9.5}})
+	if code != http.StatusOK || len(resp.Errors) > 0 {
+		t.Fatalf("create: got %v %+v", code, resp)
+	}
+	var created struct {
+		CreateBook struct {
+			ID   string
+			ISBN string
+		}
+	}
+	json.Unmarshal(resp.Data, &created)
+	if created.CreateBook.ISBN != "9781234568030" {
+		t.Errorf("isbn should be normalized: %+v", created)
+	}
+	id := created.CreateBook.ID
+
+	// A second book with the ISBN conflicts, as with POST /book.
+	_, resp = postGraphQL(t, `mutation { createBook(input: {title: "Again", author: "Author", isbn: "9781234568030"}) { id } }`, nil)
+	if len(resp.Errors) != 1 || resp.Errors[0].Extensions["code"] != "CONFLICT" || resp.Errors[0].Extensions["book_id"] != id {
+		t.Errorf("duplicate: got %+v", resp.Errors)
+	}
+
+	_, resp = postGraphQL(t, fmt.Sprintf(`mutation { updateBook(id: %s, input: {title: "GraphQL updated", author: "Author", isbn: "9781234568030"}) { title } }`, id), nil)
+	if string(resp.Data) != `{"updateBook":{"title":"GraphQL updated"}}` {
+		t.Errorf("update: got %s %+v", resp.Data, resp.Errors)
+	}
+	_, resp = postGraphQL(t, fmt.Sprintf(`mutation { revertBook(id: %s, revision: 1) { title } }`, id), nil)
+	if string(resp.Data) != `{"revertBook":{"title":"GraphQL created"}}` {
+		t.Errorf("revert: got %s %+v", resp.Data, resp.Errors)
+	}
+	_, resp = postGraphQL(t, fmt.Sprintf(`mutation { deleteBook(id: %s) { title } }`, id), nil)
+	if string(resp.Data) != `{"deleteBook":{"title":"GraphQL created"}}` {
+		t.Errorf("delete: got %s %+v", resp.Data, resp.Errors)
+	}
+	_, resp = postGraphQL(t, fmt.Sprintf(`mutation { deleteBook(id: %s) { title } }`, id), nil)
+	if len(resp.Errors) != 1 || resp.Errors[0].Extensions["code"] != "NOT_FOUND" {
+		t.Errorf("deleting again: got %+v", resp.Errors)
+	}
+}
+
+func TestGraphQLLimits(t *testing.T) {
+	UseGraphQL(4, 500)
+	defer UseGraphQL(10, 5000)
+
+	tests := []struct {
+		name, query string
+		ok          bool
+	}{
+		{"shallow", `{ book(id: 1) { title author { name } } }`, true},
+		{"too deep", `{ book(id: 1) { author { books { author { books { id } } } } } }`, false},
+		{"too deep through a fragment", `{ book(id: 1) { ...f } } fragment f on Book { author { books { author { name } } } }`, false},
+		{"small page", `{ books(limit: 10) { items { title history(limit: 5) { revision } } } }`, true},
+		{"large pages", `{ books(limit: 100) { items { title history { revision } } } }`, false},
+		{"large pages by a variable's default", `query($l: Int = 500) { books(limit: $l) { items { history(limit: $l) { revision } } } }`, false},
+		{"small pages by a variable's default", `query($l: Int = 5) { books(limit: $l) { items { history(limit: $l) { revision } } } }`, true},
+		{"introspection is free", `{ __schema { types { name fields { name type { name ofType { name ofType { name } } } } } } }`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, resp := postGraphQL(t, tt.query, nil)
+			if got := code == http.StatusOK; got != tt.ok {
+				t.Errorf("got %v %+v", code, resp.Errors)
+			}
+		})
+	}
+
+	rr := httptest.NewRecorder()
+	GraphQL(rr, httptest.NewRequest(http.MethodGet, "/graphql?query="+`mutation+{+deleteBook(id:+1)+{+id+}+}`, nil), nil)
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("mutation over GET: got %v want %v", rr.Code, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,31 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/adedaryorh/bookstore-app/pkg/config"
+	"github.com/julienschmidt/httprouter"
+)
+
+// Ready reports whether the service can reach its database. Unlike /health it
+// fails while Postgres is down, so load balancers stop routing traffic here.
+func Ready(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := config.Ping(ctx); err != nil {
+		slog.WarnContext(r.Context(), "readiness check failed", "error", err)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{
+			"status": "unavailable",
+			"error":  "Database unavailable",
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": "ready"})
+}
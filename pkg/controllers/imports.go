@@ -0,0 +1,210 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adedaryorh/bookstore-app/pkg/bookio"
+	"github.com/adedaryorh/bookstore-app/pkg/importer"
+	"github.com/adedaryorh/bookstore-app/pkg/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// maxInlineErrors is how many row errors the import response lists; the
+// rest are in the downloadable report.
+const maxInlineErrors = 100
+
+// ImportBooks loads books from an uploaded file, updating the book with the
+// same ISBN or creating a new one for each row. The file is the request
+// body, or the "file" part of a multipart form, and is processed as it
+// streams in. With dry_run=true every row is checked but nothing is saved.
+//
+// CSV columns are matched to fields by header name; others can be mapped
+// with repeated map=<column>:<field> parameters.
+func ImportBooks(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	q := r.URL.Query()
+	dryRun := false
+	if v := q.Get("dry_run"); v != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			writeError(w, r, http.StatusBadRequest, "Invalid dry_run value")
+			return
+		}
+	}
+	mapping := map[string]string{}
+	for _, m := range q["map"] {
+		i := strings.LastIndex(m, ":")
+		if i <= 0 {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("Invalid mapping %q, want <column>:<field>", m))
+			return
+		}
+		mapping[m[:i]] = m[i+1:]
+	}
+	format := q.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+
+	body, err := uploadedFile(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer body.Close()
+
+	rep := importer.NewReport(format, dryRun)
+	var reader bookio.Reader
+	switch format {
+	case "csv":
+		cr, err := bookio.NewCSVReader(body, mapping)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "Invalid CSV: "+err.Error())
+			return
+		}
+		rep.IgnoredColumns = cr.Ignored
+		reader = cr
+	case "onix":
+		currency, err := priceCurrency(r)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		reader = bookio.NewONIXReader(body, currency)
+	case "marc":
+		reader = bookio.NewMARCReader(body)
+	case "marcxml":
+		reader = bookio.NewMARCXMLReader(body)
+	default:
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("Unsupported import format %q", format))
+		return
+	}
+
+	if err := importer.Run(r.Context(), reader, rep); err != nil {
+		if errors.Is(err, models.ErrDatabaseUnavailable) {
+			writeModelError(w, r, err, "Import failed")
+			return
+		}
+		writeError(w, r, http.StatusBadRequest, "Invalid "+format+": "+err.Error())
+		return
+	}
+	slog.InfoContext(r.Context(), "books imported", "import_id", rep.ID, "format", format, "dry_run", dryRun,
+		"rows", rep.Rows, "created", rep.Created, "updated", rep.Updated, "deleted", rep.Deleted, "failed", rep.Failed)
+
+	resp := *rep
+	if rep.Failed > 0 {
+		importReports.save(rep)
+		resp.ErrorReport = "/books/import/" + rep.ID + "/errors"
+		if len(resp.Errors) > maxInlineErrors {
+			resp.Errors = resp.Errors[:maxInlineErrors]
+			resp.ErrorsTruncated = true
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// priceCurrency is the currency whose price maps onto Book.Price in formats
+// that carry several prices per book, such as ONIX. It must be a
+// three-letter ISO 4217 code.
+func priceCurrency(r *http.Request) (string, error) {
+	c := r.URL.Query().Get("currency")
+	if c == "" {
+		return defaultCurrency, nil
+	}
+	if len(c) != 3 || strings.IndexFunc(c, func(r rune) bool { return (r < 'A' || r > 'Z') && (r < 'a' || r > 'z') }) >= 0 {
+		return "", fmt.Errorf("Invalid currency %q, want a three-letter ISO 4217 code", c)
+	}
+	return strings.ToUpper(c), nil
+}
+
+// uploadedFile returns the file in a multipart form's "file" part, or the
+// raw request body for any other content type.
+func uploadedFile(r *http.Request) (io.ReadCloser, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return r.Body, nil
+	}
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, errors.New("Invalid multipart form")
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, errors.New(`Missing "file" form field`)
+		}
+		if err != nil {
+			return nil, errors.New("Invalid multipart form")
+		}
+		if part.FormName() == "file" {
+			return part, nil
+		}
+		part.Close()
+	}
+}
+
+// GetImportErrors serves the row errors of a finished import as CSV.
+func GetImportErrors(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	rep := importReports.get(ps.ByName("importId"))
+	if rep == nil {
+		writeError(w, r, http.StatusNotFound, "Import report not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="import-%s-errors.csv"`, rep.ID))
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"line", "isbn", "title", "error"})
+	for _, e := range rep.Errors {
+		cw.Write([]string{strconv.Itoa(e.Line), bookio.CSVText(e.ISBN), bookio.CSVText(e.Title), bookio.CSVText(e.Error)})
+	}
+	cw.Flush()
+}
+
+// reportStore keeps recent import reports in memory so their errors can be
+// downloaded after the import request has finished.
+type reportStore struct {
+	mu      sync.Mutex
+	reports map[string]*importer.Report
+	limit   int
+	ttl     time.Duration
+}
+
+var importReports = &reportStore{reports: map[string]*importer.Report{}, limit: 100, ttl: 24 * time.Hour}
+
+func (s *reportStore) save(rep *importer.Report) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var oldest *importer.Report
+	for id, r := range s.reports {
+		if time.Since(r.StartedAt) > s.ttl {
+			delete(s.reports, id)
+		} else if oldest == nil || r.StartedAt.Before(oldest.StartedAt) {
+			oldest = r
+		}
+	}
+	if len(s.reports) >= s.limit && oldest != nil {
+		delete(s.reports, oldest.ID)
+	}
+	s.reports[rep.ID] = rep
+}
+
+func (s *reportStore) get(id string) *importer.Report {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rep := s.reports[id]
+	if rep == nil || time.Since(rep.StartedAt) > s.ttl {
+		return nil
+	}
+	return rep
+}
@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/adedaryorh/bookstore-app/pkg/importer"
+	"github.com/julienschmidt/httprouter"
+)
+
+func importRouter() *httprouter.Router {
+	router := httprouter.New()
+	router.POST("/books/import", ImportBooks)
+	router.GET("/books/import/:importId/errors", GetImportErrors)
+	return router
+}
+
+func TestImportBooksDryRun(t *testing.T) {
+	csv := "Name,Writer,isbn,price\n" +
+		"Import Dry Run,Some Author,978-0-00-000002-6,12.50\n" +
+		",No Title,9780000000033,1\n" +
+		"Bad Price,Someone,9780000000040,free\n" +
+		"Bad ISBN,Someone,9780000000041,5\n"
+	req := httptest.NewRequest(http.MethodPost, "/books/import?dry_run=true&map=Name:title&map=Writer:author", strings.NewReader(csv))
+	req.Header.Set("Content-Type", "text/csv")
+	rr := httptest.NewRecorder()
+	importRouter().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	var rep importer.Report
+	if err := json.Unmarshal(rr.Body.Bytes(), &rep); err != nil {
+		t.Fatalf("Response is not valid JSON: %v", err)
+	}
+	if !rep.DryRun || rep.Rows != 4 || rep.Failed != 3 || rep.Created+rep.Updated != 1 {
+		t.Errorf("wrong summary: %+v", rep)
+	}
+	if len(rep.Errors) != 3 || rep.Errors[0].Line != 3 || rep.Errors[1].Line != 4 || rep.Errors[2].Line != 5 {
+		t.Errorf("wrong row errors: %+v", rep.Errors)
+	}
+
+	rr = httptest.NewRecorder()
+	importRouter().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, rep.ErrorReport, nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("error report returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if lines := strings.Count(rr.Body.String(), "\n"); lines != 4 {
+		t.Errorf("error report has %d lines want 4:\n%s", lines, rr.Body)
+	}
+}
+
+func TestImportBooksMultipart(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, _ := mw.CreateFormFile("file", "catalog.csv")
+	part.Write([]byte("title,author,isbn\n,,\n"))
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/books/import", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rr := httptest.NewRecorder()
+	importRouter().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var rep importer.Report
+	json.Unmarshal(rr.Body.Bytes(), &rep)
+	if rep.Rows != 1 || rep.Failed != 1 {
+		t.Errorf("wrong summary: %+v", rep)
+	}
+}
+
+func TestImportBooksInvalidRequest(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		body  string
+	}{
+		{"missing columns", "", "title,author\nA,B\n"},
+		{"bad format", "?format=xlsx", "title,author,isbn\n"},
+		{"bad mapping", "?map=title", "title,author,isbn\n"},
+		{"bad dry_run", "?dry_run=maybe", "title,author,isbn\n"},
+		{"bad currency", "?format=onix&currency=euro", "<ONIXMessage/>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			importRouter().ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/books/import"+tt.query, strings.NewReader(tt.body)))
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+			}
+		})
+	}
+
+	rr := httptest.NewRecorder()
+	importRouter().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/books/import/unknown/errors", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/adedaryorh/bookstore-app/pkg/stream"
+	"github.com/julienschmidt/httprouter"
+)
+
+var (
+	// bookStream feeds GET /books/stream; nil disables it.
+	bookStream *stream.Hub
+	// streamHeartbeat is how often an idle stream sends a comment, so
+	// proxies don't close it and clients notice when it drops.
+	streamHeartbeat = 15 * time.Second
+)
+
+// streamRetry is the reconnection delay suggested to clients, in
+// milliseconds.
+const streamRetry = 3000
+
+// UseStream sets the hub book events are streamed from and the heartbeat
+// interval of idle streams.
+func UseStream(h *stream.Hub, heartbeat time.Duration) {
+	bookStream = h
+	streamHeartbeat = heartbeat
+}
+
+// StreamBooks sends book events as Server-Sent Events, named by event type
+// with the event JSON as data. A client reconnecting with Last-Event-ID is
+// first sent what it missed; when that is no longer buffered it gets a
+// "reset" event instead and should reload the catalog.
+func StreamBooks(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if bookStream == nil {
+		writeError(w, r, http.StatusNotImplemented, "Event stream is not configured")
+		return
+	}
+	var lastID uint64
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		var err error
+		if lastID, err = strconv.ParseUint(v, 10, 64); err != nil {
+			writeError(w, r, http.StatusBadRequest, "Invalid Last-Event-ID")
+			return
+		}
+	}
+
+	rc := http.NewResponseController(w)
+	// The stream outlives the server's write timeout.
+	rc.SetWriteDeadline(time.Time{})
+	sub, replay, complete := bookStream.Subscribe(lastID)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetry)
+	if !complete {
+		fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+	for _, msg := range replay {
+		writeStreamMessage(w, msg)
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case msg, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			writeStreamMessage(w, msg)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeStreamMessage(w http.ResponseWriter, msg stream.Message) {
+	data, _ := json.Marshal(msg.Event)
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", msg.ID, msg.Event.Type, data)
+}
@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adedaryorh/bookstore-app/pkg/models"
+	"github.com/adedaryorh/bookstore-app/pkg/stream"
+)
+
+// readEvent reads one Server-Sent Event, or comment, as its field lines.
+func readEvent(t *testing.T, r *bufio.Reader) []string {
+	t.Helper()
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("stream ended: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return lines
+		}
+		lines = append(lines, line)
+	}
+}
+
+func TestStreamBooks(t *testing.T) {
+	hub := stream.NewHub(10)
+	UseStream(hub, 20*time.Millisecond)
+	defer UseStream(nil, 15*time.Second)
+	models.OnEvent(hub.Publish)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		StreamBooks(w, r, nil)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("got content type %q want text/event-stream", ct)
+	}
+	body := bufio.NewReader(resp.Body)
+	if got := readEvent(t, body); len(got) != 1 || got[0] != "retry: 3000" {
+		t.Errorf("got %q want the retry delay", got)
+	}
+
+	book := &models.Book{Title: "Streamed", Author: "Author", ISBN: "9781234567941"}
+	book.CreateBook(context.Background())
+	defer models.DeleteBook(context.Background(), book.ID)
+
+	var created []string
+	for created == nil {
+		if got := readEvent(t, body); got[0] != ": heartbeat" {
+			created = got
+		}
+	}
+	if len(created) != 3 || created[1] != "event: book.created" || !strings.Contains(created[2], `"title":"Streamed"`) {
+		t.Fatalf("wrong event: %q", created)
+	}
+	cancel()
+	resp.Body.Close()
+
+	// Reconnecting after the create replays the update missed meanwhile.
+	book.Title = "Streamed again"
+	book.UpdateBook(context.Background())
+	req, _ = http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Last-Event-ID", strings.TrimPrefix(created[0], "id: "))
+	resp, err = srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body = bufio.NewReader(resp.Body)
+	readEvent(t, body)
+	if got := readEvent(t, body); len(got) != 3 || got[1] != "event: book.updated" {
+		t.Errorf("missed update not replayed: %q", got)
+	}
+}
+
+func TestStreamBooksReset(t *testing.T) {
+	UseStream(stream.NewHub(10), time.Minute)
+	defer UseStream(nil, 15*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req := httptest.NewRequest(http.MethodGet, "/books/stream", nil).WithContext(ctx)
+	req.Header.Set("Last-Event-ID", "1")
+	rr := httptest.NewRecorder()
+	StreamBooks(rr, req, nil)
+	if !strings.Contains(rr.Body.String(), "event: reset\n") {
+		t.Errorf("unknown Last-Event-ID should reset the client: %q", rr.Body)
+	}
+}
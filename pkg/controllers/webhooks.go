@@ -0,0 +1,228 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/adedaryorh/bookstore-app/pkg/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// webhookRequest is the body accepted when creating or replacing a
+// subscription.
+type webhookRequest struct {
+	URL    string            `json:"url"`
+	Events models.StringList `json:"events"`
+	Fields models.StringList `json:"fields"`
+	// Secret is generated when left out of a new subscription, and kept
+	// when left out of a replacement.
+	Secret string `json:"secret"`
+	// Active defaults to true.
+	Active *bool `json:"active"`
+}
+
+func (req webhookRequest) apply(w *models.Webhook) {
+	w.URL = req.URL
+	w.Events = req.Events
+	w.Fields = req.Fields
+	if req.Secret != "" {
+		w.Secret = req.Secret
+	}
+	w.Active = req.Active == nil || *req.Active
+}
+
+// webhookWithSecret shows the signing secret, which is only sent back when
+// it was set.
+type webhookWithSecret struct {
+	*models.Webhook
+	Secret string `json:"secret"`
+}
+
+// CreateWebhook subscribes a URL to book events. The response carries the
+// secret deliveries are signed with.
+func CreateWebhook(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid JSON format")
+		return
+	}
+	var hook models.Webhook
+	req.apply(&hook)
+	if err := hook.Validate(); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid webhook: "+strings.ReplaceAll(err.Error(), "\n", "; "))
+		return
+	}
+	if err := models.CreateWebhook(r.Context(), &hook); err != nil {
+		writeModelError(w, r, err, "Failed to create webhook")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(webhookWithSecret{&hook, hook.Secret})
+}
+
+// GetWebhooks lists every subscription.
+func GetWebhooks(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	hooks, err := models.GetWebhooks(r.Context())
+	if err != nil {
+		writeModelError(w, r, err, "Failed to list webhooks")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(append([]models.Webhook{}, hooks...))
+}
+
+func GetWebhook(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id, ok := webhookID(w, r, ps)
+	if !ok {
+		return
+	}
+	hook, err := models.GetWebhook(r.Context(), id)
+	if err != nil {
+		writeModelError(w, r, err, "Failed to fetch webhook")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hook)
+}
+
+// UpdateWebhook replaces a subscription's settings. Sending a new secret
+// rotates it; deliveries already queued are signed with the new one.
+func UpdateWebhook(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id, ok := webhookID(w, r, ps)
+	if !ok {
+		return
+	}
+	hook, err := models.GetWebhook(r.Context(), id)
+	if err != nil {
+		writeModelError(w, r, err, "Failed to fetch webhook")
+		return
+	}
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid JSON format")
+		return
+	}
+	req.apply(hook)
+	if err := hook.Validate(); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid webhook: "+strings.ReplaceAll(err.Error(), "\n", "; "))
+		return
+	}
+	if err := models.UpdateWebhook(r.Context(), hook); err != nil {
+		writeModelError(w, r, err, "Failed to update webhook")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if req.Secret != "" {
+		json.NewEncoder(w).Encode(webhookWithSecret{hook, hook.Secret})
+		return
+	}
+	json.NewEncoder(w).Encode(hook)
+}
+
+// DeleteWebhook unsubscribes, dropping any deliveries still queued.
+func DeleteWebhook(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id, ok := webhookID(w, r, ps)
+	if !ok {
+		return
+	}
+	if err := models.DeleteWebhook(r.Context(), id); err != nil {
+		writeModelError(w, r, err, "Failed to delete webhook")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Webhook deleted successfully"})
+}
+
+// GetWebhookDeliveries lists a subscription's deliveries, newest first,
+// optionally narrowed by status and event_type and paged with limit and
+// offset.
+func GetWebhookDeliveries(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id, ok := webhookID(w, r, ps)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	f := models.DeliveryFilter{Status: q.Get("status"), EventType: q.Get("event_type")}
+	switch f.Status {
+	case "", models.DeliveryPending, models.DeliverySucceeded, models.DeliveryDead:
+	default:
+		writeError(w, r, http.StatusBadRequest, "Invalid status, want pending, succeeded or dead")
+		return
+	}
+	var err error
+	if f.Limit, f.Offset, err = parsePage(r); err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if _, err := models.GetWebhook(r.Context(), id); err != nil {
+		writeModelError(w, r, err, "Failed to fetch webhook")
+		return
+	}
+	deliveries, err := models.GetDeliveries(r.Context(), id, f)
+	if err != nil {
+		writeModelError(w, r, err, "Failed to list deliveries")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(append([]models.WebhookDelivery{}, deliveries...))
+}
+
+// GetWebhookDelivery shows one delivery with the log of its attempts.
+func GetWebhookDelivery(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id, deliveryID, ok := deliveryIDs(w, r, ps)
+	if !ok {
+		return
+	}
+	d, err := models.GetDelivery(r.Context(), id, deliveryID)
+	if err != nil {
+		writeModelError(w, r, err, "Failed to fetch delivery")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(d)
+}
+
+// RedeliverWebhook sends a delivery again, whether it succeeded, is still
+// being retried or is dead.
+func RedeliverWebhook(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id, deliveryID, ok := deliveryIDs(w, r, ps)
+	if !ok {
+		return
+	}
+	d, err := models.Redeliver(r.Context(), id, deliveryID)
+	if err != nil {
+		writeModelError(w, r, err, "Failed to redeliver")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(d)
+}
+
+func webhookID(w http.ResponseWriter, r *http.Request, ps httprouter.Params) (uint, bool) {
+	id, err := strconv.ParseUint(ps.ByName("webhookId"), 10, 32)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid webhook ID")
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func deliveryIDs(w http.ResponseWriter, r *http.Request, ps httprouter.Params) (uint, uint, bool) {
+	id, ok := webhookID(w, r, ps)
+	if !ok {
+		return 0, 0, false
+	}
+	deliveryID, err := strconv.ParseUint(ps.ByName("deliveryId"), 10, 32)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid delivery ID")
+		return 0, 0, false
+	}
+	return id, uint(deliveryID), true
+}
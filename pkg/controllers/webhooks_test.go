@@ -0,0 +1,140 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adedaryorh/bookstore-app/pkg/models"
+	"github.com/adedaryorh/bookstore-app/pkg/outbox"
+	"github.com/adedaryorh/bookstore-app/pkg/webhooks"
+	"github.com/julienschmidt/httprouter"
+)
+
+func webhookRouter() *httprouter.Router {
+	router := httprouter.New()
+	router.POST("/webhooks", CreateWebhook)
+	router.DELETE("/webhooks/:webhookId", DeleteWebhook)
+	router.GET("/webhooks/:webhookId/deliveries", GetWebhookDeliveries)
+	router.GET("/webhooks/:webhookId/deliveries/:deliveryId", GetWebhookDelivery)
+	router.POST("/webhooks/:webhookId/deliveries/:deliveryId/redeliver", RedeliverWebhook)
+	return router
+}
+
+// drain relays every pending outbox event.
+func drain(t *testing.T, relay *outbox.Relay) {
+	for {
+		n, err := relay.Flush(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n == 0 {
+			return
+		}
+	}
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	ctx := context.Background()
+	var received []*http.Request
+	var bodies [][]byte
+	status := http.StatusInternalServerError
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received, bodies = append(received, r), append(bodies, body)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	router := webhookRouter()
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rr
+	}
+
+	rr := serve(http.MethodPost, "/webhooks", `{"url": "`+srv.URL+`", "events": ["book.updated"], "fields": ["price"]}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create returned wrong status code: got %v want %v: %s", rr.Code, http.StatusCreated, rr.Body)
+	}
+	var hook struct {
+		ID     uint   `json:"id"`
+		Secret string `json:"secret"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &hook)
+	hookPath := "/webhooks/" + strconv.Itoa(int(hook.ID))
+	defer serve(http.MethodDelete, hookPath, "")
+	if !strings.HasPrefix(hook.Secret, "whsec_") {
+		t.Errorf("secret should be generated: %q", hook.Secret)
+	}
+
+	// Drain events left by other tests before making the ones watched.
+	relay := &outbox.Relay{Publisher: webhooks.Fanout{}, BatchSize: 100}
+	drain(t, relay)
+
+	price := 20.0
+	book := &models.Book{Title: "Webhooks", Author: "Author", ISBN: "9781234567934", Price: &price}
+	book.CreateBook(ctx)
+	defer models.DeleteBook(ctx, book.ID)
+	book.Title = "Webhooks, retitled"
+	book.UpdateBook(ctx)
+	price = 18.5
+	book.UpdateBook(ctx)
+	drain(t, relay)
+
+	dispatcher := &webhooks.Dispatcher{Client: srv.Client(), BatchSize: 10, MaxAttempts: 2, Backoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	dispatcher.Dispatch(ctx)
+	time.Sleep(5 * time.Millisecond)
+	dispatcher.Dispatch(ctx)
+
+	// Only the price change matches, and it fails both attempts.
+	if len(received) != 2 {
+		t.Fatalf("got %d requests want 2", len(received))
+	}
+	if err := webhooks.Verify(hook.Secret, received[0].Header.Get(webhooks.SignatureHeader), bodies[0], time.Minute, time.Now()); err != nil {
+		t.Errorf("delivery not signed: %v", err)
+	}
+	var ev models.Event
+	json.Unmarshal(bodies[0], &ev)
+	if ev.Type != models.EventBookUpdated || ev.Changes["price"].New != 18.5 {
+		t.Errorf("wrong event delivered: %+v", ev)
+	}
+
+	rr = serve(http.MethodGet, hookPath+"/deliveries?status=dead", "")
+	var deliveries []models.WebhookDelivery
+	json.Unmarshal(rr.Body.Bytes(), &deliveries)
+	if len(deliveries) != 1 || deliveries[0].Attempts != 2 || deliveries[0].LastStatusCode != http.StatusInternalServerError {
+		t.Fatalf("wrong dead deliveries: %s", rr.Body)
+	}
+	deliveryPath := hookPath + "/deliveries/" + strconv.Itoa(int(deliveries[0].ID))
+
+	status = http.StatusOK
+	if rr := serve(http.MethodPost, deliveryPath+"/redeliver", ""); rr.Code != http.StatusAccepted {
+		t.Fatalf("redeliver returned wrong status code: got %v want %v", rr.Code, http.StatusAccepted)
+	}
+	dispatcher.Dispatch(ctx)
+
+	rr = serve(http.MethodGet, deliveryPath, "")
+	var delivery models.WebhookDelivery
+	json.Unmarshal(rr.Body.Bytes(), &delivery)
+	if delivery.Status != models.DeliverySucceeded || len(delivery.Log) != 3 || delivery.DeliveredAt == nil {
+		t.Errorf("redelivery not logged: %s", rr.Body)
+	}
+	if received[2].Header.Get("X-Event-ID") != ev.ID {
+		t.Errorf("redelivery should carry the same event ID")
+	}
+}
+
+func TestCreateWebhookInvalid(t *testing.T) {
+	rr := httptest.NewRecorder()
+	webhookRouter().ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(`{"url": "not a url", "events": ["book.sold"]}`)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,185 @@
+// Package covers validates uploaded book cover images and generates the
+// smaller renditions served alongside the original.
+package covers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	_ "image/png" // registers the PNG decoder
+	"net/http"
+
+	"github.com/adedaryorh/bookstore-app/pkg/storage"
+)
+
+var (
+	// ErrUnsupportedType is returned for uploads that aren't JPEG or PNG.
+	ErrUnsupportedType = errors.New("cover must be a JPEG or PNG image")
+	// ErrInvalid is returned for images that can't be decoded.
+	ErrInvalid = errors.New("cover image could not be decoded")
+	// ErrTooLarge is returned for images with more than MaxPixels pixels,
+	// which would take too much memory to decode.
+	ErrTooLarge = errors.New("cover image dimensions are too large")
+)
+
+// MaxPixels bounds the width times height of an accepted image. Decoding
+// takes 4 to 8 bytes a pixel, and the flattened copy 4 more, so an upload
+// can cost at most about 75MB however well it compresses. 6 megapixels is
+// well beyond what the renditions need, and more than print-quality covers
+// have.
+const MaxPixels = 6_000_000
+
+// Original names the image as it was uploaded.
+const Original = "original"
+
+// Size is a generated rendition, scaled down to fit in a MaxDim square.
+type Size struct {
+	Name   string
+	MaxDim int
+}
+
+// Sizes are the renditions generated for every cover, smallest first.
+var Sizes = []Size{
+	{Name: "thumb", MaxDim: 160},
+	{Name: "medium", MaxDim: 480},
+}
+
+// jpegQuality is used for generated renditions.
+const jpegQuality = 85
+
+// Cover is a validated upload with its renditions.
+type Cover struct {
+	// ContentType is the original's type, image/jpeg or image/png.
+	ContentType string
+	// Version identifies the content, so cover URLs can change whenever
+	// the image does.
+	Version string
+	// Renditions holds the encoded image for Original and each of Sizes.
+	Renditions map[string][]byte
+}
+
+// Process checks that data is a JPEG or PNG image of acceptable dimensions
+// and renders its smaller sizes as JPEG. The type is taken from the content,
+// not from what the client claimed.
+func Process(data []byte) (*Cover, error) {
+	contentType := http.DetectContentType(data)
+	if contentType != "image/jpeg" && contentType != "image/png" {
+		return nil, ErrUnsupportedType
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, ErrInvalid
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > MaxPixels {
+		return nil, ErrTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalid
+	}
+
+	// Flatten transparency onto white, as the renditions are JPEG.
+	flat := image.NewRGBA(image.Rect(0, 0, cfg.Width, cfg.Height))
+	draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+
+	sum := sha256.Sum256(data)
+	c := &Cover{
+		ContentType: contentType,
+		Version:     hex.EncodeToString(sum[:8]),
+		Renditions:  map[string][]byte{Original: data},
+	}
+	for _, size := range Sizes {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, fit(flat, size.MaxDim), &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, fmt.Errorf("encoding %s cover: %w", size.Name, err)
+		}
+		c.Renditions[size.Name] = buf.Bytes()
+	}
+	return c, nil
+}
+
+// ValidSize reports whether name is Original or one of Sizes.
+func ValidSize(name string) bool {
+	if name == Original {
+		return true
+	}
+	for _, s := range Sizes {
+		if s.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Key is where a book's cover rendition is stored.
+func Key(bookID uint, size string) string {
+	return fmt.Sprintf("%s/%s", prefix(bookID), size)
+}
+
+func prefix(bookID uint) string {
+	return fmt.Sprintf("covers/%d", bookID)
+}
+
+// Save stores every rendition of c for a book, replacing its previous
+// cover. The original is written last, so it only appears once the
+// renditions are in place.
+func Save(ctx context.Context, store storage.Store, bookID uint, c *Cover) error {
+	for _, size := range Sizes {
+		if err := store.Put(ctx, Key(bookID, size.Name), bytes.NewReader(c.Renditions[size.Name])); err != nil {
+			return err
+		}
+	}
+	return store.Put(ctx, Key(bookID, Original), bytes.NewReader(c.Renditions[Original]))
+}
+
+// Remove deletes every rendition of a book's cover.
+func Remove(ctx context.Context, store storage.Store, bookID uint) error {
+	return store.Delete(ctx, prefix(bookID))
+}
+
+// fit scales src down, keeping its aspect ratio, so neither side exceeds
+// maxDim. Each output pixel is the average of the source pixels it covers,
+// which avoids the aliasing of nearest-neighbour sampling. Images already
+// small enough are returned as they are.
+func fit(src *image.RGBA, maxDim int) image.Image {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	if sw <= maxDim && sh <= maxDim {
+		return src
+	}
+	dw, dh := maxDim, sh*maxDim/sw
+	if sh > sw {
+		dw, dh = sw*maxDim/sh, maxDim
+	}
+	dw, dh = max(dw, 1), max(dh, 1)
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*sh/dh, max((y+1)*sh/dh, y*sh/dh+1)
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*sw/dw, max((x+1)*sw/dw, x*sw/dw+1)
+			var r, g, b, n int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4:]
+					r, g, b = r+int(p[0]), g+int(p[1]), b+int(p[2])
+					n++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2], dst.Pix[i+3] = uint8(r/n), uint8(g/n), uint8(b/n), 0xff
+		}
+	}
+	return dst
+}
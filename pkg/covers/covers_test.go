@@ -0,0 +1,129 @@
+package covers
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"testing"
+
+	"github.com/adedaryorh/bookstore-app/pkg/storage"
+)
+
+func encodePNG(t *testing.T, w, h int) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 200, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// pngHeader is the start of a PNG claiming width x height pixels. Images
+// that are too large must be refused before any pixel data is read.
+func pngHeader(width, height uint32) []byte {
+	ihdr := []byte("IHDR")
+	ihdr = binary.BigEndian.AppendUint32(ihdr, width)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, height)
+	ihdr = append(ihdr, 8, 2, 0, 0, 0)
+	data := []byte("\x89PNG\r\n\x1a\n")
+	data = binary.BigEndian.AppendUint32(data, uint32(len(ihdr)-4))
+	data = append(data, ihdr...)
+	return binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(ihdr))
+}
+
+func TestProcess(t *testing.T) {
+	data := encodePNG(t, 600, 900)
+	c, err := Process(data)
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	if c.ContentType != "image/png" || len(c.Version) != 16 {
+		t.Errorf("got type %q version %q", c.ContentType, c.Version)
+	}
+	if !bytes.Equal(c.Renditions[Original], data) {
+		t.Error("original should be kept as uploaded")
+	}
+	want := map[string]image.Point{"thumb": {106, 160}, "medium": {320, 480}}
+	for name, size := range want {
+		img, err := jpeg.Decode(bytes.NewReader(c.Renditions[name]))
+		if err != nil {
+			t.Fatalf("%s is not a JPEG: %v", name, err)
+		}
+		if got := img.Bounds().Size(); got != size {
+			t.Errorf("%s: got %v want %v", name, got, size)
+		}
+	}
+
+	small, err := Process(encodePNG(t, 100, 50))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg, _ := jpeg.DecodeConfig(bytes.NewReader(small.Renditions["medium"])); cfg.Width != 100 || cfg.Height != 50 {
+		t.Errorf("small images should not be enlarged: got %dx%d", cfg.Width, cfg.Height)
+	}
+}
+
+func TestProcessRejects(t *testing.T) {
+	png := encodePNG(t, 10, 10)
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"text", []byte("definitely not an image"), ErrUnsupportedType},
+		{"gif", []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00;"), ErrUnsupportedType},
+		{"truncated png", png[:40], ErrInvalid},
+		{"too many pixels", pngHeader(100000, 100000), ErrTooLarge},
+		{"just over the limit", pngHeader(2000, MaxPixels/2000+1), ErrTooLarge},
+	}
+	for _, tt := range tests {
+		if _, err := Process(tt.data); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestSaveAndRemove(t *testing.T) {
+	store, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := Process(encodePNG(t, 300, 300))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := Save(ctx, store, 7, c); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range c.Renditions {
+		obj, err := store.Get(ctx, Key(7, name))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got, _ := io.ReadAll(obj)
+		obj.Close()
+		if !bytes.Equal(got, data) {
+			t.Errorf("%s: stored content differs", name)
+		}
+	}
+
+	if err := Remove(ctx, store, 7); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(ctx, Key(7, Original)); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("got %v want storage.ErrNotFound", err)
+	}
+}
@@ -0,0 +1,106 @@
+// Package dataloader batches the lookups made while building one response,
+// so that loading something for every item of a list costs one query
+// rather than one per item.
+//
+// Load queues a key and returns a thunk. Nothing is fetched until the first
+// thunk is called, which fetches every key queued so far at once; callers
+// queue all the keys of a level before calling any thunk, as GraphQL
+// executors that resolve thunks breadth first do.
+package dataloader
+
+import (
+	"context"
+	"sync"
+)
+
+// BatchFunc fetches the values of keys. Keys it leaves out of the map
+// have no value.
+type BatchFunc[K comparable, V any] func(ctx context.Context, keys []K) (map[K]V, error)
+
+// Loader batches and caches the lookups of one request. It is safe for
+// concurrent use.
+type Loader[K comparable, V any] struct {
+	ctx   context.Context
+	batch BatchFunc[K, V]
+	// MaxBatch caps the keys fetched at once; 0 means no cap.
+	MaxBatch int
+
+	mu      sync.Mutex
+	pending []K
+	results map[K]*result[V]
+}
+
+type result[V any] struct {
+	value V
+	found bool
+	err   error
+	// done is closed once the value is fetched.
+	done chan struct{}
+}
+
+// New returns a Loader fetching with batch, under ctx.
+func New[K comparable, V any](ctx context.Context, batch BatchFunc[K, V]) *Loader[K, V] {
+	return &Loader[K, V]{ctx: ctx, batch: batch, results: map[K]*result[V]{}}
+}
+
+// Load queues key, unless it was loaded already, and returns a thunk
+// yielding its value. found is false for keys the batch had no value for.
+func (l *Loader[K, V]) Load(key K) func() (value V, found bool, err error) {
+	l.mu.Lock()
+	res, ok := l.results[key]
+	if !ok {
+		res = &result[V]{done: make(chan struct{})}
+		l.results[key] = res
+		l.pending = append(l.pending, key)
+	}
+	l.mu.Unlock()
+
+	return func() (V, bool, error) {
+		select {
+		case <-res.done:
+		default:
+			l.dispatch()
+			<-res.done
+		}
+		return res.value, res.found, res.err
+	}
+}
+
+// dispatch fetches every pending key. Keys queued by another dispatch in
+// progress are left to it.
+func (l *Loader[K, V]) dispatch() {
+	l.mu.Lock()
+	keys := l.pending
+	l.pending = nil
+	l.mu.Unlock()
+
+	for len(keys) > 0 {
+		n := len(keys)
+		if l.MaxBatch > 0 && n > l.MaxBatch {
+			n = l.MaxBatch
+		}
+		values, err := l.batch(l.ctx, keys[:n])
+
+		l.mu.Lock()
+		for _, k := range keys[:n] {
+			res := l.results[k]
+			res.value, res.found = values[k]
+			res.err = err
+			close(res.done)
+		}
+		l.mu.Unlock()
+		keys = keys[n:]
+	}
+}
+
+// Prime stores the value of key, so loading it costs no lookup.
+func (l *Loader[K, V]) Prime(key K, value V) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.results[key]; ok {
+		return
+	}
+	res := &result[V]{value: value, found: true, done: make(chan struct{})}
+	close(res.done)
+	l.results[key] = res
+}
@@ -0,0 +1,78 @@
+package dataloader
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestLoaderBatches(t *testing.T) {
+	var batches [][]int
+	l := New(context.Background(), func(_ context.Context, keys []int) (map[int]string, error) {
+		batches = append(batches, append([]int(nil), keys...))
+		out := map[int]string{}
+		for _, k := range keys {
+			if k != 3 {
+				out[k] = string(rune('a' + k))
+			}
+		}
+		return out, nil
+	})
+
+	thunks := []func() (string, bool, error){l.Load(1), l.Load(2), l.Load(1), l.Load(3)}
+	if len(batches) != 0 {
+		t.Fatal("Load shouldn't fetch anything")
+	}
+	for i, want := range []string{"b", "c", "b", ""} {
+		got, found, err := thunks[i]()
+		if err != nil || got != want || found != (want != "") {
+			t.Errorf("thunk %d: got %q %v %v want %q", i, got, found, err, want)
+		}
+	}
+	if !reflect.DeepEqual(batches, [][]int{{1, 2, 3}}) {
+		t.Errorf("got batches %v want one of [1 2 3]", batches)
+	}
+
+	// Loaded keys are cached; new ones make a new batch.
+	l.Load(2)()
+	l.Prime(5, "primed")
+	if v, _, _ := l.Load(5)(); v != "primed" {
+		t.Errorf("primed key: got %q", v)
+	}
+	l.Load(4)()
+	if !reflect.DeepEqual(batches, [][]int{{1, 2, 3}, {4}}) {
+		t.Errorf("got batches %v", batches)
+	}
+}
+
+func TestLoaderMaxBatch(t *testing.T) {
+	var sizes []int
+	l := New(context.Background(), func(_ context.Context, keys []int) (map[int]int, error) {
+		sizes = append(sizes, len(keys))
+		return nil, nil
+	})
+	l.MaxBatch = 2
+	var thunks []func() (int, bool, error)
+	for k := 0; k < 5; k++ {
+		thunks = append(thunks, l.Load(k))
+	}
+	thunks[4]()
+	if !reflect.DeepEqual(sizes, []int{2, 2, 1}) {
+		t.Errorf("got batch sizes %v want [2 2 1]", sizes)
+	}
+}
+
+func TestLoaderError(t *testing.T) {
+	fail := errors.New("database unavailable")
+	l := New(context.Background(), func(_ context.Context, keys []string) (map[string]int, error) {
+		return nil, fail
+	})
+	a, b := l.Load("a"), l.Load("b")
+	if _, _, err := a(); err != fail {
+		t.Errorf("got %v want %v", err, fail)
+	}
+	if _, _, err := b(); err != fail {
+		t.Errorf("every key of a failed batch should fail: got %v", err)
+	}
+}
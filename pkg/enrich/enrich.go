@@ -0,0 +1,177 @@
+// Package enrich looks up bibliographic metadata by ISBN in external
+// sources such as Open Library or Google Books, so staff don't have to type
+// titles, authors and years by hand.
+package enrich
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/adedaryorh/bookstore-app/pkg/cache"
+	"github.com/adedaryorh/bookstore-app/pkg/models"
+)
+
+// ErrNotFound is returned when a source has no record of an ISBN.
+var ErrNotFound = errors.New("no metadata found for this ISBN")
+
+// Metadata is what a source knows about a book.
+type Metadata struct {
+	// Source names the provider the metadata came from.
+	Source          string   `json:"source"`
+	Title           string   `json:"title,omitempty"`
+	Authors         []string `json:"authors,omitempty"`
+	PublicationYear string   `json:"publication_year,omitempty"`
+	Subjects        []string `json:"subjects,omitempty"`
+	CoverURL        string   `json:"cover_url,omitempty"`
+}
+
+// Provider looks up metadata by canonical ISBN-13. Implementations must be
+// safe for concurrent use.
+type Provider interface {
+	Lookup(ctx context.Context, isbn string) (*Metadata, error)
+}
+
+// authorSeparator joins several authors into Book.Author, as imports do.
+const authorSeparator = "; "
+
+// Apply copies m onto b and returns the JSON names of the fields it
+// changed. Fields the book already has are kept unless overwrite is set.
+func Apply(b *models.Book, m *Metadata, overwrite bool) []string {
+	var changed []string
+	set := func(name string, field *string, value string) {
+		if value == "" || *field == value || (*field != "" && !overwrite) {
+			return
+		}
+		*field = value
+		changed = append(changed, name)
+	}
+	setPtr := func(name string, field **string, value string) {
+		if *field == nil {
+			*field = new(string)
+		}
+		set(name, *field, value)
+		if **field == "" {
+			*field = nil
+		}
+	}
+
+	set("title", &b.Title, m.Title)
+	set("author", &b.Author, strings.Join(m.Authors, authorSeparator))
+	set("publication_year", &b.PublicationYear, m.PublicationYear)
+	if len(m.Subjects) > 0 {
+		setPtr("genre", &b.Genre, m.Subjects[0])
+	}
+	setPtr("cover_url", &b.CoverURL, m.CoverURL)
+	return changed
+}
+
+// Chain asks each provider in turn and returns the first match. It returns
+// ErrNotFound only if every provider did; otherwise the last other error.
+type Chain []Provider
+
+func (c Chain) Lookup(ctx context.Context, isbn string) (*Metadata, error) {
+	err := ErrNotFound
+	for _, p := range c {
+		m, perr := p.Lookup(ctx, isbn)
+		if perr == nil {
+			return m, nil
+		}
+		if !errors.Is(perr, ErrNotFound) {
+			err = perr
+		}
+	}
+	return nil, err
+}
+
+// Cached remembers a provider's answers, including misses, so repeated
+// lookups of the same ISBN don't go back to the source. Failed lookups are
+// not cached.
+type Cached struct {
+	Provider Provider
+	Cache    cache.Cache
+	// TTL is how long a match is kept, NotFoundTTL how long a miss is.
+	TTL         time.Duration
+	NotFoundTTL time.Duration
+}
+
+// notFound is cached for ISBNs the provider doesn't know.
+var notFound = []byte("null")
+
+func (c *Cached) Lookup(ctx context.Context, isbn string) (*Metadata, error) {
+	key := "enrich:" + isbn
+	if data, ok, err := c.Cache.Get(ctx, key); err != nil {
+		slog.WarnContext(ctx, "enrichment cache read failed", "error", err)
+	} else if ok {
+		var m *Metadata
+		if err := json.Unmarshal(data, &m); err == nil {
+			if m == nil {
+				return nil, ErrNotFound
+			}
+			return m, nil
+		}
+	}
+
+	m, err := c.Provider.Lookup(ctx, isbn)
+	var data []byte
+	ttl := c.TTL
+	switch {
+	case errors.Is(err, ErrNotFound):
+		data, ttl = notFound, c.NotFoundTTL
+	case err != nil:
+		return nil, err
+	default:
+		data, _ = json.Marshal(m)
+	}
+	if err := c.Cache.Set(ctx, key, data, ttl); err != nil {
+		slog.WarnContext(ctx, "enrichment cache write failed", "error", err)
+	}
+	return m, err
+}
+
+// getJSON fetches rawURL into v. A 404 is reported as ErrNotFound. Errors
+// name the source rather than the URL, which may carry an API key.
+func getJSON(ctx context.Context, client *http.Client, source, rawURL string, v interface{}) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", source, err)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		return fmt.Errorf("%s: %w", source, err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("%s: unexpected status %s", source, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("%s: invalid response: %w", source, err)
+	}
+	return nil
+}
+
+var yearPattern = regexp.MustCompile(`\b[12][0-9]{3}\b`)
+
+// year picks the year out of dates like "1969", "March 1969" or
+// "1969-03-01".
+func year(date string) string {
+	return yearPattern.FindString(date)
+}
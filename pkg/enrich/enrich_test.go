@@ -0,0 +1,189 @@
+package enrich
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/adedaryorh/bookstore-app/pkg/cache"
+	"github.com/adedaryorh/bookstore-app/pkg/models"
+)
+
+const openLibraryResponse = `{"ISBN:9780441478125": {
+  "title": "The left hand of darkness",
+  "subtitle": "a novel",
+  "authors": [{"url": "https://openlibrary.org/authors/OL31353A", "name": "Ursula K. Le Guin"}],
+  "publish_date": "March 1969",
+  "subjects": [{"name": "Science fiction"}, {"name": "Gender identity"}],
+  "cover": {"small": "https://covers.example/s.jpg", "large": "https://covers.example/l.jpg"}
+}}`
+
+const googleBooksResponse = `{"totalItems": 1, "items": [{"volumeInfo": {
+  "title": "The Left Hand of Darkness",
+  "authors": ["Ursula K. Le Guin", "China Miéville"],
+  "publishedDate": "1969-03-01",
+  "categories": ["Fiction"],
+  "imageLinks": {"thumbnail": "http://books.google.example/t.jpg"}
+}}]}`
+
+// standIn serves canned provider responses for one ISBN and counts the
+// requests it gets.
+func standIn(t *testing.T, requests *atomic.Int32) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		q := r.URL.Query()
+		switch {
+		case r.URL.Path == "/api/books" && q.Get("bibkeys") == "ISBN:9780441478125" && q.Get("jscmd") == "data":
+			w.Write([]byte(openLibraryResponse))
+		case r.URL.Path == "/api/books":
+			w.Write([]byte(`{}`))
+		case r.URL.Path == "/books/v1/volumes" && q.Get("q") == "isbn:9780441478125":
+			w.Write([]byte(googleBooksResponse))
+		case r.URL.Path == "/books/v1/volumes":
+			w.Write([]byte(`{"totalItems": 0}`))
+		default:
+			http.Error(w, "boom", http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestProviders(t *testing.T) {
+	var requests atomic.Int32
+	srv := standIn(t, &requests)
+
+	tests := []struct {
+		provider Provider
+		want     Metadata
+	}{
+		{&OpenLibrary{BaseURL: srv.URL}, Metadata{
+			Source:          "openlibrary",
+			Title:           "The left hand of darkness: a novel",
+			Authors:         []string{"Ursula K. Le Guin"},
+			PublicationYear: "1969",
+			Subjects:        []string{"Science fiction", "Gender identity"},
+			CoverURL:        "https://covers.example/l.jpg",
+		}},
+		{&GoogleBooks{BaseURL: srv.URL, APIKey: "secret"}, Metadata{
+			Source:          "googlebooks",
+			Title:           "The Left Hand of Darkness",
+			Authors:         []string{"Ursula K. Le Guin", "China Miéville"},
+			PublicationYear: "1969",
+			Subjects:        []string{"Fiction"},
+			CoverURL:        "https://books.google.example/t.jpg",
+		}},
+	}
+	for _, tt := range tests {
+		got, err := tt.provider.Lookup(context.Background(), "9780441478125")
+		if err != nil {
+			t.Errorf("%T: Lookup failed: %v", tt.provider, err)
+			continue
+		}
+		if !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("%T: got %+v want %+v", tt.provider, *got, tt.want)
+		}
+		if _, err := tt.provider.Lookup(context.Background(), "9780000000002"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%T: got %v want ErrNotFound", tt.provider, err)
+		}
+	}
+}
+
+func TestProviderErrorsHideURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "quota exceeded", http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	_, err := (&GoogleBooks{BaseURL: srv.URL, APIKey: "secret"}).Lookup(context.Background(), "9780441478125")
+	if err == nil || errors.Is(err, ErrNotFound) {
+		t.Fatalf("got %v want a provider error", err)
+	}
+	if strings.Contains(err.Error(), "secret") {
+		t.Errorf("error leaks the API key: %v", err)
+	}
+}
+
+func TestCached(t *testing.T) {
+	var requests atomic.Int32
+	srv := standIn(t, &requests)
+	c := &Cached{Provider: &OpenLibrary{BaseURL: srv.URL}, Cache: cache.NewLRU(10), TTL: time.Hour, NotFoundTTL: time.Hour}
+
+	for i := 0; i < 3; i++ {
+		if m, err := c.Lookup(context.Background(), "9780441478125"); err != nil || m.Title == "" {
+			t.Fatalf("Lookup failed: %+v, %v", m, err)
+		}
+		if _, err := c.Lookup(context.Background(), "9780000000002"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("got %v want ErrNotFound", err)
+		}
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("got %d requests want 2", n)
+	}
+
+	// Failures are retried rather than cached.
+	c.Provider = &OpenLibrary{BaseURL: srv.URL + "/broken"}
+	c.Lookup(context.Background(), "9780141439587")
+	c.Lookup(context.Background(), "9780141439587")
+	if n := requests.Load(); n != 4 {
+		t.Errorf("got %d requests want 4", n)
+	}
+}
+
+type fixed struct {
+	m   *Metadata
+	err error
+}
+
+func (f fixed) Lookup(context.Context, string) (*Metadata, error) { return f.m, f.err }
+
+func TestChain(t *testing.T) {
+	found := &Metadata{Source: "second"}
+	down := errors.New("down")
+
+	if m, err := (Chain{fixed{err: ErrNotFound}, fixed{m: found}}).Lookup(context.Background(), ""); err != nil || m != found {
+		t.Errorf("got %v, %v want the second provider's match", m, err)
+	}
+	if _, err := (Chain{fixed{err: down}, fixed{err: ErrNotFound}}).Lookup(context.Background(), ""); err != down {
+		t.Errorf("got %v want %v", err, down)
+	}
+	if _, err := (Chain{fixed{err: ErrNotFound}}).Lookup(context.Background(), ""); err != ErrNotFound {
+		t.Errorf("got %v want ErrNotFound", err)
+	}
+}
+
+func TestApply(t *testing.T) {
+	m := &Metadata{
+		Title:           "Dune",
+		Authors:         []string{"Frank Herbert"},
+		PublicationYear: "1965",
+		Subjects:        []string{"Science fiction"},
+		CoverURL:        "https://covers.example/dune.jpg",
+	}
+
+	typed := "Dune (typed by hand)"
+	b := &models.Book{Title: typed, ISBN: "9780441013593"}
+	changed := Apply(b, m, false)
+	if want := []string{"author", "publication_year", "genre", "cover_url"}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("got changed %v want %v", changed, want)
+	}
+	if b.Title != typed || b.Author != "Frank Herbert" || *b.Genre != "Science fiction" {
+		t.Errorf("blank fields not filled, or title overwritten: %+v", b)
+	}
+
+	if changed := Apply(b, m, true); !reflect.DeepEqual(changed, []string{"title"}) || b.Title != "Dune" {
+		t.Errorf("overwrite: got changed %v, title %q", changed, b.Title)
+	}
+
+	empty := &models.Book{}
+	Apply(empty, &Metadata{Title: "Only a title"}, false)
+	if empty.Genre != nil || empty.CoverURL != nil {
+		t.Errorf("missing values should leave fields nil: %+v", empty)
+	}
+}
@@ -0,0 +1,74 @@
+package enrich
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// GoogleBooks looks books up with the Google Books volumes API.
+type GoogleBooks struct {
+	// BaseURL defaults to https://www.googleapis.com.
+	BaseURL string
+	// APIKey is optional; without one requests share a small anonymous
+	// quota.
+	APIKey string
+	Client *http.Client
+}
+
+type googleVolumes struct {
+	TotalItems int `json:"totalItems"`
+	Items      []struct {
+		VolumeInfo struct {
+			Title         string   `json:"title"`
+			Subtitle      string   `json:"subtitle"`
+			Authors       []string `json:"authors"`
+			PublishedDate string   `json:"publishedDate"`
+			Categories    []string `json:"categories"`
+			ImageLinks    struct {
+				SmallThumbnail string `json:"smallThumbnail"`
+				Thumbnail      string `json:"thumbnail"`
+			} `json:"imageLinks"`
+		} `json:"volumeInfo"`
+	} `json:"items"`
+}
+
+func (g *GoogleBooks) Lookup(ctx context.Context, isbn string) (*Metadata, error) {
+	base := g.BaseURL
+	if base == "" {
+		base = "https://www.googleapis.com"
+	}
+	q := url.Values{"q": {"isbn:" + isbn}}
+	if g.APIKey != "" {
+		q.Set("key", g.APIKey)
+	}
+	var resp googleVolumes
+	if err := getJSON(ctx, g.Client, "google books", strings.TrimRight(base, "/")+"/books/v1/volumes?"+q.Encode(), &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Items) == 0 {
+		return nil, ErrNotFound
+	}
+
+	v := resp.Items[0].VolumeInfo
+	m := &Metadata{
+		Source:          "googlebooks",
+		Title:           v.Title,
+		Authors:         v.Authors,
+		PublicationYear: year(v.PublishedDate),
+		Subjects:        v.Categories,
+		CoverURL:        v.ImageLinks.Thumbnail,
+	}
+	if v.Subtitle != "" {
+		m.Title += ": " + v.Subtitle
+	}
+	if m.CoverURL == "" {
+		m.CoverURL = v.ImageLinks.SmallThumbnail
+	}
+	// Google hands out http links for covers it also serves over https.
+	if strings.HasPrefix(m.CoverURL, "http://") {
+		m.CoverURL = "https://" + strings.TrimPrefix(m.CoverURL, "http://")
+	}
+	return m, nil
+}
@@ -0,0 +1,67 @@
+package enrich
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// OpenLibrary looks books up with the Open Library Books API.
+type OpenLibrary struct {
+	// BaseURL defaults to https://openlibrary.org.
+	BaseURL string
+	Client  *http.Client
+}
+
+type openLibraryBook struct {
+	Title       string `json:"title"`
+	Subtitle    string `json:"subtitle"`
+	PublishDate string `json:"publish_date"`
+	Authors     []struct {
+		Name string `json:"name"`
+	} `json:"authors"`
+	Subjects []struct {
+		Name string `json:"name"`
+	} `json:"subjects"`
+	Cover struct {
+		Small  string `json:"small"`
+		Medium string `json:"medium"`
+		Large  string `json:"large"`
+	} `json:"cover"`
+}
+
+func (o *OpenLibrary) Lookup(ctx context.Context, isbn string) (*Metadata, error) {
+	base := o.BaseURL
+	if base == "" {
+		base = "https://openlibrary.org"
+	}
+	key := "ISBN:" + isbn
+	q := url.Values{"bibkeys": {key}, "format": {"json"}, "jscmd": {"data"}}
+	var resp map[string]openLibraryBook
+	if err := getJSON(ctx, o.Client, "open library", strings.TrimRight(base, "/")+"/api/books?"+q.Encode(), &resp); err != nil {
+		return nil, err
+	}
+	b, ok := resp[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	m := &Metadata{Source: "openlibrary", Title: b.Title, PublicationYear: year(b.PublishDate)}
+	if b.Subtitle != "" {
+		m.Title += ": " + b.Subtitle
+	}
+	for _, a := range b.Authors {
+		m.Authors = append(m.Authors, a.Name)
+	}
+	for _, s := range b.Subjects {
+		m.Subjects = append(m.Subjects, s.Name)
+	}
+	for _, cover := range []string{b.Cover.Large, b.Cover.Medium, b.Cover.Small} {
+		if cover != "" {
+			m.CoverURL = cover
+			break
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,200 @@
+// Package idempotency makes POST requests safe to retry: a request sent
+// again with the same Idempotency-Key gets the stored response to the first
+// one instead of being applied twice.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/adedaryorh/bookstore-app/pkg/logging"
+	"github.com/julienschmidt/httprouter"
+)
+
+// Header carries the client's key for a request.
+const Header = "Idempotency-Key"
+
+// ReplayedHeader is set on responses replayed from the store.
+const ReplayedHeader = "Idempotent-Replayed"
+
+const (
+	maxKeyLength = 255
+	// maxBody bounds the request bodies buffered to fingerprint them.
+	maxBody = 10 << 20
+)
+
+// ErrNotClaimed is returned by a Store asked to finish a key whose claim
+// has lapsed.
+var ErrNotClaimed = errors.New("idempotency key is not claimed")
+
+// Record is what a Store holds for a key: the request's fingerprint and,
+// once it has finished, the response. Status is 0 while the request is in
+// progress.
+type Record struct {
+	Fingerprint string
+	Status      int
+	ContentType string
+	Location    string
+	Body        []byte
+}
+
+// Store keeps records for a while after their request finished.
+type Store interface {
+	// Begin claims key for a request with the given fingerprint. It returns
+	// nil when the request should go ahead, or the record already held for
+	// key.
+	Begin(ctx context.Context, key, fingerprint string) (*Record, error)
+	// Finish stores the response to the request that claimed key.
+	Finish(ctx context.Context, key string, rec Record) error
+	// Abandon releases a claimed key so the request can be tried again.
+	Abandon(ctx context.Context, key string) error
+}
+
+// Handle wraps next so that requests carrying an Idempotency-Key run once.
+// A retry with the same key and request gets the first response again; the
+// same key with a different method, URL or body is rejected with 422, and
+// a retry while the first request is still running with 409. Server errors
+// aren't stored, so a request that failed with one can be retried. Keys are
+// scoped to the caller.
+func Handle(store Store, next httprouter.Handle) httprouter.Handle {
+	if store == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		key := r.Header.Get(Header)
+		if key == "" {
+			next(w, r, ps)
+			return
+		}
+		if len(key) > maxKeyLength {
+			writeError(w, r, http.StatusBadRequest, "Idempotency-Key is too long")
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBody))
+		if err != nil {
+			writeError(w, r, http.StatusRequestEntityTooLarge, "Request body is too large")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		ctx := r.Context()
+		key = scope(logging.Caller(ctx), key)
+		fp := fingerprint(r, body)
+		rec, err := store.Begin(ctx, key, fp)
+		switch {
+		case err != nil:
+			slog.ErrorContext(ctx, "claiming idempotency key failed", "error", err)
+			w.Header().Set("Retry-After", "5")
+			writeError(w, r, http.StatusServiceUnavailable, "Idempotency-Key could not be checked, please retry")
+			return
+		case rec == nil:
+		case rec.Fingerprint != fp:
+			writeError(w, r, http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request")
+			return
+		case rec.Status == 0:
+			w.Header().Set("Retry-After", "1")
+			writeError(w, r, http.StatusConflict, "A request with this Idempotency-Key is still in progress")
+			return
+		default:
+			replay(w, rec)
+			return
+		}
+
+		cw := &capture{ResponseWriter: w, status: http.StatusOK}
+		finished := false
+		defer func() {
+			// Release the key if next panics, so the client can retry.
+			if !finished {
+				store.Abandon(context.WithoutCancel(ctx), key)
+			}
+		}()
+		next(cw, r, ps)
+		finished = true
+
+		if cw.status >= 500 {
+			if err := store.Abandon(context.WithoutCancel(ctx), key); err != nil {
+				slog.WarnContext(ctx, "releasing idempotency key failed", "error", err)
+			}
+			return
+		}
+		err = store.Finish(context.WithoutCancel(ctx), key, Record{
+			Fingerprint: fp,
+			Status:      cw.status,
+			ContentType: w.Header().Get("Content-Type"),
+			Location:    w.Header().Get("Location"),
+			Body:        cw.body.Bytes(),
+		})
+		if err != nil {
+			slog.WarnContext(ctx, "storing idempotent response failed", "error", err)
+		}
+	}
+}
+
+// scope makes a key unique to the caller, with a fixed length.
+func scope(caller, key string) string {
+	sum := sha256.Sum256([]byte(caller + "\n" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+// fingerprint identifies the request a key was first used for.
+func fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func replay(w http.ResponseWriter, rec *Record) {
+	if rec.ContentType != "" {
+		w.Header().Set("Content-Type", rec.ContentType)
+	}
+	if rec.Location != "" {
+		w.Header().Set("Location", rec.Location)
+	}
+	w.Header().Set(ReplayedHeader, "true")
+	w.WriteHeader(rec.Status)
+	w.Write(rec.Body)
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	body := map[string]string{"error": message}
+	if id := logging.RequestID(r.Context()); id != "" {
+		body["request_id"] = id
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// capture passes a response through while keeping a copy.
+type capture struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (c *capture) WriteHeader(status int) {
+	if !c.wroteHeader {
+		c.status, c.wroteHeader = status, true
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *capture) Write(b []byte) (int, error) {
+	c.wroteHeader = true
+	c.body.Write(b)
+	return c.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (c *capture) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
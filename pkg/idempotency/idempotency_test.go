@@ -0,0 +1,104 @@
+package idempotency
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// memStore is a Store without expiry.
+type memStore struct {
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+func (s *memStore) Begin(_ context.Context, key, fingerprint string) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rec, ok := s.records[key]; ok {
+		return &rec, nil
+	}
+	s.records[key] = Record{Fingerprint: fingerprint}
+	return nil, nil
+}
+
+func (s *memStore) Finish(_ context.Context, key string, rec Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[key] = rec
+	return nil
+}
+
+func (s *memStore) Abandon(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+func TestHandle(t *testing.T) {
+	calls := 0
+	status := http.StatusCreated
+	store := &memStore{records: map[string]Record{}}
+	h := Handle(store, func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		calls++
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(`{"got":` + string(body) + `}`))
+	})
+	post := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/book", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(Header, key)
+		}
+		rr := httptest.NewRecorder()
+		h(rr, req, nil)
+		return rr
+	}
+
+	first := post("k1", `"a"`)
+	if first.Code != http.StatusCreated || first.Body.String() != `{"got":"a"}` {
+		t.Fatalf("first request: got %v %s", first.Code, first.Body)
+	}
+	retry := post("k1", `"a"`)
+	if calls != 1 || retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() {
+		t.Errorf("retry not replayed: %d calls, got %v %s", calls, retry.Code, retry.Body)
+	}
+	if retry.Header().Get(ReplayedHeader) != "true" || retry.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("wrong replay headers: %v", retry.Header())
+	}
+	if rr := post("k1", `"b"`); rr.Code != http.StatusUnprocessableEntity || calls != 1 {
+		t.Errorf("reused key: got %v with %d calls want %v", rr.Code, calls, http.StatusUnprocessableEntity)
+	}
+	post("", `"a"`)
+	post("", `"a"`)
+	if calls != 3 {
+		t.Errorf("requests without a key should always run: %d calls want 3", calls)
+	}
+
+	// Server errors free the key for a retry.
+	status = http.StatusServiceUnavailable
+	post("k2", `"c"`)
+	status = http.StatusCreated
+	if rr := post("k2", `"c"`); rr.Code != http.StatusCreated || calls != 5 {
+		t.Errorf("retry after a server error: got %v with %d calls", rr.Code, calls)
+	}
+
+	store.records[scope("", "k3")] = Record{Fingerprint: fingerprint(httptest.NewRequest(http.MethodPost, "/book", nil), []byte(`"d"`))}
+	if rr := post("k3", `"d"`); rr.Code != http.StatusConflict {
+		t.Errorf("key in progress: got %v want %v", rr.Code, http.StatusConflict)
+	}
+}
+
+func TestScope(t *testing.T) {
+	if scope("alice", "k") == scope("bob", "k") {
+		t.Error("keys should be scoped to the caller")
+	}
+}
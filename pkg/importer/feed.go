@@ -0,0 +1,127 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/adedaryorh/bookstore-app/pkg/bookio"
+	"github.com/adedaryorh/bookstore-app/pkg/models"
+)
+
+// Feed polls a publisher's ONIX feed and imports what changed. Each ONIX
+// message is applied as a set of notifications: products are upserted by
+// ISBN and delete notifications remove the book. A poll is skipped when the
+// server reports the feed unchanged, or when the message is not newer than
+// the last one imported.
+type Feed struct {
+	URL      string
+	Interval time.Duration
+	// Currency picks which ONIX price becomes Book.Price.
+	Currency string
+	Client   *http.Client
+
+	etag         string
+	lastModified string
+	lastSent     time.Time
+}
+
+// Run polls the feed immediately and then every Interval until ctx is done.
+func (f *Feed) Run(ctx context.Context) {
+	ticker := time.NewTicker(f.Interval)
+	defer ticker.Stop()
+	for {
+		rep, err := f.Poll(ctx)
+		switch {
+		case err != nil:
+			slog.WarnContext(ctx, "ONIX feed import failed", "url", f.URL, "error", err)
+		case rep != nil:
+			slog.InfoContext(ctx, "ONIX feed imported", "url", f.URL, "import_id", rep.ID, "rows", rep.Rows,
+				"created", rep.Created, "updated", rep.Updated, "deleted", rep.Deleted, "failed", rep.Failed)
+			for _, e := range rep.Errors {
+				slog.WarnContext(ctx, "ONIX feed product skipped", "import_id", rep.ID, "line", e.Line, "isbn", e.ISBN, "error", e.Error)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll fetches and imports the feed once. It returns a nil report when
+// there was nothing new.
+func (f *Feed) Poll(ctx context.Context) (*Report, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if f.etag != "" {
+		req.Header.Set("If-None-Match", f.etag)
+	}
+	if f.lastModified != "" {
+		req.Header.Set("If-Modified-Since", f.lastModified)
+	}
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("feed returned %s", resp.Status)
+	}
+
+	onix := &newerThan{ONIXReader: bookio.NewONIXReader(resp.Body, f.Currency), since: f.lastSent}
+	rep := NewReport("onix", false)
+	if err := Run(ctx, onix, rep); err != nil {
+		return nil, err
+	}
+	if onix.stale {
+		return nil, nil
+	}
+
+	// Only remember the feed's version once it has been applied, so a
+	// failed poll is retried in full.
+	f.etag = resp.Header.Get("ETag")
+	f.lastModified = resp.Header.Get("Last-Modified")
+	if !onix.SentAt.IsZero() {
+		f.lastSent = onix.SentAt
+	}
+	return rep, nil
+}
+
+// newerThan ends an ONIX message early when its SentDateTime shows it was
+// already imported.
+type newerThan struct {
+	*bookio.ONIXReader
+	since   time.Time
+	checked bool
+	stale   bool
+}
+
+func (n *newerThan) Read() (*models.Book, error) {
+	book, err := n.ONIXReader.Read()
+	if !n.checked && (err == nil || errors.Is(err, io.EOF)) {
+		n.checked = true
+		if !n.since.IsZero() && !n.SentAt.IsZero() && !n.SentAt.After(n.since) {
+			n.stale = true
+			return nil, io.EOF
+		}
+	}
+	return book, err
+}
@@ -0,0 +1,82 @@
+package importer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// feedMessage has a single product without an ISBN, so importing it never
+// reaches the database.
+const feedMessage = `<ONIXMessage release="3.0">
+<Header><SentDateTime>20240301T0900Z</SentDateTime></Header>
+<Product>
+  <RecordReference>r1</RecordReference>
+  <NotificationType>03</NotificationType>
+  <DescriptiveDetail><TitleDetail><TitleType>01</TitleType>
+    <TitleElement><TitleElementLevel>01</TitleElementLevel><TitleText>No ISBN</TitleText></TitleElement>
+  </TitleDetail></DescriptiveDetail>
+</Product>
+</ONIXMessage>`
+
+func TestFeedPollIsIncremental(t *testing.T) {
+	honourETag := true
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if honourETag && r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(feedMessage))
+	}))
+	defer srv.Close()
+
+	feed := &Feed{URL: srv.URL, Currency: "USD"}
+	rep, err := feed.Poll(context.Background())
+	if err != nil {
+		t.Fatalf("Poll failed: %v", err)
+	}
+	if rep == nil || rep.Rows != 1 || rep.Failed != 1 {
+		t.Fatalf("wrong report: %+v", rep)
+	}
+
+	rep, err = feed.Poll(context.Background())
+	if err != nil || rep != nil {
+		t.Errorf("unchanged feed should be skipped: got %+v, %v", rep, err)
+	}
+
+	// A server without conditional requests resends the same message,
+	// which is recognised by its SentDateTime.
+	honourETag = false
+	rep, err = feed.Poll(context.Background())
+	if err != nil || rep != nil {
+		t.Errorf("message already imported should be skipped: got %+v, %v", rep, err)
+	}
+	if requests != 3 {
+		t.Errorf("got %d requests want 3", requests)
+	}
+}
+
+func TestFeedPollErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/broken" {
+			w.Write([]byte("<html>not onix</html>"))
+			return
+		}
+		http.Error(w, "nope", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	for _, path := range []string{"/forbidden", "/broken"} {
+		feed := &Feed{URL: srv.URL + path, Currency: "USD"}
+		if _, err := feed.Poll(context.Background()); err == nil {
+			t.Errorf("%s: expected an error", path)
+		}
+		if feed.etag != "" || !feed.lastSent.IsZero() {
+			t.Errorf("%s: failed poll should not be remembered", path)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+// Package importer applies decoded catalog files to the book store.
+package importer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/adedaryorh/bookstore-app/pkg/bookio"
+	"github.com/adedaryorh/bookstore-app/pkg/models"
+)
+
+// maxErrors bounds the memory a single bad file can pin.
+const maxErrors = 10000
+
+// Report summarises an import. Rows are the records the file contains; each
+// is created, updated, deleted or failed.
+type Report struct {
+	ID              string    `json:"id"`
+	Format          string    `json:"format"`
+	DryRun          bool      `json:"dry_run"`
+	StartedAt       time.Time `json:"started_at"`
+	Rows            int       `json:"rows"`
+	Created         int       `json:"created"`
+	Updated         int       `json:"updated"`
+	Deleted         int       `json:"deleted,omitempty"`
+	Failed          int       `json:"failed"`
+	IgnoredColumns  []string  `json:"ignored_columns,omitempty"`
+	Errors          []Error   `json:"errors"`
+	ErrorsTruncated bool      `json:"errors_truncated,omitempty"`
+	ErrorReport     string    `json:"error_report,omitempty"`
+}
+
+// Error describes a row that was not imported.
+type Error struct {
+	Line  int    `json:"line"`
+	ISBN  string `json:"isbn,omitempty"`
+	Title string `json:"title,omitempty"`
+	Error string `json:"error"`
+}
+
+// NewReport starts a report for an import of format.
+func NewReport(format string, dryRun bool) *Report {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return &Report{
+		ID:        hex.EncodeToString(b),
+		Format:    format,
+		DryRun:    dryRun,
+		StartedAt: time.Now(),
+		Errors:    []Error{},
+	}
+}
+
+func (rep *Report) fail(line int, book *models.Book, err error) {
+	rep.Failed++
+	if len(rep.Errors) >= maxErrors {
+		rep.ErrorsTruncated = true
+		return
+	}
+	e := Error{Line: line, Error: strings.ReplaceAll(err.Error(), "\n", "; ")}
+	if book != nil {
+		e.ISBN, e.Title = book.ISBN, book.Title
+	}
+	rep.Errors = append(rep.Errors, e)
+}
+
+// Run updates the book with the same ISBN, or creates a new one, for every
+// book reader yields, and deletes the books a bookio.Deleter marks as
+// deleted. Bad rows are recorded in rep and skipped. Run stops early only if
+// the input can't be read any further or the database goes away; rows saved
+// until then stay saved, and running the same file again is safe since rows
+// are matched by ISBN.
+func Run(ctx context.Context, reader bookio.Reader, rep *Report) error {
+	deleter, _ := reader.(bookio.Deleter)
+	for {
+		book, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		var rowErr *bookio.RowError
+		if errors.As(err, &rowErr) {
+			rep.Rows++
+			rep.fail(rowErr.Line, nil, rowErr.Err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		rep.Rows++
+
+		if deleter != nil && deleter.Deleted() {
+			err = remove(ctx, book, reader.Line(), rep)
+		} else {
+			err = upsert(ctx, book, reader.Line(), rep)
+		}
+		if errors.Is(err, models.ErrDatabaseUnavailable) {
+			return err
+		}
+		if err != nil {
+			slog.WarnContext(ctx, "import row failed", "import_id", rep.ID, "line", reader.Line(), "error", err)
+			rep.fail(reader.Line(), book, errors.New("could not be saved"))
+		}
+	}
+}
+
+func upsert(ctx context.Context, book *models.Book, line int, rep *Report) error {
+	if err := validate(book); err != nil {
+		rep.fail(line, book, err)
+		return nil
+	}
+	created, err := models.UpsertBookByISBN(ctx, book, rep.DryRun)
+	switch {
+	case errors.Is(err, models.ErrDuplicateISBN):
+		rep.fail(line, book, err)
+	case err != nil:
+		return err
+	case created:
+		rep.Created++
+	default:
+		rep.Updated++
+	}
+	return nil
+}
+
+func remove(ctx context.Context, book *models.Book, line int, rep *Report) error {
+	if book.ISBN == "" {
+		rep.fail(line, book, errors.New("isbn is required"))
+		return nil
+	}
+	if err := book.NormalizeISBN(); err != nil {
+		rep.fail(line, book, err)
+		return nil
+	}
+	existing, err := models.GetBookByISBN(models.UsePrimary(ctx), book.ISBN)
+	switch {
+	case errors.Is(err, models.ErrBookNotFound):
+		// Already gone; deleting is idempotent.
+	case err != nil:
+		return err
+	case !rep.DryRun:
+		if _, err := models.DeleteBook(ctx, existing.ID); err != nil && !errors.Is(err, models.ErrBookNotFound) {
+			return err
+		}
+	}
+	rep.Deleted++
+	return nil
+}
+
+func validate(book *models.Book) error {
+	err := book.Validate()
+	if book.ISBN == "" {
+		err = errors.Join(errors.New("isbn is required"), err)
+	}
+	return err
+}
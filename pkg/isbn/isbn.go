@@ -0,0 +1,139 @@
+// Package isbn parses and validates International Standard Book Numbers.
+//
+// Books are stored under their canonical form: the 13 digit ISBN without
+// hyphens or spaces. ISBN-10s are converted on the way in, so a book can be
+// looked up by either form.
+package isbn
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrInvalid is returned for input that isn't shaped like an ISBN.
+	ErrInvalid = errors.New("not an ISBN-10 or ISBN-13")
+	// ErrChecksum is returned when the check digit doesn't match.
+	ErrChecksum = errors.New("wrong ISBN check digit")
+)
+
+// Clean strips the "ISBN" prefix, hyphens and spaces people write ISBNs
+// with, and upper-cases an ISBN-10's X check digit. It doesn't validate.
+func Clean(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 4 && strings.EqualFold(s[:4], "isbn") {
+		s = s[4:]
+		if strings.HasPrefix(s, "-10") || strings.HasPrefix(s, "-13") {
+			s = s[3:]
+		}
+		s = strings.TrimLeft(s, ": ")
+	}
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '-', ' ', '‐', '‑', '–':
+			return -1
+		case 'x':
+			return 'X'
+		}
+		return r
+	}, s)
+}
+
+// Normalize returns the canonical ISBN-13 for s, which may be an ISBN-10
+// or ISBN-13 with or without hyphens.
+func Normalize(s string) (string, error) {
+	c := Clean(s)
+	switch len(c) {
+	case 10:
+		if err := check10(c); err != nil {
+			return "", fmt.Errorf("%q: %w", s, err)
+		}
+		return to13(c), nil
+	case 13:
+		if err := check13(c); err != nil {
+			return "", fmt.Errorf("%q: %w", s, err)
+		}
+		return c, nil
+	}
+	return "", fmt.Errorf("%q: %w", s, ErrInvalid)
+}
+
+// Valid reports whether s is an ISBN-10 or ISBN-13 with a correct check
+// digit.
+func Valid(s string) bool {
+	_, err := Normalize(s)
+	return err == nil
+}
+
+// To10 returns the ISBN-10 for an ISBN-13 in the 978 range. ISBNs starting
+// 979 have no ISBN-10 and ok is false for them.
+func To10(s string) (isbn10 string, ok bool) {
+	n, err := Normalize(s)
+	if err != nil || !strings.HasPrefix(n, "978") {
+		return "", false
+	}
+	body := n[3:12]
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += int(body[i]-'0') * (10 - i)
+	}
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return body + "X", true
+	}
+	return body + string(rune('0'+check)), true
+}
+
+func check10(s string) error {
+	sum := 0
+	for i := 0; i < 10; i++ {
+		var d int
+		switch c := s[i]; {
+		case c >= '0' && c <= '9':
+			d = int(c - '0')
+		case c == 'X' && i == 9:
+			d = 10
+		default:
+			return ErrInvalid
+		}
+		sum += d * (10 - i)
+	}
+	if sum%11 != 0 {
+		return ErrChecksum
+	}
+	return nil
+}
+
+func check13(s string) error {
+	for i := 0; i < 13; i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return ErrInvalid
+		}
+	}
+	if !strings.HasPrefix(s, "978") && !strings.HasPrefix(s, "979") {
+		return ErrInvalid
+	}
+	if checkDigit13(s[:12]) != s[12] {
+		return ErrChecksum
+	}
+	return nil
+}
+
+// to13 converts a valid ISBN-10 to its ISBN-13 under the 978 prefix.
+func to13(s string) string {
+	body := "978" + s[:9]
+	return body + string(checkDigit13(body))
+}
+
+func checkDigit13(body string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		d := int(body[i] - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	return byte('0' + (10-sum%10)%10)
+}
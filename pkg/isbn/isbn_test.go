@@ -0,0 +1,66 @@
+package isbn
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"9780441013593", "9780441013593"},
+		{"978-0-441-01359-3", "9780441013593"},
+		{"0441013597", "9780441013593"},
+		{"0-441-01359-7", "9780441013593"},
+		{"ISBN 0-8044-2957-X", "9780804429573"},
+		{"isbn-10: 080442957x", "9780804429573"},
+		{"ISBN-13: 979-10-90636-07-1", "9791090636071"},
+		{" 978 0 13 235088 4 ", "9780132350884"},
+	}
+	for _, tt := range tests {
+		got, err := Normalize(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("Normalize(%q) = %q, %v want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestNormalizeRejects(t *testing.T) {
+	tests := []struct {
+		in   string
+		want error
+	}{
+		{"", ErrInvalid},
+		{"12345", ErrInvalid},
+		{"1234567890123", ErrInvalid}, // no 978/979 prefix
+		{"12345678901234", ErrInvalid},
+		{"978044101359X", ErrInvalid},
+		{"X441013597", ErrInvalid},
+		{"9780441013594", ErrChecksum},
+		{"0441013598", ErrChecksum},
+	}
+	for _, tt := range tests {
+		if _, err := Normalize(tt.in); !errors.Is(err, tt.want) {
+			t.Errorf("Normalize(%q) error = %v want %v", tt.in, err, tt.want)
+		}
+	}
+}
+
+func TestTo10(t *testing.T) {
+	tests := []struct {
+		in, want string
+		ok       bool
+	}{
+		{"9780441013593", "0441013597", true},
+		{"978-0-8044-2957-3", "080442957X", true},
+		{"9791090636071", "", false},
+		{"9780441013594", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := To10(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("To10(%q) = %q, %v want %q, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package logging
+
+import "context"
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	callerKey
+)
+
+// WithRequestID returns a copy of ctx carrying the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the request ID stored in ctx, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+type caller struct {
+	id      string
+	claimed bool
+}
+
+// WithCaller returns a copy of ctx carrying the caller identity.
+func WithCaller(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, callerKey, caller{id: id})
+}
+
+// WithClaimedCaller is WithCaller for an identity the caller asserted and
+// nothing checked, such as an X-Client-ID header.
+func WithClaimedCaller(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, callerKey, caller{id: id, claimed: true})
+}
+
+// Caller returns the caller identity stored in ctx, or "".
+func Caller(ctx context.Context) string {
+	c, _ := ctx.Value(callerKey).(caller)
+	return c.id
+}
+
+// CallerClaimed reports whether the caller identity in ctx is only what
+// the caller claimed to be.
+func CallerClaimed(ctx context.Context) bool {
+	c, _ := ctx.Value(callerKey).(caller)
+	return c.claimed
+}
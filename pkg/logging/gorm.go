@@ -0,0 +1,13 @@
+package logging
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// GormLogger forwards gorm's log output to the default slog logger.
+type GormLogger struct{}
+
+func (GormLogger) Print(values ...interface{}) {
+	slog.Warn("database", "detail", fmt.Sprint(values...))
+}
@@ -0,0 +1,57 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestLoggerAddsRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, Options{Level: "info", Format: "json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := WithRequestID(context.Background(), "abc123")
+	logger.InfoContext(ctx, "hello", "book_id", 7)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("log line is not valid JSON: %v", err)
+	}
+	if entry["request_id"] != "abc123" {
+		t.Errorf("request_id missing: %v", entry)
+	}
+	if entry["book_id"] != float64(7) {
+		t.Errorf("book_id missing: %v", entry)
+	}
+}
+
+func TestLoggerLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, Options{Level: "warn", Format: "text"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger.Info("dropped")
+	if buf.Len() != 0 {
+		t.Errorf("info record should be filtered at warn level: %s", buf.String())
+	}
+	logger.With(slog.String("component", "test")).Warn("kept")
+	if !bytes.Contains(buf.Bytes(), []byte("component=test")) {
+		t.Errorf("attributes lost through WithAttrs: %s", buf.String())
+	}
+}
+
+func TestNewRejectsInvalidOptions(t *testing.T) {
+	if _, err := New(&bytes.Buffer{}, Options{Level: "loud"}); err == nil {
+		t.Error("expected error for unknown level")
+	}
+	if _, err := New(&bytes.Buffer{}, Options{Format: "xml"}); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/adedaryorh/bookstore-app/pkg/logging"
+	"github.com/julienschmidt/httprouter"
+)
+
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, logging.Options{Level: "debug", Format: "json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := slog.Default()
+	slog.SetDefault(logger)
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+func TestRequestIDGenerated(t *testing.T) {
+	var seen string
+	handler := RequestID(func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		seen = logging.RequestID(r.Context())
+	})
+
+	req, _ := http.NewRequest("GET", "/books", nil)
+	rr := httptest.NewRecorder()
+	handler(rr, req, nil)
+
+	if len(seen) != 32 {
+		t.Errorf("expected a generated 32 character request ID, got %q", seen)
+	}
+	if got := rr.Header().Get(RequestIDHeader); got != seen {
+		t.Errorf("response header mismatch: got %v want %v", got, seen)
+	}
+}
+
+func TestRequestIDPropagated(t *testing.T) {
+	var seen string
+	handler := RequestID(func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		seen = logging.RequestID(r.Context())
+	})
+
+	req, _ := http.NewRequest("GET", "/books", nil)
+	req.Header.Set(RequestIDHeader, "upstream-123")
+	handler(httptest.NewRecorder(), req, nil)
+
+	if seen != "upstream-123" {
+		t.Errorf("request ID not propagated: got %v want %v", seen, "upstream-123")
+	}
+
+	req.Header.Set(RequestIDHeader, "has spaces\nand newlines")
+	handler(httptest.NewRecorder(), req, nil)
+
+	if seen == "has spaces\nand newlines" {
+		t.Error("invalid request ID should be replaced")
+	}
+}
+
+func TestIdentify(t *testing.T) {
+	var caller string
+	var claimed bool
+	handler := Identify(func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		caller, claimed = logging.Caller(r.Context()), logging.CallerClaimed(r.Context())
+	})
+
+	for _, tt := range []struct {
+		name     string
+		clientID string
+		user     string
+		want     string
+		claimed  bool
+	}{
+		{"client ID", "inventory", "", "inventory", true},
+		{"basic auth", "", "alice", "alice", true},
+		{"nobody", "", "", "anonymous@192.0.2.1", false},
+		{"overlong client ID", strings.Repeat("x", maxClientIDLength+1), "", "anonymous@192.0.2.1", false},
+		{"control characters", "inventory\nadmin", "alice", "alice", true},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/books", nil)
+		if tt.clientID != "" {
+			req.Header.Set("X-Client-ID", tt.clientID)
+		}
+		if tt.user != "" {
+			req.SetBasicAuth(tt.user, "")
+		}
+		handler(httptest.NewRecorder(), req, nil)
+		if caller != tt.want || claimed != tt.claimed {
+			t.Errorf("%s: got %q claimed %v want %q claimed %v", tt.name, caller, claimed, tt.want, tt.claimed)
+		}
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	buf := captureLogs(t)
+
+	var h httprouter.Handle = func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":1}`))
+	}
+	h = AccessLog("/book", h)
+	h = Identify(h)
+	h = RequestID(h)
+
+	req, _ := http.NewRequest("POST", "/book", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	req.Header.Set("X-Client-ID", "nightly-sync")
+	h(httptest.NewRecorder(), req, nil)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("log line is not valid JSON: %v: %s", err, buf.String())
+	}
+
+	expected := map[string]interface{}{
+		"msg":        "request",
+		"method":     "POST",
+		"route":      "/book",
+		"status":     float64(http.StatusCreated),
+		"bytes":      float64(8),
+		"caller":     "nightly-sync",
+		"request_id": "req-1",
+	}
+	for key, want := range expected {
+		if got := entry[key]; got != want {
+			t.Errorf("log field %s: got %v want %v", key, got, want)
+		}
+	}
+	if _, ok := entry["duration"]; !ok {
+		t.Error("log line is missing duration")
+	}
+}
+
+func TestAccessLogLevels(t *testing.T) {
+	buf := captureLogs(t)
+
+	handler := AccessLog("/book/:bookId", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	req, _ := http.NewRequest("PUT", "/book/1", nil)
+	handler(httptest.NewRecorder(), req, nil)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("log line is not valid JSON: %v", err)
+	}
+	if entry["level"] != "ERROR" {
+		t.Errorf("server errors should log at ERROR, got %v", entry["level"])
+	}
+	if entry["caller"] != "" {
+		t.Errorf("caller should be empty without Identify, got %v", entry["caller"])
+	}
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestAdminOnly(t *testing.T) {
+	ok := func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {}
+	tests := []struct {
+		name   string
+		token  string
+		header string
+		want   int
+	}{
+		{"open", "", "", http.StatusOK},
+		{"missing", "s3cret", "", http.StatusUnauthorized},
+		{"wrong", "s3cret", "Bearer guess", http.StatusUnauthorized},
+		{"basic", "s3cret", "Basic czNjcmV0", http.StatusUnauthorized},
+		{"right", "s3cret", "Bearer s3cret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/admin/audit", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		AdminOnly(tt.token, ok)(rr, req, nil)
+		if rr.Code != tt.want {
+			t.Errorf("%s: got %v want %v", tt.name, rr.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// CacheControl sets the Cache-Control header to policy on successful and
+// 304 responses, unless the handler chose its own. Error responses are left
+// alone so a cache never keeps a transient failure.
+func CacheControl(policy string, next httprouter.Handle) httprouter.Handle {
+	if policy == "" {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		next(&cacheControlWriter{ResponseWriter: w, policy: policy}, r, ps)
+	}
+}
+
+type cacheControlWriter struct {
+	http.ResponseWriter
+	policy      string
+	wroteHeader bool
+}
+
+func (w *cacheControlWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		h := w.Header()
+		if (status < http.StatusMultipleChoices || status == http.StatusNotModified) && h.Get("Cache-Control") == "" {
+			h.Set("Cache-Control", w.policy)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *cacheControlWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *cacheControlWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
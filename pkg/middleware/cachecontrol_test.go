@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestCacheControl(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler httprouter.Handle
+		want    string
+	}{
+		{"implicit 200", func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+			w.Write([]byte("ok"))
+		}, "public, max-age=60"},
+		{"not modified", func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+			w.WriteHeader(http.StatusNotModified)
+		}, "public, max-age=60"},
+		{"error", func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}, ""},
+		{"handler override", func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+			w.Header().Set("Cache-Control", "no-store")
+			w.WriteHeader(http.StatusOK)
+		}, "no-store"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			h := CacheControl("public, max-age=60", tt.handler)
+			h(rr, httptest.NewRequest(http.MethodGet, "/books", nil), nil)
+			if got := rr.Header().Get("Cache-Control"); got != tt.want {
+				t.Errorf("got Cache-Control %q want %q", got, tt.want)
+			}
+		})
+	}
+}
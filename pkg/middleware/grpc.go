@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/adedaryorh/bookstore-app/pkg/logging"
+	"github.com/adedaryorh/bookstore-app/pkg/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryInterceptor gives unary gRPC calls what the shared HTTP middleware
+// gives requests: a request ID, the caller's identity, a server span and
+// an access log line.
+func UnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, done := startRPC(ctx, info.FullMethod)
+	resp, err := handler(ctx, req)
+	done(err)
+	return resp, err
+}
+
+// StreamInterceptor is UnaryInterceptor for streaming calls.
+func StreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, done := startRPC(ss.Context(), info.FullMethod)
+	err := handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	done(err)
+	return err
+}
+
+// RecoverUnary fails a unary call whose handler panics with Internal, as
+// net/http survives a panicking handler, instead of letting the panic stop
+// the server. It goes after UnaryInterceptor in the chain, so the call is
+// still logged.
+func RecoverUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = recovered(ctx, info.FullMethod, p)
+		}
+	}()
+	return handler(ctx, req)
+}
+
+// RecoverStream is RecoverUnary for streaming calls.
+func RecoverStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = recovered(ss.Context(), info.FullMethod, p)
+		}
+	}()
+	return handler(srv, ss)
+}
+
+func recovered(ctx context.Context, method string, p interface{}) error {
+	slog.ErrorContext(ctx, "rpc panicked", "method", method, "panic", fmt.Sprint(p), "stack", string(debug.Stack()))
+	return status.Error(codes.Internal, "Internal error")
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// startRPC sets a call up as RequestID, Identify and Trace set requests
+// up, and returns a func that ends the span and logs the call as
+// AccessLog does.
+func startRPC(ctx context.Context, method string) (context.Context, func(error)) {
+	start := time.Now()
+	md, _ := metadata.FromIncomingContext(ctx)
+	id := firstValue(md, RequestIDHeader)
+	if !validRequestID(id) {
+		id = newRequestID()
+	}
+	// Fails only outside a real call, as in tests.
+	_ = grpc.SetHeader(ctx, metadata.Pairs(RequestIDHeader, id))
+	ctx = logging.WithRequestID(ctx, id)
+	remote := ""
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		remote = p.Addr.String()
+	}
+	// Callers are identified as Identify does, from the x-client-id
+	// metadata or else the network address.
+	if caller := firstValue(md, "X-Client-ID"); validClientID(caller) {
+		ctx = logging.WithClaimedCaller(ctx, caller)
+	} else {
+		ctx = logging.WithCaller(ctx, anonymous(remote))
+	}
+
+	service, name, _ := strings.Cut(strings.TrimPrefix(method, "/"), "/")
+	ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+	ctx, span := tracing.Tracer().Start(ctx, strings.TrimPrefix(method, "/"),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("rpc.system", "grpc"),
+			attribute.String("rpc.service", service),
+			attribute.String("rpc.method", name),
+		),
+	)
+
+	return ctx, func(err error) {
+		code := status.Code(err)
+		level := slog.LevelInfo
+		switch code {
+		case codes.OK:
+		case codes.Unknown, codes.Internal, codes.Unavailable, codes.DataLoss, codes.Unimplemented:
+			level = slog.LevelError
+			span.SetStatus(otelcodes.Error, code.String())
+		default:
+			level = slog.LevelWarn
+		}
+		span.SetAttributes(attribute.Int("rpc.grpc.status_code", int(code)))
+		span.End()
+
+		slog.LogAttrs(ctx, level, "rpc",
+			slog.String("method", method),
+			slog.String("code", code.String()),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("caller", logging.Caller(ctx)),
+			slog.String("remote_addr", remote),
+			slog.String("user_agent", firstValue(md, "user-agent")),
+		)
+	}
+}
+
+func firstValue(md metadata.MD, key string) string {
+	if v := md.Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// metadataCarrier lets the trace propagator read traceparent from gRPC
+// metadata.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	return firstValue(metadata.MD(c), key)
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/adedaryorh/bookstore-app/pkg/logging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryInterceptor(t *testing.T) {
+	logs := captureLogs(t)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-request-id", "upstream-123", "x-client-id", "inventory"))
+	ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}})
+
+	var requestID, caller string
+	_, err := UnaryInterceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/bookstore.v1.BookCatalog/GetBook"},
+		func(ctx context.Context, _ interface{}) (interface{}, error) {
+			requestID, caller = logging.RequestID(ctx), logging.Caller(ctx)
+			return nil, status.Error(codes.NotFound, "Book not found")
+		})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("the handler's error should be returned: got %v", err)
+	}
+	if requestID != "upstream-123" || caller != "inventory" {
+		t.Errorf("got request ID %q caller %q", requestID, caller)
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+		t.Fatalf("decoding %s: %v", logs, err)
+	}
+	want := map[string]interface{}{
+		"level":       "WARN",
+		"msg":         "rpc",
+		"method":      "/bookstore.v1.BookCatalog/GetBook",
+		"code":        "NotFound",
+		"request_id":  "upstream-123",
+		"caller":      "inventory",
+		"remote_addr": "10.0.0.1:5000",
+	}
+	for k, v := range want {
+		if entry[k] != v {
+			t.Errorf("%s: got %v want %v", k, entry[k], v)
+		}
+	}
+}
+
+func TestStreamInterceptorIdentifiesAnonymousCallers(t *testing.T) {
+	captureLogs(t)
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 5000}})
+
+	var requestID, caller string
+	err := StreamInterceptor(nil, fakeStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: "/bookstore.v1.BookCatalog/ListBooks"},
+		func(_ interface{}, ss grpc.ServerStream) error {
+			requestID, caller = logging.RequestID(ss.Context()), logging.Caller(ss.Context())
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requestID) != 32 {
+		t.Errorf("expected a generated 32 character request ID, got %q", requestID)
+	}
+	if caller != "anonymous@10.0.0.2" {
+		t.Errorf("got caller %q", caller)
+	}
+}
+
+type fakeStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s fakeStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestRecoverTurnsPanicsIntoInternal(t *testing.T) {
+	logs := captureLogs(t)
+	ctx := context.Background()
+
+	_, err := RecoverUnary(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/bookstore.v1.BookCatalog/GetBook"},
+		func(context.Context, interface{}) (interface{}, error) {
+			panic("boom")
+		})
+	if status.Code(err) != codes.Internal {
+		t.Errorf("unary: got %v want %v", err, codes.Internal)
+	}
+	err = RecoverStream(nil, fakeStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: "/bookstore.v1.BookCatalog/ListBooks"},
+		func(interface{}, grpc.ServerStream) error {
+			panic("boom")
+		})
+	if status.Code(err) != codes.Internal {
+		t.Errorf("stream: got %v want %v", err, codes.Internal)
+	}
+	if !strings.Contains(logs.String(), `"panic":"boom"`) {
+		t.Errorf("the panic should be logged: %s", logs)
+	}
+}
@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"net/http"
+
+	"github.com/adedaryorh/bookstore-app/pkg/logging"
+	"github.com/julienschmidt/httprouter"
+)
+
+// RequestIDHeader carries the request ID in both directions.
+const RequestIDHeader = "X-Request-ID"
+
+const maxRequestIDLength = 128
+
+// maxClientIDLength bounds the identities callers give themselves, well
+// inside the columns they are stored in.
+const maxClientIDLength = 128
+
+// RequestID propagates the caller's X-Request-ID, or generates one, and
+// stores it in the request context and the response headers.
+func RequestID(next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next(w, r.WithContext(logging.WithRequestID(r.Context(), id)), ps)
+	}
+}
+
+// Identify records who is calling so logs and audit entries can name them.
+// Callers identify themselves with X-Client-ID or HTTP basic auth, which
+// nothing checks, so the identity is marked as claimed; anyone else, or
+// anyone giving an identity too long or with characters other than
+// printable ASCII, is identified by their network address.
+func Identify(next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		ctx := r.Context()
+		if id, claimed := callerIdentity(r); claimed {
+			ctx = logging.WithClaimedCaller(ctx, id)
+		} else {
+			ctx = logging.WithCaller(ctx, id)
+		}
+		next(w, r.WithContext(ctx), ps)
+	}
+}
+
+func callerIdentity(r *http.Request) (id string, claimed bool) {
+	if client := r.Header.Get("X-Client-ID"); validClientID(client) {
+		return client, true
+	}
+	if user, _, ok := r.BasicAuth(); ok && validClientID(user) {
+		return user, true
+	}
+	return anonymous(r.RemoteAddr), false
+}
+
+// anonymous names a caller by their network address.
+func anonymous(remote string) string {
+	host, _, err := net.SplitHostPort(remote)
+	if err != nil {
+		host = remote
+	}
+	return "anonymous@" + host
+}
+
+func validClientID(id string) bool {
+	return len(id) <= maxClientIDLength && printable(id)
+}
+
+func validRequestID(id string) bool {
+	return len(id) <= maxRequestIDLength && printable(id)
+}
+
+// printable reports whether s is non-empty printable ASCII without spaces.
+func printable(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x21 || s[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func setupRecorder(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return sr
+}
+
+func TestTracePropagatesTraceparent(t *testing.T) {
+	sr := setupRecorder(t)
+
+	router := httprouter.New()
+	router.GET("/book/:bookId", Trace("/book/:bookId", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+
+	req, _ := http.NewRequest("GET", "/book/42", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	spans := sr.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	span := spans[0]
+
+	if got := span.Name(); got != "GET /book/:bookId" {
+		t.Errorf("wrong span name: got %v want %v", got, "GET /book/:bookId")
+	}
+	if got := span.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace ID not propagated: got %v", got)
+	}
+	if got := span.Parent().SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Errorf("parent span ID not propagated: got %v", got)
+	}
+
+	var status int64
+	for _, attr := range span.Attributes() {
+		if attr.Key == "http.response.status_code" {
+			status = attr.Value.AsInt64()
+		}
+	}
+	if status != http.StatusNotFound {
+		t.Errorf("wrong status attribute: got %v want %v", status, http.StatusNotFound)
+	}
+	if span.Status().Code == codes.Error {
+		t.Errorf("4xx responses should not mark the span as failed")
+	}
+}
+
+func TestTraceMarksServerErrors(t *testing.T) {
+	sr := setupRecorder(t)
+
+	handler := Trace("/books", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	req, _ := http.NewRequest("GET", "/books", nil)
+	handler(httptest.NewRecorder(), req, nil)
+
+	spans := sr.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	if spans[0].Status().Code != codes.Error {
+		t.Errorf("expected error status, got %v", spans[0].Status().Code)
+	}
+	if spans[0].Parent().IsValid() {
+		t.Errorf("request without traceparent should start a new trace")
+	}
+}
@@ -0,0 +1,112 @@
+package models
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// The lookups below serve many keys in one query, for callers that gather
+// the keys of a whole response before loading them.
+
+// GetBooksPage returns one page of the books matching f, by ID.
+func GetBooksPage(ctx context.Context, f BookFilter, limit, offset int) ([]Book, error) {
+	var books []Book
+	err := read(ctx, func(db *gorm.DB) error {
+		return f.apply(db).Order("id").Limit(limit).Offset(offset).Find(&books).Error
+	})
+	if err != nil {
+		return nil, dbError(err)
+	}
+	return books, nil
+}
+
+// GetBooksByIDs returns the books with the given IDs, keyed by ID. IDs
+// without a book are left out.
+func GetBooksByIDs(ctx context.Context, ids []uint) (map[uint]*Book, error) {
+	var books []Book
+	err := read(ctx, func(db *gorm.DB) error {
+		return db.Where("id IN (?)", ids).Find(&books).Error
+	})
+	if err != nil {
+		return nil, dbError(err)
+	}
+	out := make(map[uint]*Book, len(books))
+	for i := range books {
+		out[books[i].ID] = &books[i]
+	}
+	return out, nil
+}
+
+// GetBooksByAuthors returns a page of each author's books, by ID, keyed by
+// the lowercased author as authors are matched ignoring case.
+func GetBooksByAuthors(ctx context.Context, authors []string, limit, offset int) (map[string][]Book, error) {
+	var books []Book
+	err := read(ctx, func(db *gorm.DB) error {
+		return db.Where(`id IN (SELECT id FROM (
+				SELECT id, row_number() OVER (PARTITION BY lower(author) ORDER BY id) AS n
+				FROM books WHERE lower(author) IN (?)) ranked
+			WHERE n > ? AND n <= ?)`, lower(authors), offset, offset+limit).
+			Order("id").Find(&books).Error
+	})
+	if err != nil {
+		return nil, dbError(err)
+	}
+	out := make(map[string][]Book, len(authors))
+	for _, b := range books {
+		key := strings.ToLower(b.Author)
+		out[key] = append(out[key], b)
+	}
+	return out, nil
+}
+
+// CountBooksByAuthors returns how many books each author has, keyed by the
+// lowercased author. Authors without books are left out.
+func CountBooksByAuthors(ctx context.Context, authors []string) (map[string]int, error) {
+	var rows []struct {
+		Author string
+		Count  int
+	}
+	err := read(ctx, func(db *gorm.DB) error {
+		return db.Model(&Book{}).Select("lower(author) AS author, count(*) AS count").
+			Where("lower(author) IN (?)", lower(authors)).Group("lower(author)").Scan(&rows).Error
+	})
+	if err != nil {
+		return nil, dbError(err)
+	}
+	out := make(map[string]int, len(rows))
+	for _, r := range rows {
+		out[r.Author] = r.Count
+	}
+	return out, nil
+}
+
+// GetBookHistories returns a page of each book's audit trail, newest
+// first, keyed by book ID.
+func GetBookHistories(ctx context.Context, ids []uint, limit, offset int) (map[uint][]AuditEntry, error) {
+	var entries []AuditEntry
+	err := read(ctx, func(db *gorm.DB) error {
+		return db.Where(`id IN (SELECT id FROM (
+				SELECT id, row_number() OVER (PARTITION BY book_id ORDER BY revision DESC) AS n
+				FROM audit_entries WHERE book_id IN (?)) ranked
+			WHERE n > ? AND n <= ?)`, ids, offset, offset+limit).
+			Order("book_id, revision DESC").Find(&entries).Error
+	})
+	if err != nil {
+		return nil, dbError(err)
+	}
+	out := make(map[uint][]AuditEntry, len(ids))
+	for _, e := range entries {
+		out[e.BookID] = append(out[e.BookID], e)
+	}
+	return out, nil
+}
+
+func lower(list []string) []string {
+	out := make([]string, len(list))
+	for i, s := range list {
+		out[i] = strings.ToLower(s)
+	}
+	return out
+}
@@ -1,10 +1,19 @@
 package models
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/adedaryorh/bookstore-app/pkg/config"
+	"github.com/adedaryorh/bookstore-app/pkg/isbn"
+	"github.com/adedaryorh/bookstore-app/pkg/tracing"
 	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
 )
 
 type Book struct {
@@ -15,47 +24,465 @@ type Book struct {
 	PublicationYear string    `json:"publication_year" db:"publication_year"`
 	Genre           *string   `json:"genre" db:"genre"`
 	Price           *float64  `json:"price" db:"price"`
+	CoverURL        *string   `json:"cover_url" db:"cover_url"`
 	CreatedAt       time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt       time.Time `json:"updated_at" db:"updated_at"`
 }
 
 var Db *gorm.DB
 
-func init() {
-	config.Connect()
+var (
+	// ErrBookNotFound is returned when no book matches a lookup.
+	ErrBookNotFound = errors.New("book not found")
+	// ErrDatabaseUnavailable wraps errors caused by a lost or unreachable
+	// database connection.
+	ErrDatabaseUnavailable = errors.New("database unavailable")
+	// ErrDuplicateISBN is returned, as a *DuplicateISBNError, when a book
+	// would share its ISBN with another.
+	ErrDuplicateISBN = errors.New("isbn is already used by another book")
+)
+
+// DuplicateISBNError names the book already using an ISBN.
+type DuplicateISBNError struct {
+	ISBN string
+	// BookID is 0 if the other book couldn't be looked up.
+	BookID uint
+}
+
+func (e *DuplicateISBNError) Error() string {
+	if e.BookID == 0 {
+		return fmt.Sprintf("isbn %s is already used by another book", e.ISBN)
+	}
+	return fmt.Sprintf("isbn %s is already used by book %d", e.ISBN, e.BookID)
+}
+
+func (e *DuplicateISBNError) Unwrap() error {
+	return ErrDuplicateISBN
+}
+
+// Init binds the models to the connection opened by config.Connect and
+// migrates the schema.
+func Init() error {
 	Db = config.GetDb()
-	Db.AutoMigrate(&Book{})
+	if Db == nil {
+		return errors.New("models: database is not connected")
+	}
+	tracing.RegisterCallbacks(Db)
+	err := Db.AutoMigrate(&Book{}, &OutboxEvent{}, &AuditEntry{}, &Webhook{}, &WebhookDelivery{}, &WebhookAttempt{}, &IdempotencyKey{}).Error
+	if err != nil {
+		return err
+	}
+	// The relay and the webhook dispatcher only ever look for work left to
+	// do.
+	for _, index := range []string{
+		"CREATE INDEX IF NOT EXISTS idx_outbox_events_pending ON outbox_events (id) WHERE published_at IS NULL",
+		"CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries (next_attempt_at) WHERE status = 'pending'",
+	} {
+		if err := Db.Exec(index).Error; err != nil {
+			return err
+		}
+	}
+	if err := canonicalizeISBNs(context.Background()); err != nil {
+		return err
+	}
+	return uniqueISBNs(Db)
 }
 
-func (b *Book) CreateBook() *Book {
-	Db.Create(b)
-	return b
+// uniqueISBNs enforces one book per ISBN with a partial unique index, so
+// any number of books can go without one. Duplicates saved before the
+// index existed have to be resolved by hand; until then they are logged
+// and the index is left out.
+func uniqueISBNs(db *gorm.DB) error {
+	var dups []struct {
+		ISBN  string
+		Books int
+	}
+	err := db.Raw("SELECT isbn, count(*) AS books FROM books WHERE isbn <> '' GROUP BY isbn HAVING count(*) > 1 ORDER BY isbn LIMIT 20").
+		Scan(&dups).Error
+	if err != nil {
+		return err
+	}
+	if len(dups) > 0 {
+		for _, d := range dups {
+			slog.Error("ISBN shared by several books, ISBN uniqueness is not enforced", "isbn", d.ISBN, "books", d.Books)
+		}
+		return nil
+	}
+	return db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_books_isbn ON books (isbn) WHERE isbn <> ''").Error
+}
+
+// canonicalizeISBNs rewrites ISBNs saved before they were normalized, such
+// as ISBN-10s or hyphenated ISBN-13s, into canonical form so lookups find
+// them. ISBNs that don't validate are left alone and logged. Each rewrite
+// goes through ModifyBook, so it is audited as a change by the system and
+// published like any other update.
+func canonicalizeISBNs(ctx context.Context) error {
+	var rows []struct {
+		ID   uint
+		ISBN string
+	}
+	err := conn(ctx).Model(&Book{}).Select("id, isbn").
+		Where("isbn <> '' AND isbn !~ '^97[89][0-9]{10}$'").Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		canonical, err := isbn.Normalize(row.ISBN)
+		if err != nil {
+			slog.Warn("book has an invalid ISBN", "book_id", row.ID, "isbn", row.ISBN)
+			continue
+		}
+		_, err = ModifyBook(ctx, row.ID, func(b *Book) error {
+			b.ISBN = canonical
+			return nil
+		})
+		switch {
+		case errors.Is(err, ErrDuplicateISBN):
+			slog.Warn("book's ISBN is another book's in another form", "book_id", row.ID, "isbn", row.ISBN)
+		case errors.Is(err, ErrBookNotFound):
+			// Deleted since it was listed.
+		case err != nil:
+			return err
+		}
+	}
+	return nil
 }
 
-func GetAllBooks() []Book {
+// conn returns Db bound to ctx so queries are traced under the caller's span.
+func conn(ctx context.Context) *gorm.DB {
+	return tracing.WithContext(Db, ctx)
+}
+
+// CreateBook saves b as a new book, setting its ID. It fails with a
+// *DuplicateISBNError if another book has the same ISBN.
+func (b *Book) CreateBook(ctx context.Context) error {
+	if err := b.NormalizeISBN(); err != nil {
+		return err
+	}
+	var ev *Event
+	err := inTx(ctx, func(tx *gorm.DB) (err error) {
+		ev, err = b.insert(ctx, tx)
+		return err
+	})
+	if err != nil {
+		return bookError(ctx, err, b.ISBN)
+	}
+	wrote(ctx)
+	books.invalidate(ctx, b.ID)
+	notify(ev)
+	return nil
+}
+
+// insert adds b within tx, recording it in the audit trail and the outbox,
+// and returns the event to notify once tx commits.
+func (b *Book) insert(ctx context.Context, tx *gorm.DB) (*Event, error) {
+	if err := tx.Create(b).Error; err != nil {
+		return nil, err
+	}
+	if err := recordAudit(ctx, tx, AuditCreated, b.ID, Diff(nil, b)); err != nil {
+		return nil, err
+	}
+	return recordEvent(ctx, tx, EventBookCreated, b, nil)
+}
+
+// Validate reports every problem with the book's fields at once.
+func (b *Book) Validate() error {
+	var errs []error
+	if strings.TrimSpace(b.Title) == "" {
+		errs = append(errs, errors.New("title is required"))
+	}
+	if strings.TrimSpace(b.Author) == "" {
+		errs = append(errs, errors.New("author is required"))
+	}
+	if y := b.PublicationYear; y != "" {
+		if _, err := strconv.Atoi(y); err != nil {
+			errs = append(errs, fmt.Errorf("publication year %q is not a number", y))
+		}
+	}
+	if b.Price != nil && *b.Price < 0 {
+		errs = append(errs, errors.New("price must not be negative"))
+	}
+	if _, err := isbn.Normalize(b.ISBN); b.ISBN != "" && err != nil {
+		errs = append(errs, fmt.Errorf("isbn %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// NormalizeISBN rewrites the book's ISBN into the canonical ISBN-13 form
+// it is stored in. A book without an ISBN is left as it is.
+func (b *Book) NormalizeISBN() error {
+	if b.ISBN == "" {
+		return nil
+	}
+	canonical, err := isbn.Normalize(b.ISBN)
+	if err != nil {
+		return fmt.Errorf("isbn %w", err)
+	}
+	b.ISBN = canonical
+	return nil
+}
+
+// GetBookByISBN returns the book with the given ISBN, which may be an
+// ISBN-10 or ISBN-13 with or without hyphens.
+func GetBookByISBN(ctx context.Context, s string) (*Book, error) {
+	canonical, err := isbn.Normalize(s)
+	if err != nil {
+		return nil, fmt.Errorf("isbn %w", err)
+	}
+	var book Book
+	err = read(ctx, func(db *gorm.DB) error {
+		return db.Where("isbn = ?", canonical).First(&book).Error
+	})
+	if err != nil {
+		return nil, dbError(err)
+	}
+	return &book, nil
+}
+
+// UpsertBookByISBN updates the book sharing b's ISBN, or creates b if there
+// is none, and reports whether it created a book. With dryRun set nothing
+// is written.
+func UpsertBookByISBN(ctx context.Context, b *Book, dryRun bool) (created bool, err error) {
+	if err := b.NormalizeISBN(); err != nil {
+		return false, err
+	}
+	for retried := false; ; retried = true {
+		existing, err := GetBookByISBN(UsePrimary(ctx), b.ISBN)
+		switch {
+		case errors.Is(err, ErrBookNotFound):
+			if dryRun {
+				return true, nil
+			}
+			err := b.CreateBook(ctx)
+			if errors.Is(err, ErrDuplicateISBN) && !retried {
+				// Created by someone else meanwhile: update it instead.
+				continue
+			}
+			return err == nil, err
+		case err != nil:
+			return false, err
+		}
+		b.ID = existing.ID
+		b.CreatedAt = existing.CreatedAt
+		if dryRun {
+			return false, nil
+		}
+		return false, b.UpdateBook(ctx)
+	}
+}
+
+func GetAllBooks(ctx context.Context, f BookFilter) ([]Book, error) {
 	var books []Book
-	Db.Find(&books)
-	return books
+	err := read(ctx, func(db *gorm.DB) error {
+		return f.apply(db).Find(&books).Error
+	})
+	if err != nil {
+		return nil, dbError(err)
+	}
+	return books, nil
+}
+
+// CatalogVersion returns the number of books matching f and the latest
+// UpdatedAt among them. Together they change whenever a book is added, edited or removed, so
+// they can validate a cached copy of the catalog without reading it.
+func CatalogVersion(ctx context.Context, f BookFilter) (count int, lastModified time.Time, err error) {
+	var row struct {
+		Count        int
+		LastModified *time.Time
+	}
+	err = read(ctx, func(db *gorm.DB) error {
+		return f.apply(db.Model(&Book{})).Select("count(*) AS count, max(updated_at) AS last_modified").Scan(&row).Error
+	})
+	if err != nil {
+		return 0, time.Time{}, dbError(err)
+	}
+	if row.LastModified != nil {
+		lastModified = *row.LastModified
+	}
+	return row.Count, lastModified, nil
+}
+
+func GetBookByID(ctx context.Context, id uint) (*Book, error) {
+	return books.get(ctx, id, getBookByID)
 }
 
-func GetBookByID(id uint) (*Book, error) {
+func getBookByID(ctx context.Context, id uint) (*Book, error) {
 	var book Book
-	if err := Db.First(&book, id).Error; err != nil {
-		return nil, err
+	err := read(ctx, func(db *gorm.DB) error {
+		return db.First(&book, id).Error
+	})
+	if err != nil {
+		return nil, dbError(err)
 	}
 	return &book, nil
 }
 
-func (b *Book) UpdateBook() error {
-	if err := Db.Save(b).Error; err != nil {
+func (b *Book) UpdateBook(ctx context.Context) error {
+	if err := b.NormalizeISBN(); err != nil {
+		return err
+	}
+	var ev *Event
+	err := inTx(ctx, func(tx *gorm.DB) (err error) {
+		ev, err = b.update(ctx, tx)
 		return err
+	})
+	if err != nil {
+		return bookError(ctx, err, b.ISBN)
 	}
+	wrote(ctx)
+	books.invalidate(ctx, b.ID)
+	notify(ev)
 	return nil
 }
 
-func DeleteBook(id uint) *Book {
+// update saves b within tx, recording the change in the audit trail and the
+// outbox. It returns the event to notify once tx commits, or nil when
+// nothing changed. The cover URL is the server's to set, so b keeps the
+// stored one: imports, bulk edits and PUTs never carry it, and would
+// otherwise orphan the uploaded cover. Only ModifyBook changes it.
+func (b *Book) update(ctx context.Context, tx *gorm.DB) (*Event, error) {
+	var before Book
+	if err := tx.Set("gorm:query_option", "FOR UPDATE").Where("id = ?", b.ID).First(&before).Error; err != nil {
+		return nil, err
+	}
+	if b.CreatedAt.IsZero() {
+		b.CreatedAt = before.CreatedAt
+	}
+	b.CoverURL = before.CoverURL
+	return b.save(ctx, tx, &before)
+}
+
+// ModifyBook applies change to book id as it is stored, with its row
+// locked, and saves the result as UpdateBook does if anything changed.
+// Unlike saving a copy read earlier, it keeps edits committed in the
+// meantime. If change returns an error nothing is saved and ModifyBook
+// returns it.
+func ModifyBook(ctx context.Context, id uint, change func(b *Book) error) (*Book, error) {
+	var book Book
+	var ev *Event
+	err := inTx(ctx, func(tx *gorm.DB) error {
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").Where("id = ?", id).First(&book).Error; err != nil {
+			return err
+		}
+		before := book.clone()
+		if err := change(&book); err != nil {
+			return err
+		}
+		if err := book.NormalizeISBN(); err != nil {
+			return err
+		}
+		if len(Diff(before, &book)) == 0 {
+			return nil
+		}
+		var err error
+		ev, err = book.save(ctx, tx, before)
+		return err
+	})
+	if err != nil {
+		return nil, bookError(ctx, err, book.ISBN)
+	}
+	wrote(ctx)
+	books.invalidate(ctx, id)
+	notify(ev)
+	return &book, nil
+}
+
+// save writes b over before, its row as locked within tx, and records the
+// change as update does.
+func (b *Book) save(ctx context.Context, tx *gorm.DB, before *Book) (*Event, error) {
+	if err := tx.Save(b).Error; err != nil {
+		return nil, err
+	}
+	changes := Diff(before, b)
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	if err := recordAudit(ctx, tx, AuditUpdated, b.ID, changes); err != nil {
+		return nil, err
+	}
+	return recordEvent(ctx, tx, EventBookUpdated, b, changes)
+}
+
+func DeleteBook(ctx context.Context, id uint) (*Book, error) {
+	var book *Book
+	var ev *Event
+	err := inTx(ctx, func(tx *gorm.DB) (err error) {
+		book, ev, err = remove(ctx, tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, dbError(err)
+	}
+	wrote(ctx)
+	books.invalidate(ctx, book.ID)
+	notify(ev)
+	return book, nil
+}
+
+// remove deletes book id within tx, recording it in the audit trail and the
+// outbox. It returns the book as it was and the event to notify once tx
+// commits.
+func remove(ctx context.Context, tx *gorm.DB, id uint) (*Book, *Event, error) {
 	var book Book
-	Db.Where("id = ?", id).First(&book)
-	Db.Delete(&book)
-	return &book
+	if err := tx.Set("gorm:query_option", "FOR UPDATE").Where("id = ?", id).First(&book).Error; err != nil {
+		return nil, nil, err
+	}
+	if err := tx.Delete(&book).Error; err != nil {
+		return nil, nil, err
+	}
+	if err := recordAudit(ctx, tx, AuditDeleted, book.ID, Diff(&book, nil)); err != nil {
+		return nil, nil, err
+	}
+	ev, err := recordEvent(ctx, tx, EventBookDeleted, &book, nil)
+	return &book, ev, err
+}
+
+// clone returns a copy of b that shares none of its pointers.
+func (b *Book) clone() *Book {
+	c := *b
+	c.Genre = clonePtr(b.Genre)
+	c.Price = clonePtr(b.Price)
+	c.CoverURL = clonePtr(b.CoverURL)
+	return &c
+}
+
+func clonePtr[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
+
+// bookError is dbError for a write of a book with the given ISBN,
+// reporting the book it clashes with.
+func bookError(ctx context.Context, err error, isbn string) error {
+	if !isISBNConflict(err) {
+		return dbError(err)
+	}
+	dup := &DuplicateISBNError{ISBN: isbn}
+	if other, err := GetBookByISBN(UsePrimary(ctx), isbn); err == nil {
+		dup.BookID = other.ID
+	}
+	return dup
+}
+
+// isISBNConflict reports whether err is a violation of the unique index on
+// ISBNs, or of the constraint init.sql used to declare.
+func isISBNConflict(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" &&
+		(pqErr.Constraint == "idx_books_isbn" || pqErr.Constraint == "books_isbn_key")
+}
+
+// dbError translates gorm and driver errors into the package's sentinel
+// errors so callers don't need to know about the database driver.
+func dbError(err error) error {
+	switch {
+	case gorm.IsRecordNotFoundError(err):
+		return ErrBookNotFound
+	case config.IsConnectionError(err):
+		return fmt.Errorf("%w: %v", ErrDatabaseUnavailable, err)
+	}
+	return err
 }
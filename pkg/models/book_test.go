@@ -0,0 +1,40 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestISBNConflict(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{&pq.Error{Code: "23505", Constraint: "idx_books_isbn"}, true},
+		{fmt.Errorf("saving: %w", &pq.Error{Code: "23505", Constraint: "books_isbn_key"}), true},
+		{&pq.Error{Code: "23505", Constraint: "idx_audit_entries_revision"}, false},
+		{&pq.Error{Code: "23502", Constraint: "idx_books_isbn"}, false},
+		{errors.New("23505"), false},
+		{nil, false},
+	} {
+		if got := isISBNConflict(tc.err); got != tc.want {
+			t.Errorf("%v: got %v want %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestDuplicateISBNError(t *testing.T) {
+	var err error = &DuplicateISBNError{ISBN: "9780441172719", BookID: 7}
+	if !errors.Is(err, ErrDuplicateISBN) {
+		t.Error("should match ErrDuplicateISBN")
+	}
+	if got := err.Error(); got != "isbn 9780441172719 is already used by book 7" {
+		t.Errorf("got %q", got)
+	}
+	if got := (&DuplicateISBNError{ISBN: "9780441172719"}).Error(); got != "isbn 9780441172719 is already used by another book" {
+		t.Errorf("unknown book: got %q", got)
+	}
+}
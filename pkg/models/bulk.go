@@ -0,0 +1,148 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Bulk operation kinds.
+const (
+	BulkCreate = "create"
+	BulkUpdate = "update"
+	BulkDelete = "delete"
+)
+
+// ErrBulkAborted marks the operations of an all-or-nothing batch that were
+// rolled back because another one failed.
+var ErrBulkAborted = errors.New("not applied, the batch was rolled back")
+
+// BulkOp is one change in a batch. Creates and updates carry the book;
+// updates replace every field of the book with ID, like a PUT.
+type BulkOp struct {
+	Op   string `json:"op"`
+	ID   uint   `json:"id,omitempty"`
+	Book *Book  `json:"book,omitempty"`
+}
+
+// Check reports what is wrong with the operation, before anything is
+// written.
+func (op *BulkOp) Check() error {
+	switch op.Op {
+	case BulkCreate, BulkUpdate:
+		if op.Op == BulkUpdate && op.ID == 0 {
+			return errors.New("id is required")
+		}
+		if op.Book == nil {
+			return errors.New("book is required")
+		}
+		return op.Book.Validate()
+	case BulkDelete:
+		if op.ID == 0 {
+			return errors.New("id is required")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown op %q, want create, update or delete", op.Op)
+}
+
+// BulkResult is the outcome of one operation: the book created, updated or
+// deleted, or why it wasn't.
+type BulkResult struct {
+	Book *Book
+	Err  error
+}
+
+// ApplyBulk applies checked operations in order. With atomic set they share
+// one transaction: the first failure rolls all of them back and the others
+// report ErrBulkAborted. Otherwise each is committed on its own and a
+// failure only affects its own result.
+func ApplyBulk(ctx context.Context, ops []BulkOp, atomic bool) []BulkResult {
+	results := make([]BulkResult, len(ops))
+	if !atomic {
+		for i, op := range ops {
+			var ev *Event
+			err := inTx(ctx, func(tx *gorm.DB) (err error) {
+				results[i].Book, ev, err = applyBulkOp(ctx, tx, op)
+				return err
+			})
+			if err != nil {
+				results[i] = BulkResult{Err: bookError(ctx, err, op.isbn())}
+				continue
+			}
+			wrote(ctx)
+			books.invalidate(ctx, results[i].Book.ID)
+			notify(ev)
+		}
+		return results
+	}
+
+	events := make([]*Event, len(ops))
+	failed := -1
+	err := inTx(ctx, func(tx *gorm.DB) error {
+		for i, op := range ops {
+			var err error
+			if results[i].Book, events[i], err = applyBulkOp(ctx, tx, op); err != nil {
+				failed = i
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		for i := range results {
+			results[i] = BulkResult{Err: ErrBulkAborted}
+		}
+		if failed >= 0 {
+			results[failed].Err = bookError(ctx, err, ops[failed].isbn())
+		} else {
+			// The commit itself failed.
+			for i := range results {
+				results[i].Err = dbError(err)
+			}
+		}
+		return results
+	}
+	wrote(ctx)
+	for i, res := range results {
+		books.invalidate(ctx, res.Book.ID)
+		notify(events[i])
+	}
+	return results
+}
+
+func (op *BulkOp) isbn() string {
+	if op.Book == nil {
+		return ""
+	}
+	return op.Book.ISBN
+}
+
+func applyBulkOp(ctx context.Context, tx *gorm.DB, op BulkOp) (*Book, *Event, error) {
+	switch op.Op {
+	case BulkCreate:
+		b := *op.Book
+		b.ID = 0
+		if err := b.NormalizeISBN(); err != nil {
+			return nil, nil, err
+		}
+		ev, err := b.insert(ctx, tx)
+		return &b, ev, err
+	case BulkUpdate:
+		b := *op.Book
+		b.ID = op.ID
+		// update keeps the stored creation time.
+		b.CreatedAt = time.Time{}
+		if err := b.NormalizeISBN(); err != nil {
+			return nil, nil, err
+		}
+		ev, err := b.update(ctx, tx)
+		return &b, ev, err
+	case BulkDelete:
+		return remove(ctx, tx, op.ID)
+	}
+	return nil, nil, fmt.Errorf("unknown op %q", op.Op)
+}
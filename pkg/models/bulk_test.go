@@ -0,0 +1,28 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBulkOpCheck(t *testing.T) {
+	book := &Book{Title: "Dune", Author: "Frank Herbert"}
+	for _, tc := range []struct {
+		op   BulkOp
+		want string
+	}{
+		{BulkOp{Op: BulkCreate, Book: book}, ""},
+		{BulkOp{Op: BulkUpdate, ID: 1, Book: book}, ""},
+		{BulkOp{Op: BulkDelete, ID: 1}, ""},
+		{BulkOp{Op: BulkCreate}, "book is required"},
+		{BulkOp{Op: BulkUpdate, Book: book}, "id is required"},
+		{BulkOp{Op: BulkDelete}, "id is required"},
+		{BulkOp{Op: BulkCreate, Book: &Book{Author: "Anon"}}, "title is required"},
+		{BulkOp{Op: "upsert"}, `unknown op "upsert"`},
+	} {
+		err := tc.op.Check()
+		if tc.want == "" && err != nil || tc.want != "" && (err == nil || !strings.Contains(err.Error(), tc.want)) {
+			t.Errorf("%+v: got %v want %q", tc.op, err, tc.want)
+		}
+	}
+}
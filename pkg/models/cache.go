@@ -0,0 +1,122 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"log/slog"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/adedaryorh/bookstore-app/pkg/cache"
+	"golang.org/x/sync/singleflight"
+)
+
+// cacheStats is published at /debug/vars as "book_cache".
+var cacheStats = expvar.NewMap("book_cache")
+
+// bookCache is a read-through cache in front of single book lookups.
+type bookCache struct {
+	cache cache.Cache
+	ttl   time.Duration
+	group singleflight.Group
+	// generation changes on every invalidation so a lookup that raced with
+	// a write does not put the old row back into the cache.
+	generation atomic.Uint64
+}
+
+var books *bookCache
+
+// UseCache caches GetBookByID results in c for ttl. Entries are dropped
+// whenever this instance writes the book; with a shared cache other
+// instances see the write immediately, with the in-process LRU they may
+// serve the old copy until it expires. A nil c disables caching.
+func UseCache(c cache.Cache, ttl time.Duration) {
+	if c == nil {
+		books = nil
+		return
+	}
+	books = &bookCache{cache: c, ttl: ttl}
+}
+
+func bookKey(id uint) string {
+	return "book:" + strconv.FormatUint(uint64(id), 10)
+}
+
+// get returns the book with id from the cache, calling load on a miss.
+// Concurrent misses for the same book share a single load. Lookups made
+// with UsePrimary bypass the cache, since they must see the latest row.
+func (c *bookCache) get(ctx context.Context, id uint, load func(context.Context, uint) (*Book, error)) (*Book, error) {
+	if c == nil || ctx.Value(primaryKey{}) != nil {
+		return load(ctx, id)
+	}
+	key := bookKey(id)
+
+	data, ok, err := c.cache.Get(ctx, key)
+	if err != nil {
+		cacheStats.Add("errors", 1)
+		slog.WarnContext(ctx, "book cache read failed", "key", key, "error", err)
+	} else if ok {
+		var book Book
+		if err := json.Unmarshal(data, &book); err == nil {
+			cacheStats.Add("hits", 1)
+			return &book, nil
+		}
+		cacheStats.Add("errors", 1)
+	}
+	cacheStats.Add("misses", 1)
+
+	generation := c.generation.Load()
+	ch := c.group.DoChan(key, func() (interface{}, error) {
+		// The load is shared, so one caller giving up must not fail the
+		// others. It reads the primary so a lagging replica can't refill
+		// the cache with a row that was just invalidated.
+		fillCtx := UsePrimary(context.WithoutCancel(ctx))
+		book, err := load(fillCtx, id)
+		if err != nil {
+			return nil, err
+		}
+		if c.generation.Load() == generation {
+			c.set(fillCtx, key, book)
+		}
+		return book, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		book := *res.Val.(*Book)
+		return &book, nil
+	}
+}
+
+func (c *bookCache) set(ctx context.Context, key string, book *Book) {
+	data, err := json.Marshal(book)
+	if err == nil {
+		err = c.cache.Set(ctx, key, data, c.ttl)
+	}
+	if err != nil {
+		cacheStats.Add("errors", 1)
+		slog.WarnContext(ctx, "book cache write failed", "key", key, "error", err)
+	}
+}
+
+// invalidate drops the cached copy of the book with id after a write.
+func (c *bookCache) invalidate(ctx context.Context, id uint) {
+	if c == nil {
+		return
+	}
+	c.generation.Add(1)
+	key := bookKey(id)
+	if err := c.cache.Delete(ctx, key); err != nil {
+		cacheStats.Add("errors", 1)
+		slog.WarnContext(ctx, "book cache invalidation failed", "key", key, "error", err)
+		return
+	}
+	cacheStats.Add("invalidations", 1)
+}
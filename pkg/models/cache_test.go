@@ -0,0 +1,118 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/adedaryorh/bookstore-app/pkg/cache"
+)
+
+func statValue(name string) int64 {
+	if v, ok := cacheStats.Get(name).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+func TestBookCacheReadThrough(t *testing.T) {
+	c := &bookCache{cache: cache.NewLRU(10), ttl: time.Minute}
+	var loads atomic.Int32
+	load := func(_ context.Context, id uint) (*Book, error) {
+		loads.Add(1)
+		return &Book{ID: id, Title: "Dune"}, nil
+	}
+	hits, misses := statValue("hits"), statValue("misses")
+
+	for i := 0; i < 3; i++ {
+		book, err := c.get(context.Background(), 7, load)
+		if err != nil || book.Title != "Dune" {
+			t.Fatalf("got %v, %v want Dune", book, err)
+		}
+	}
+	if loads.Load() != 1 {
+		t.Errorf("got %d loads want 1", loads.Load())
+	}
+	if got := statValue("hits") - hits; got != 2 {
+		t.Errorf("got %d hits want 2", got)
+	}
+	if got := statValue("misses") - misses; got != 1 {
+		t.Errorf("got %d misses want 1", got)
+	}
+
+	c.invalidate(context.Background(), 7)
+	c.get(context.Background(), 7, load)
+	if loads.Load() != 2 {
+		t.Errorf("invalidated entry was not reloaded: got %d loads want 2", loads.Load())
+	}
+
+	c.get(UsePrimary(context.Background()), 7, load)
+	if loads.Load() != 3 {
+		t.Errorf("UsePrimary should bypass the cache: got %d loads want 3", loads.Load())
+	}
+}
+
+func TestBookCacheSingleflight(t *testing.T) {
+	c := &bookCache{cache: cache.NewLRU(10), ttl: time.Minute}
+	var loads atomic.Int32
+	release := make(chan struct{})
+	load := func(_ context.Context, id uint) (*Book, error) {
+		loads.Add(1)
+		<-release
+		return &Book{ID: id}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.get(context.Background(), 1, load); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if loads.Load() != 1 {
+		t.Errorf("concurrent misses should share one load: got %d", loads.Load())
+	}
+}
+
+func TestBookCacheSkipsStaleFill(t *testing.T) {
+	c := &bookCache{cache: cache.NewLRU(10), ttl: time.Minute}
+	load := func(ctx context.Context, id uint) (*Book, error) {
+		// A write lands while the row is being read.
+		c.invalidate(ctx, id)
+		return &Book{ID: id, Title: "old"}, nil
+	}
+	if _, err := c.get(context.Background(), 3, load); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := c.cache.Get(context.Background(), bookKey(3)); ok {
+		t.Error("row read before an invalidation should not be cached")
+	}
+}
+
+func TestBookCacheDoesNotCacheErrors(t *testing.T) {
+	c := &bookCache{cache: cache.NewLRU(10), ttl: time.Minute}
+	var loads atomic.Int32
+	load := func(context.Context, uint) (*Book, error) {
+		loads.Add(1)
+		return nil, ErrBookNotFound
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := c.get(context.Background(), 9, load); !errors.Is(err, ErrBookNotFound) {
+			t.Errorf("got %v want ErrBookNotFound", err)
+		}
+	}
+	if loads.Load() != 2 {
+		t.Errorf("errors should not be cached: got %d loads want 2", loads.Load())
+	}
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/adedaryorh/bookstore-app/pkg/isbn"
+	"github.com/jinzhu/gorm"
+)
+
+// BookFilter narrows a catalog listing. Zero fields match every book.
+type BookFilter struct {
+	// Title matches books whose title contains it, ignoring case.
+	Title string
+	// Author and Genre match whole values, ignoring case.
+	Author string
+	Genre  string
+	// ISBN matches either form of the book's ISBN.
+	ISBN string
+	// PublicationYear matches exactly.
+	PublicationYear string
+	// UpdatedSince matches books changed at or after it.
+	UpdatedSince time.Time
+}
+
+func (f BookFilter) apply(db *gorm.DB) *gorm.DB {
+	if f.Title != "" {
+		db = db.Where("title ILIKE ?", "%"+escapeLike(f.Title)+"%")
+	}
+	if f.Author != "" {
+		db = db.Where("lower(author) = lower(?)", f.Author)
+	}
+	if f.Genre != "" {
+		db = db.Where("lower(genre) = lower(?)", f.Genre)
+	}
+	if f.ISBN != "" {
+		if canonical, err := isbn.Normalize(f.ISBN); err == nil {
+			f.ISBN = canonical
+		}
+		db = db.Where("isbn = ?", f.ISBN)
+	}
+	if f.PublicationYear != "" {
+		db = db.Where("publication_year = ?", f.PublicationYear)
+	}
+	if !f.UpdatedSince.IsZero() {
+		db = db.Where("updated_at >= ?", f.UpdatedSince)
+	}
+	return db
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// EachBook calls fn for every book matching f in ID order, reading rows
+// from a database cursor one at a time so memory use doesn't grow with the
+// catalog. It stops at the first error fn returns.
+func EachBook(ctx context.Context, f BookFilter, fn func(*Book) error) error {
+	var rows *sql.Rows
+	err := read(ctx, func(db *gorm.DB) error {
+		var err error
+		rows, err = f.apply(db.Model(&Book{})).Order("id").Rows()
+		return err
+	})
+	if err != nil {
+		return dbError(err)
+	}
+	defer rows.Close()
+
+	scanner := conn(ctx)
+	for rows.Next() {
+		var book Book
+		if err := scanner.ScanRows(rows, &book); err != nil {
+			return dbError(err)
+		}
+		if err := fn(&book); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return dbError(err)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/adedaryorh/bookstore-app/pkg/idempotency"
+	"github.com/jinzhu/gorm"
+)
+
+// IdempotencyKey is a stored idempotency.Record. Status is 0 while its
+// request is in progress, which it is taken to be until LockedUntil.
+type IdempotencyKey struct {
+	Key         string `gorm:"primary_key;size:64"`
+	Fingerprint string `gorm:"size:64"`
+	Status      int
+	ContentType string
+	Location    string
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time `gorm:"index"`
+	LockedUntil time.Time
+}
+
+// IdempotencyKeys is an idempotency.Store in the database, shared by every
+// instance of the service.
+type IdempotencyKeys struct {
+	// TTL is how long a key is remembered.
+	TTL time.Duration
+	// Lease is how long a claimed key stays locked without an answer, in
+	// case its request never finishes.
+	Lease time.Duration
+}
+
+var _ idempotency.Store = IdempotencyKeys{}
+
+// Begin implements idempotency.Store. An expired key, or one whose claim
+// has lapsed, is claimed afresh.
+func (s IdempotencyKeys) Begin(ctx context.Context, key, fingerprint string) (*idempotency.Record, error) {
+	for {
+		now := time.Now().UTC()
+		res := conn(ctx).Exec(`INSERT INTO idempotency_keys (key, fingerprint, status, content_type, location, created_at, expires_at, locked_until)
+			VALUES (?, ?, 0, '', '', ?, ?, ?)
+			ON CONFLICT (key) DO UPDATE SET fingerprint = EXCLUDED.fingerprint, status = 0, content_type = '', location = '', body = NULL,
+				created_at = EXCLUDED.created_at, expires_at = EXCLUDED.expires_at, locked_until = EXCLUDED.locked_until
+			WHERE idempotency_keys.expires_at < ? OR (idempotency_keys.status = 0 AND idempotency_keys.locked_until < ?)`,
+			key, fingerprint, now, now.Add(s.TTL), now.Add(s.Lease), now, now)
+		if res.Error != nil {
+			return nil, dbError(res.Error)
+		}
+		if res.RowsAffected == 1 {
+			return nil, nil
+		}
+		var row IdempotencyKey
+		err := conn(ctx).Where("key = ?", key).First(&row).Error
+		if gorm.IsRecordNotFoundError(err) {
+			// Purged since the insert; claim it again.
+			continue
+		}
+		if err != nil {
+			return nil, dbError(err)
+		}
+		return &idempotency.Record{
+			Fingerprint: row.Fingerprint,
+			Status:      row.Status,
+			ContentType: row.ContentType,
+			Location:    row.Location,
+			Body:        row.Body,
+		}, nil
+	}
+}
+
+// Finish implements idempotency.Store.
+func (s IdempotencyKeys) Finish(ctx context.Context, key string, rec idempotency.Record) error {
+	res := conn(ctx).Model(&IdempotencyKey{}).
+		Where("key = ? AND fingerprint = ? AND status = 0", key, rec.Fingerprint).
+		Updates(map[string]interface{}{
+			"status":       rec.Status,
+			"content_type": rec.ContentType,
+			"location":     rec.Location,
+			"body":         rec.Body,
+		})
+	if res.Error != nil {
+		return dbError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return idempotency.ErrNotClaimed
+	}
+	return nil
+}
+
+// Abandon implements idempotency.Store.
+func (s IdempotencyKeys) Abandon(ctx context.Context, key string) error {
+	if err := conn(ctx).Where("key = ? AND status = 0", key).Delete(&IdempotencyKey{}).Error; err != nil {
+		return dbError(err)
+	}
+	return nil
+}
+
+// PurgeIdempotencyKeys deletes expired keys.
+func PurgeIdempotencyKeys(ctx context.Context) (int64, error) {
+	res := conn(ctx).Where("expires_at < ?", time.Now().UTC()).Delete(&IdempotencyKey{})
+	if res.Error != nil {
+		return 0, dbError(res.Error)
+	}
+	return res.RowsAffected, nil
+}
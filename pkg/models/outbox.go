@@ -0,0 +1,272 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/adedaryorh/bookstore-app/pkg/logging"
+	"github.com/jinzhu/gorm"
+)
+
+// Types of the events recorded for book changes.
+const (
+	EventBookCreated = "book.created"
+	EventBookUpdated = "book.updated"
+	EventBookDeleted = "book.deleted"
+)
+
+// Event describes a committed change to a book. Delivery is at least once,
+// so consumers should skip events whose ID they have already handled.
+type Event struct {
+	// ID is unique per event and stays the same across redeliveries.
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	OccurredAt time.Time `json:"occurred_at"`
+	BookID     uint      `json:"book_id"`
+	// Book is the book after the change, or as it was when deleted.
+	Book *Book `json:"book"`
+	// Changes lists the fields an update changed.
+	Changes map[string]Change `json:"changes,omitempty"`
+	Actor   string            `json:"actor,omitempty"`
+	// ActorVerified is false when Actor is only who the caller claimed to
+	// be.
+	ActorVerified bool   `json:"actor_verified"`
+	RequestID     string `json:"request_id,omitempty"`
+}
+
+// Change is the old and new value of a field, as they appear in the book's
+// JSON.
+type Change struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// OutboxEvent is an event waiting in the transactional outbox. It is
+// written in the same transaction as the change it describes, so an event
+// exists exactly when the change was committed.
+type OutboxEvent struct {
+	ID          uint   `gorm:"primary_key"`
+	EventID     string `gorm:"size:36;unique_index"`
+	Type        string `gorm:"size:32"`
+	BookID      uint
+	Payload     string `gorm:"type:jsonb"`
+	CreatedAt   time.Time
+	PublishedAt *time.Time
+	Attempts    int
+	LastError   string
+	// LockedUntil is when the lease of the relay publishing the event runs
+	// out.
+	LockedUntil *time.Time
+	// DeadAt is set once the event has failed every attempt. Dead events
+	// are skipped and kept until they are retried by hand.
+	DeadAt *time.Time
+}
+
+// unchangedFields are left out of update diffs; they change with every
+// write or never.
+var unchangedFields = map[string]bool{"id": true, "created_at": true, "updated_at": true}
+
+// Diff returns the fields that differ between two versions of a book,
+// keyed by their JSON names. A nil before or after stands for the book not
+// existing, so every field that is set shows up as a change.
+func Diff(before, after *Book) map[string]Change {
+	old, new := jsonFields(before), jsonFields(after)
+	changes := map[string]Change{}
+	for _, fields := range []map[string]interface{}{old, new} {
+		for name := range fields {
+			if !unchangedFields[name] && !reflect.DeepEqual(old[name], new[name]) {
+				changes[name] = Change{Old: old[name], New: new[name]}
+			}
+		}
+	}
+	return changes
+}
+
+func jsonFields(b *Book) map[string]interface{} {
+	var fields map[string]interface{}
+	data, _ := json.Marshal(b)
+	json.Unmarshal(data, &fields)
+	return fields
+}
+
+// recordEvent adds an event for b to the outbox within tx and returns it.
+func recordEvent(ctx context.Context, tx *gorm.DB, eventType string, b *Book, changes map[string]Change) (*Event, error) {
+	book := *b
+	ev := &Event{
+		ID:            newEventID(),
+		Type:          eventType,
+		OccurredAt:    time.Now().UTC(),
+		BookID:        b.ID,
+		Book:          &book,
+		Changes:       changes,
+		Actor:         logging.Caller(ctx),
+		ActorVerified: !logging.CallerClaimed(ctx),
+		RequestID:     logging.RequestID(ctx),
+	}
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Create(&OutboxEvent{
+		EventID:   ev.ID,
+		Type:      ev.Type,
+		BookID:    ev.BookID,
+		Payload:   string(payload),
+		CreatedAt: ev.OccurredAt,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	return ev, nil
+}
+
+var (
+	listenersMu sync.RWMutex
+	listeners   []func(Event)
+)
+
+// OnEvent calls fn with every event this process records, once the change
+// it describes has been committed. fn runs in the goroutine that made the
+// change, so it must not block. Unlike the outbox, nothing is delivered
+// for changes made by other instances, or if the process stops.
+func OnEvent(fn func(Event)) {
+	listenersMu.Lock()
+	defer listenersMu.Unlock()
+	listeners = append(listeners, fn)
+}
+
+// notify passes a committed event, if there was one, to the listeners.
+func notify(ev *Event) {
+	if ev == nil {
+		return
+	}
+	listenersMu.RLock()
+	defer listenersMu.RUnlock()
+	for _, fn := range listeners {
+		fn(*ev)
+	}
+}
+
+// newEventID returns a random UUID.
+func newEventID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// inTx runs fn in a transaction, committing if it returns nil.
+func inTx(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	tx := conn(ctx).Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// PublishEvents hands up to limit pending events, oldest first, to publish
+// and marks those it accepts as published. The events are claimed with a
+// lease, so several relays can share the outbox without delivering the
+// same event concurrently, and are published outside any transaction. It
+// stops at the first event publish fails, recording the error on it, so
+// events are not delivered out of order; that event is retried on the next
+// call. After maxAttempts failures an event is marked dead instead and the
+// events behind it go ahead. A relay that dies mid-batch leaves its events
+// to be taken again when the lease runs out.
+func PublishEvents(ctx context.Context, limit int, lease time.Duration, maxAttempts int, publish func(Event) error) (published int, err error) {
+	now := time.Now()
+	var claimed []OutboxEvent
+	err = conn(ctx).Raw(`UPDATE outbox_events SET locked_until = ?
+		WHERE id IN (
+			SELECT id FROM outbox_events
+			WHERE published_at IS NULL AND dead_at IS NULL AND (locked_until IS NULL OR locked_until <= ?)
+			ORDER BY id LIMIT ?
+			FOR UPDATE SKIP LOCKED)
+		RETURNING *`, now.Add(lease), now, limit).Scan(&claimed).Error
+	if err != nil {
+		return 0, dbError(err)
+	}
+	sort.Slice(claimed, func(i, j int) bool { return claimed[i].ID < claimed[j].ID })
+
+	for i, row := range claimed {
+		// Leave the rest once half the lease is gone, so the event in
+		// flight can't outlast it.
+		if time.Since(now) > lease/2 {
+			releaseEvents(ctx, claimed[i:])
+			return published, nil
+		}
+		var ev Event
+		// A payload that can't be read never will be, so it is dead at
+		// once.
+		publishErr := json.Unmarshal([]byte(row.Payload), &ev)
+		undecodable := publishErr != nil
+		if !undecodable {
+			publishErr = publish(ev)
+		}
+
+		update := map[string]interface{}{
+			"attempts":     gorm.Expr("attempts + 1"),
+			"locked_until": nil,
+			"last_error":   "",
+		}
+		dead := false
+		if publishErr == nil {
+			update["published_at"] = time.Now()
+		} else {
+			update["last_error"] = publishErr.Error()
+			if dead = undecodable || row.Attempts+1 >= maxAttempts; dead {
+				update["dead_at"] = time.Now()
+			}
+		}
+		if err := conn(ctx).Model(&OutboxEvent{}).Where("id = ?", row.ID).UpdateColumns(update).Error; err != nil {
+			return published, dbError(err)
+		}
+
+		switch {
+		case publishErr == nil:
+			published++
+		case dead:
+			slog.WarnContext(ctx, "outbox event dead", "event_id", row.EventID, "type", row.Type, "book_id", row.BookID,
+				"attempts", row.Attempts+1, "error", publishErr)
+		default:
+			releaseEvents(ctx, claimed[i+1:])
+			return published, publishErr
+		}
+	}
+	return published, nil
+}
+
+// releaseEvents gives up the lease on events that were claimed but not
+// tried, so the next call takes them without waiting. Should this fail,
+// the lease runs out all the same.
+func releaseEvents(ctx context.Context, rows []OutboxEvent) {
+	if len(rows) == 0 {
+		return
+	}
+	ids := make([]uint, len(rows))
+	for i, row := range rows {
+		ids[i] = row.ID
+	}
+	conn(ctx).Model(&OutboxEvent{}).Where("id IN (?)", ids).UpdateColumn("locked_until", nil)
+}
+
+// PurgeEvents deletes events published before cutoff.
+func PurgeEvents(ctx context.Context, cutoff time.Time) (int64, error) {
+	res := conn(ctx).Where("published_at < ?", cutoff).Delete(&OutboxEvent{})
+	if res.Error != nil {
+		return 0, dbError(res.Error)
+	}
+	return res.RowsAffected, nil
+}
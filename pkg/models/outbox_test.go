@@ -0,0 +1,44 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	oldPrice, newPrice := 9.99, 10.5
+	before := &Book{ID: 1, Title: "Dune", Author: "Frank Herbert", Price: &oldPrice, CreatedAt: time.Now()}
+	after := *before
+	after.Title = "Dune Messiah"
+	after.Price = &newPrice
+	after.UpdatedAt = time.Now()
+
+	changes := Diff(before, &after)
+	if len(changes) != 2 {
+		t.Fatalf("got %d changes want 2: %v", len(changes), changes)
+	}
+	if c := changes["title"]; c.Old != "Dune" || c.New != "Dune Messiah" {
+		t.Errorf("wrong title change: %+v", c)
+	}
+	if c := changes["price"]; c.Old != 9.99 || c.New != 10.5 {
+		t.Errorf("wrong price change: %+v", c)
+	}
+	if len(Diff(before, before)) != 0 {
+		t.Error("identical books should have no changes")
+	}
+
+	deleted := Diff(before, nil)
+	if c, ok := deleted["author"]; !ok || c.Old != "Frank Herbert" || c.New != nil {
+		t.Errorf("wrong change for a deleted book: %+v", deleted)
+	}
+	if _, ok := deleted["genre"]; ok {
+		t.Error("fields unset before and after should not change")
+	}
+}
+
+func TestNewEventID(t *testing.T) {
+	a, b := newEventID(), newEventID()
+	if len(a) != 36 || a[14] != '4' || a == b {
+		t.Errorf("not distinct version 4 UUIDs: %s %s", a, b)
+	}
+}
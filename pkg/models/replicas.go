@@ -0,0 +1,177 @@
+package models
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/adedaryorh/bookstore-app/pkg/config"
+	"github.com/adedaryorh/bookstore-app/pkg/logging"
+	"github.com/adedaryorh/bookstore-app/pkg/tracing"
+	"github.com/jinzhu/gorm"
+)
+
+// ReplicaOptions tunes read routing across replicas.
+type ReplicaOptions struct {
+	// HealthInterval is how often every replica is pinged.
+	HealthInterval time.Duration
+	// ReadYourWritesWindow keeps a client's reads on the primary for this
+	// long after its last write, so it never reads its own stale data.
+	ReadYourWritesWindow time.Duration
+}
+
+type replica struct {
+	name    string
+	db      *gorm.DB
+	ping    func(context.Context) error
+	healthy atomic.Bool
+}
+
+// replicaSet routes read-only queries to healthy replicas.
+type replicaSet struct {
+	replicas []*replica
+	next     atomic.Uint64
+	window   time.Duration
+
+	mu         sync.Mutex
+	lastWrites map[string]time.Time
+}
+
+var replicas *replicaSet
+
+// UseReplicas routes catalog reads to the given replicas and health checks
+// them until ctx is done. Without replicas every query uses Db.
+func UseReplicas(ctx context.Context, dbs []config.Replica, opts ReplicaOptions) {
+	set := &replicaSet{window: opts.ReadYourWritesWindow, lastWrites: map[string]time.Time{}}
+	for _, r := range dbs {
+		tracing.RegisterCallbacks(r.DB)
+		sqlDB := r.DB.DB()
+		set.replicas = append(set.replicas, &replica{name: r.Name, db: r.DB, ping: sqlDB.PingContext})
+	}
+	if len(set.replicas) == 0 {
+		replicas = nil
+		return
+	}
+	set.checkHealth(ctx)
+	replicas = set
+	go set.watch(ctx, opts.HealthInterval)
+}
+
+type primaryKey struct{}
+
+// UsePrimary marks ctx so reads made with it go to the primary, for lookups
+// that precede a write and must not see replication lag.
+func UsePrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// reader returns the connection for a read-only query.
+func reader(ctx context.Context) *gorm.DB {
+	if r := replicas.pick(ctx); r != nil {
+		return tracing.WithContext(r.db, ctx).Set("replica", r)
+	}
+	return conn(ctx)
+}
+
+// read runs query against a replica, falling back to the primary if the
+// replica connection fails mid-query.
+func read(ctx context.Context, query func(*gorm.DB) error) error {
+	db := reader(ctx)
+	err := query(db)
+	if err == nil || !config.IsConnectionError(err) {
+		return err
+	}
+	if v, ok := db.Get("replica"); ok {
+		r := v.(*replica)
+		if r.healthy.Swap(false) {
+			slog.WarnContext(ctx, "database replica marked unhealthy", "replica", r.name, "error", err)
+		}
+		return query(conn(ctx))
+	}
+	return err
+}
+
+// wrote records that the client behind ctx just wrote to the primary.
+func wrote(ctx context.Context) {
+	replicas.markWrite(ctx)
+}
+
+func (s *replicaSet) pick(ctx context.Context) *replica {
+	if s == nil || ctx.Value(primaryKey{}) != nil || s.pinned(ctx) {
+		return nil
+	}
+	healthy := make([]*replica, 0, len(s.replicas))
+	for _, r := range s.replicas {
+		if r.healthy.Load() {
+			healthy = append(healthy, r)
+		}
+	}
+	if len(healthy) == 0 {
+		return nil
+	}
+	return healthy[s.next.Add(1)%uint64(len(healthy))]
+}
+
+func (s *replicaSet) pinned(ctx context.Context) bool {
+	caller := logging.Caller(ctx)
+	if caller == "" || s.window <= 0 {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	last, ok := s.lastWrites[caller]
+	return ok && time.Since(last) < s.window
+}
+
+func (s *replicaSet) markWrite(ctx context.Context) {
+	caller := logging.Caller(ctx)
+	if s == nil || caller == "" || s.window <= 0 {
+		return
+	}
+	s.mu.Lock()
+	s.lastWrites[caller] = time.Now()
+	s.mu.Unlock()
+}
+
+func (s *replicaSet) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.checkHealth(ctx)
+			s.forgetOldWrites()
+		}
+	}
+}
+
+func (s *replicaSet) checkHealth(ctx context.Context) {
+	for _, r := range s.replicas {
+		pingCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		err := r.ping(pingCtx)
+		cancel()
+
+		healthy := err == nil
+		if was := r.healthy.Swap(healthy); was != healthy {
+			if healthy {
+				slog.Info("database replica healthy", "replica", r.name)
+			} else {
+				slog.Warn("database replica unhealthy", "replica", r.name, "error", err)
+			}
+		}
+	}
+}
+
+func (s *replicaSet) forgetOldWrites() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for caller, last := range s.lastWrites {
+		if time.Since(last) >= s.window {
+			delete(s.lastWrites, caller)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/adedaryorh/bookstore-app/pkg/logging"
+	"github.com/jinzhu/gorm"
+)
+
+func newTestReplicaSet(window time.Duration, pings ...error) *replicaSet {
+	set := &replicaSet{window: window, lastWrites: map[string]time.Time{}}
+	for i := range pings {
+		err := pings[i]
+		set.replicas = append(set.replicas, &replica{
+			name: string(rune('a' + i)),
+			db:   &gorm.DB{},
+			ping: func(context.Context) error { return err },
+		})
+	}
+	set.checkHealth(context.Background())
+	return set
+}
+
+func TestReplicaPickSkipsUnhealthy(t *testing.T) {
+	set := newTestReplicaSet(0, nil, errors.New("down"), nil)
+
+	seen := map[string]int{}
+	for i := 0; i < 6; i++ {
+		r := set.pick(context.Background())
+		if r == nil {
+			t.Fatal("expected a healthy replica")
+		}
+		seen[r.name]++
+	}
+	if seen["b"] != 0 {
+		t.Errorf("unhealthy replica was picked %d times", seen["b"])
+	}
+	if seen["a"] != 3 || seen["c"] != 3 {
+		t.Errorf("reads not spread evenly across healthy replicas: %v", seen)
+	}
+}
+
+func TestReplicaPickFallsBackToPrimary(t *testing.T) {
+	set := newTestReplicaSet(0, errors.New("down"), errors.New("down"))
+	if r := set.pick(context.Background()); r != nil {
+		t.Errorf("expected primary when no replica is healthy, got %v", r.name)
+	}
+
+	var none *replicaSet
+	if r := none.pick(context.Background()); r != nil {
+		t.Error("expected primary when no replicas are configured")
+	}
+
+	healthy := newTestReplicaSet(0, nil)
+	if r := healthy.pick(UsePrimary(context.Background())); r != nil {
+		t.Error("UsePrimary should force the primary")
+	}
+}
+
+func TestReplicaReadYourWrites(t *testing.T) {
+	set := newTestReplicaSet(50*time.Millisecond, nil)
+	writer := logging.WithCaller(context.Background(), "nightly-sync")
+	other := logging.WithCaller(context.Background(), "storefront")
+
+	set.markWrite(writer)
+	if r := set.pick(writer); r != nil {
+		t.Error("writer should read from the primary right after writing")
+	}
+	if r := set.pick(other); r == nil {
+		t.Error("other clients should keep reading from replicas")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if r := set.pick(writer); r == nil {
+		t.Error("writer should return to replicas once the window has passed")
+	}
+	set.forgetOldWrites()
+	if len(set.lastWrites) != 0 {
+		t.Errorf("expired writes not forgotten: %v", set.lastWrites)
+	}
+}
+
+func TestReplicaHealthRecovers(t *testing.T) {
+	var pingErr error = errors.New("down")
+	set := &replicaSet{lastWrites: map[string]time.Time{}}
+	set.replicas = []*replica{{
+		name: "a",
+		db:   &gorm.DB{},
+		ping: func(context.Context) error { return pingErr },
+	}}
+
+	set.checkHealth(context.Background())
+	if set.pick(context.Background()) != nil {
+		t.Fatal("replica should start unhealthy")
+	}
+
+	pingErr = nil
+	set.checkHealth(context.Background())
+	if set.pick(context.Background()) == nil {
+		t.Error("replica should be used again once it answers pings")
+	}
+}
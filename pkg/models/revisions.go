@@ -0,0 +1,132 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ErrRevisionNotFound is returned when a book has no revision with the
+// requested number.
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// BookAsOf returns a book as it was at t, rebuilt from its audit trail.
+// ErrBookNotFound means the book didn't exist at t.
+func BookAsOf(ctx context.Context, id uint, t time.Time) (*Book, error) {
+	var current *Book
+	var entries []AuditEntry
+	err := read(ctx, func(db *gorm.DB) error {
+		// The row is read before the trail: undoing a change committed in
+		// between leaves the row as it was read, while missing one would
+		// leave it applied.
+		var book Book
+		switch err := db.Where("id = ?", id).First(&book).Error; {
+		case err == nil:
+			current = &book
+		case !gorm.IsRecordNotFoundError(err):
+			return err
+		}
+		return db.Where("book_id = ?", id).Order("revision").Find(&entries).Error
+	})
+	if err != nil {
+		return nil, dbError(err)
+	}
+	keep := 0
+	for keep < len(entries) && !entries[keep].OccurredAt.After(t) {
+		keep++
+	}
+	book := rewind(id, current, entries, keep)
+	if book == nil || book.CreatedAt.After(t) {
+		return nil, ErrBookNotFound
+	}
+	return book, nil
+}
+
+// RevertBook restores the fields a book had at the given revision, as a new
+// update. The cover is left alone: cover_url always points at the current
+// image, which isn't versioned. Reverting to the current revision changes
+// nothing.
+func RevertBook(ctx context.Context, id uint, revision int) (*Book, error) {
+	var book *Book
+	var ev *Event
+	err := inTx(ctx, func(tx *gorm.DB) (err error) {
+		var current Book
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").Where("id = ?", id).First(&current).Error; err != nil {
+			return err
+		}
+		var entries []AuditEntry
+		if err := tx.Where("book_id = ?", id).Order("revision").Find(&entries).Error; err != nil {
+			return err
+		}
+		keep := -1
+		for i, e := range entries {
+			if e.Revision == revision {
+				keep = i + 1
+			}
+		}
+		if keep < 0 {
+			return ErrRevisionNotFound
+		}
+		if book = rewind(id, &current, entries, keep); book == nil {
+			return ErrRevisionNotFound
+		}
+		book.CreatedAt = current.CreatedAt
+		ev, err = book.update(ctx, tx)
+		return err
+	})
+	if err != nil {
+		var isbn string
+		if book != nil {
+			isbn = book.ISBN
+		}
+		return nil, bookError(ctx, err, isbn)
+	}
+	wrote(ctx)
+	books.invalidate(ctx, id)
+	notify(ev)
+	return book, nil
+}
+
+// rewind rebuilds book id as it was after the first keep of its audit
+// entries, which are in revision order, by undoing the later ones on the
+// current row (nil once deleted). It returns nil if the book didn't exist
+// then. Books that predate the audit trail rewind to their state when it
+// started.
+func rewind(id uint, current *Book, entries []AuditEntry, keep int) *Book {
+	exists := current != nil
+	fields := map[string]interface{}{}
+	if exists {
+		fields = jsonFields(current)
+	}
+	for i := len(entries) - 1; i >= keep; i-- {
+		switch entries[i].Action {
+		case AuditCreated:
+			exists = false
+		case AuditDeleted:
+			exists = true
+		}
+		for name, c := range entries[i].Changes {
+			fields[name] = c.Old
+		}
+	}
+	if !exists {
+		return nil
+	}
+
+	var book Book
+	data, _ := json.Marshal(fields)
+	json.Unmarshal(data, &book)
+	book.ID = id
+	for _, e := range entries[:keep] {
+		if e.Action == AuditCreated && book.CreatedAt.IsZero() {
+			book.CreatedAt = e.OccurredAt
+		}
+	}
+	if keep > 0 {
+		book.UpdatedAt = entries[keep-1].OccurredAt
+	}
+	return &book
+}
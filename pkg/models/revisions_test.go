@@ -0,0 +1,44 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRewind(t *testing.T) {
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	price, cheaper := 30.0, 25.0
+	v1 := &Book{ID: 7, Title: "Dune", Author: "Frank Herbert", Price: &price}
+	v2 := *v1
+	v2.Title, v2.Price = "Dune Messiah", &cheaper
+	entries := []AuditEntry{
+		{Revision: 1, Action: AuditCreated, OccurredAt: start, Changes: Diff(nil, v1)},
+		{Revision: 2, Action: AuditUpdated, OccurredAt: start.Add(time.Hour), Changes: Diff(v1, &v2)},
+		{Revision: 3, Action: AuditDeleted, OccurredAt: start.Add(2 * time.Hour), Changes: Diff(&v2, nil)},
+	}
+
+	got := rewind(7, nil, entries, 1)
+	if got == nil || got.ID != 7 || got.Title != "Dune" || *got.Price != 30 || got.Author != "Frank Herbert" {
+		t.Fatalf("revision 1: got %+v", got)
+	}
+	if !got.CreatedAt.Equal(start) || !got.UpdatedAt.Equal(start) {
+		t.Errorf("revision 1: got created %v updated %v want %v", got.CreatedAt, got.UpdatedAt, start)
+	}
+	if got := rewind(7, nil, entries, 2); got == nil || got.Title != "Dune Messiah" || *got.Price != 25 {
+		t.Errorf("revision 2: got %+v", got)
+	}
+	if got := rewind(7, nil, entries, 3); got != nil {
+		t.Errorf("deleted book: got %+v want nil", got)
+	}
+	if got := rewind(7, nil, entries, 0); got != nil {
+		t.Errorf("before creation: got %+v want nil", got)
+	}
+
+	// A book from before the audit trail rewinds to its state when the
+	// trail started.
+	current := v2
+	current.CreatedAt = start.Add(-time.Hour)
+	if got := rewind(7, &current, entries[1:2], 0); got == nil || got.Title != "Dune" || !got.CreatedAt.Equal(current.CreatedAt) {
+		t.Errorf("pre-audit book: got %+v", got)
+	}
+}
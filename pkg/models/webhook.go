@@ -0,0 +1,437 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+var (
+	// ErrWebhookNotFound is returned when no subscription has the ID asked
+	// for.
+	ErrWebhookNotFound = errors.New("webhook not found")
+	// ErrDeliveryNotFound is returned when a subscription has no delivery
+	// with the ID asked for.
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+)
+
+// EventTypes are the event types webhooks can subscribe to.
+var EventTypes = []string{EventBookCreated, EventBookUpdated, EventBookDeleted}
+
+// States of a webhook delivery.
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	// DeliveryDead marks a delivery that failed every attempt. It stays
+	// in the log until it is redelivered by hand.
+	DeliveryDead = "dead"
+)
+
+// StringList is a list of strings stored as one comma-separated column.
+type StringList []string
+
+// Value implements driver.Valuer.
+func (l StringList) Value() (driver.Value, error) {
+	return strings.Join(l, ","), nil
+}
+
+// Scan implements sql.Scanner.
+func (l *StringList) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case nil:
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into StringList", src)
+	}
+	*l = nil
+	if s != "" {
+		*l = strings.Split(s, ",")
+	}
+	return nil
+}
+
+// MarshalJSON encodes an empty list as [] rather than null.
+func (l StringList) MarshalJSON() ([]byte, error) {
+	if l == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal([]string(l))
+}
+
+// Webhook is a partner's subscription to book events.
+type Webhook struct {
+	ID  uint   `json:"id" gorm:"primary_key"`
+	URL string `json:"url"`
+	// Events lists the event types delivered; empty means all of them.
+	Events StringList `json:"events" gorm:"type:text"`
+	// Fields narrows book.updated events to updates changing one of these
+	// fields, such as price; empty means any update.
+	Fields StringList `json:"fields" gorm:"type:text"`
+	// Secret signs every delivery. It is only shown when the subscription
+	// is created.
+	Secret    string    `json:"-"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// WebhookDelivery is an event queued for, or sent to, one subscription.
+type WebhookDelivery struct {
+	ID        uint   `json:"id" gorm:"primary_key"`
+	WebhookID uint   `json:"webhook_id" gorm:"unique_index:idx_webhook_deliveries_event"`
+	EventID   string `json:"event_id" gorm:"size:36;unique_index:idx_webhook_deliveries_event"`
+	EventType string `json:"event_type" gorm:"size:32"`
+	Payload   string `json:"-" gorm:"type:jsonb"`
+	Status    string `json:"status" gorm:"size:16;index"`
+	Attempts  int    `json:"attempts"`
+	// NextAttemptAt is when a pending delivery is due.
+	NextAttemptAt  time.Time  `json:"next_attempt_at"`
+	LastStatusCode int        `json:"last_status_code,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+
+	// Webhook is the subscription, filled in for claimed deliveries.
+	Webhook *Webhook `json:"-" gorm:"-"`
+	// Log lists the attempts made, when the delivery is fetched on its own.
+	Log []WebhookAttempt `json:"log,omitempty" gorm:"-"`
+}
+
+// WebhookAttempt records one try at sending a delivery.
+type WebhookAttempt struct {
+	ID          uint      `json:"-" gorm:"primary_key"`
+	DeliveryID  uint      `json:"-" gorm:"index"`
+	AttemptedAt time.Time `json:"attempted_at"`
+	Duration    int64     `json:"duration_ms"`
+	StatusCode  int       `json:"status_code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	// Response is the start of the receiver's response body.
+	Response string `json:"response,omitempty"`
+}
+
+// DeliveryFilter narrows a subscription's delivery log.
+type DeliveryFilter struct {
+	Status    string
+	EventType string
+	Limit     int
+	Offset    int
+}
+
+// Validate reports every problem with the subscription at once.
+func (w *Webhook) Validate() error {
+	var errs []error
+	if u, err := url.Parse(w.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, errors.New("url must be an absolute http or https URL"))
+	}
+	for _, e := range w.Events {
+		if !contains(EventTypes, e) {
+			errs = append(errs, fmt.Errorf("unknown event %q, want one of %v", e, EventTypes))
+		}
+	}
+	known := jsonFields(&Book{})
+	for _, f := range w.Fields {
+		if _, ok := known[f]; !ok || unchangedFields[f] {
+			errs = append(errs, fmt.Errorf("unknown field %q", f))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Matches reports whether ev should be delivered to the subscription.
+func (w *Webhook) Matches(ev Event) bool {
+	if len(w.Events) > 0 && !contains(w.Events, ev.Type) {
+		return false
+	}
+	if ev.Type != EventBookUpdated || len(w.Fields) == 0 {
+		return true
+	}
+	for _, f := range w.Fields {
+		if _, ok := ev.Changes[f]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// NewWebhookSecret returns a random signing secret.
+func NewWebhookSecret() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return "whsec_" + hex.EncodeToString(b)
+}
+
+// CreateWebhook saves a new subscription, generating its secret if none
+// was given.
+func CreateWebhook(ctx context.Context, w *Webhook) error {
+	if w.Secret == "" {
+		w.Secret = NewWebhookSecret()
+	}
+	return webhookError(conn(ctx).Create(w).Error)
+}
+
+// GetWebhooks lists every subscription, oldest first.
+func GetWebhooks(ctx context.Context) ([]Webhook, error) {
+	var hooks []Webhook
+	if err := conn(ctx).Order("id").Find(&hooks).Error; err != nil {
+		return nil, webhookError(err)
+	}
+	return hooks, nil
+}
+
+// GetWebhook fetches a subscription by ID.
+func GetWebhook(ctx context.Context, id uint) (*Webhook, error) {
+	var w Webhook
+	if err := conn(ctx).Where("id = ?", id).First(&w).Error; err != nil {
+		return nil, webhookError(err)
+	}
+	return &w, nil
+}
+
+// UpdateWebhook saves changes to a subscription.
+func UpdateWebhook(ctx context.Context, w *Webhook) error {
+	return webhookError(conn(ctx).Save(w).Error)
+}
+
+// DeleteWebhook removes a subscription with its delivery log.
+func DeleteWebhook(ctx context.Context, id uint) error {
+	return webhookError(inTx(ctx, func(tx *gorm.DB) error {
+		res := tx.Where("id = ?", id).Delete(&Webhook{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrWebhookNotFound
+		}
+		err := tx.Where("delivery_id IN (SELECT id FROM webhook_deliveries WHERE webhook_id = ?)", id).
+			Delete(&WebhookAttempt{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("webhook_id = ?", id).Delete(&WebhookDelivery{}).Error
+	}))
+}
+
+// EnqueueDeliveries queues ev for every active subscription it matches and
+// returns how many were queued. Queueing the same event twice adds nothing,
+// so events relayed more than once are still delivered once per
+// subscription.
+func EnqueueDeliveries(ctx context.Context, ev Event) (int, error) {
+	var hooks []Webhook
+	if err := conn(ctx).Where("active").Find(&hooks).Error; err != nil {
+		return 0, dbError(err)
+	}
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return 0, err
+	}
+	queued := 0
+	err = inTx(ctx, func(tx *gorm.DB) error {
+		for _, w := range hooks {
+			if !w.Matches(ev) {
+				continue
+			}
+			d := WebhookDelivery{
+				WebhookID:     w.ID,
+				EventID:       ev.ID,
+				EventType:     ev.Type,
+				Payload:       string(payload),
+				Status:        DeliveryPending,
+				NextAttemptAt: time.Now(),
+			}
+			res := tx.Set("gorm:insert_option", "ON CONFLICT (webhook_id, event_id) DO NOTHING").Create(&d)
+			if res.Error != nil {
+				return res.Error
+			}
+			queued += int(res.RowsAffected)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, dbError(err)
+	}
+	return queued, nil
+}
+
+// ClaimDeliveries takes up to limit due deliveries of active subscriptions,
+// oldest first, and pushes their next attempt lease into the future so no
+// other dispatcher takes them meanwhile. A dispatcher that dies mid-send
+// leaves the delivery to be retried when the lease runs out.
+func ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]WebhookDelivery, error) {
+	now := time.Now()
+	var claimed []WebhookDelivery
+	err := conn(ctx).Raw(`UPDATE webhook_deliveries SET next_attempt_at = ?
+		WHERE id IN (
+			SELECT d.id FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+			WHERE d.status = ? AND d.next_attempt_at <= ? AND w.active
+			ORDER BY d.next_attempt_at, d.id LIMIT ?
+			FOR UPDATE OF d SKIP LOCKED)
+		RETURNING *`, now.Add(lease), DeliveryPending, now, limit).Scan(&claimed).Error
+	if err != nil {
+		return nil, dbError(err)
+	}
+	if len(claimed) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]uint, 0, len(claimed))
+	for _, d := range claimed {
+		ids = append(ids, d.WebhookID)
+	}
+	var hooks []Webhook
+	if err := conn(ctx).Where("id IN (?)", ids).Find(&hooks).Error; err != nil {
+		return nil, dbError(err)
+	}
+	byID := make(map[uint]*Webhook, len(hooks))
+	for i := range hooks {
+		byID[hooks[i].ID] = &hooks[i]
+	}
+	ready := claimed[:0]
+	for _, d := range claimed {
+		// A subscription deleted since the claim takes its deliveries
+		// with it.
+		if d.Webhook = byID[d.WebhookID]; d.Webhook != nil {
+			ready = append(ready, d)
+		}
+	}
+	return ready, nil
+}
+
+// RecordAttempt logs an attempt at d and moves it to status, due again at
+// next if it is still pending.
+func RecordAttempt(ctx context.Context, d *WebhookDelivery, a WebhookAttempt, status string, next time.Time) error {
+	a.DeliveryID = d.ID
+	d.Attempts++
+	d.Status = status
+	d.NextAttemptAt = next
+	d.LastStatusCode = a.StatusCode
+	d.LastError = a.Error
+	update := map[string]interface{}{
+		"attempts":         gorm.Expr("attempts + 1"),
+		"status":           d.Status,
+		"next_attempt_at":  d.NextAttemptAt,
+		"last_status_code": d.LastStatusCode,
+		"last_error":       d.LastError,
+		"updated_at":       time.Now(),
+	}
+	if status == DeliverySucceeded {
+		d.DeliveredAt = &a.AttemptedAt
+		update["delivered_at"] = a.AttemptedAt
+	}
+	return dbError(inTx(ctx, func(tx *gorm.DB) error {
+		if err := tx.Create(&a).Error; err != nil {
+			return err
+		}
+		return tx.Model(&WebhookDelivery{}).Where("id = ?", d.ID).UpdateColumns(update).Error
+	}))
+}
+
+// GetDeliveries lists a subscription's deliveries, newest first.
+func GetDeliveries(ctx context.Context, webhookID uint, f DeliveryFilter) ([]WebhookDelivery, error) {
+	q := conn(ctx).Where("webhook_id = ?", webhookID)
+	if f.Status != "" {
+		q = q.Where("status = ?", f.Status)
+	}
+	if f.EventType != "" {
+		q = q.Where("event_type = ?", f.EventType)
+	}
+	if f.Limit > 0 {
+		q = q.Limit(f.Limit)
+	}
+	if f.Offset > 0 {
+		q = q.Offset(f.Offset)
+	}
+	var deliveries []WebhookDelivery
+	if err := q.Order("id DESC").Find(&deliveries).Error; err != nil {
+		return nil, dbError(err)
+	}
+	return deliveries, nil
+}
+
+// GetDelivery fetches one of a subscription's deliveries with its attempts.
+func GetDelivery(ctx context.Context, webhookID, id uint) (*WebhookDelivery, error) {
+	var d WebhookDelivery
+	err := conn(ctx).Where("webhook_id = ? AND id = ?", webhookID, id).First(&d).Error
+	if err != nil {
+		return nil, deliveryError(err)
+	}
+	if err := conn(ctx).Where("delivery_id = ?", d.ID).Order("id").Find(&d.Log).Error; err != nil {
+		return nil, dbError(err)
+	}
+	return &d, nil
+}
+
+// Redeliver queues a delivery to be sent again straight away, with a fresh
+// set of retries, whatever its state.
+func Redeliver(ctx context.Context, webhookID, id uint) (*WebhookDelivery, error) {
+	res := conn(ctx).Model(&WebhookDelivery{}).Where("webhook_id = ? AND id = ?", webhookID, id).
+		UpdateColumns(map[string]interface{}{
+			"status":          DeliveryPending,
+			"attempts":        0,
+			"next_attempt_at": time.Now(),
+			"updated_at":      time.Now(),
+		})
+	if res.Error != nil {
+		return nil, dbError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrDeliveryNotFound
+	}
+	return GetDelivery(ctx, webhookID, id)
+}
+
+// PurgeDeliveries deletes deliveries finished before cutoff, with their
+// attempts. Dead deliveries are kept until they are redelivered.
+func PurgeDeliveries(ctx context.Context, cutoff time.Time) (int64, error) {
+	var purged int64
+	err := inTx(ctx, func(tx *gorm.DB) error {
+		old := "SELECT id FROM webhook_deliveries WHERE status = ? AND updated_at < ?"
+		err := tx.Where("delivery_id IN ("+old+")", DeliverySucceeded, cutoff).Delete(&WebhookAttempt{}).Error
+		if err != nil {
+			return err
+		}
+		res := tx.Where("status = ? AND updated_at < ?", DeliverySucceeded, cutoff).Delete(&WebhookDelivery{})
+		purged = res.RowsAffected
+		return res.Error
+	})
+	if err != nil {
+		return 0, dbError(err)
+	}
+	return purged, nil
+}
+
+func webhookError(err error) error {
+	if gorm.IsRecordNotFoundError(err) {
+		return ErrWebhookNotFound
+	}
+	return dbError(err)
+}
+
+func deliveryError(err error) error {
+	if gorm.IsRecordNotFoundError(err) {
+		return ErrDeliveryNotFound
+	}
+	return dbError(err)
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestWebhookMatches(t *testing.T) {
+	price := Event{Type: EventBookUpdated, Changes: map[string]Change{"price": {Old: 10.0, New: 12.0}}}
+	title := Event{Type: EventBookUpdated, Changes: map[string]Change{"title": {Old: "a", New: "b"}}}
+	created := Event{Type: EventBookCreated}
+
+	tests := []struct {
+		name string
+		hook Webhook
+		ev   Event
+		want bool
+	}{
+		{"everything", Webhook{}, title, true},
+		{"other type", Webhook{Events: StringList{EventBookDeleted}}, created, false},
+		{"field changed", Webhook{Fields: StringList{"price"}}, price, true},
+		{"field unchanged", Webhook{Fields: StringList{"price"}}, title, false},
+		{"fields ignore creates", Webhook{Fields: StringList{"price"}}, created, true},
+	}
+	for _, tt := range tests {
+		if got := tt.hook.Matches(tt.ev); got != tt.want {
+			t.Errorf("%s: got %v want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookValidate(t *testing.T) {
+	ok := Webhook{URL: "https://partner.example/hooks", Events: StringList{EventBookUpdated}, Fields: StringList{"price"}}
+	if err := ok.Validate(); err != nil {
+		t.Errorf("valid webhook rejected: %v", err)
+	}
+	bad := Webhook{URL: "ftp://partner.example", Events: StringList{"book.sold"}, Fields: StringList{"updated_at"}}
+	if err := bad.Validate(); err == nil {
+		t.Error("invalid webhook accepted")
+	}
+}
+
+func TestStringListScan(t *testing.T) {
+	var l StringList
+	if err := l.Scan([]byte("book.created,book.deleted")); err != nil || len(l) != 2 || l[1] != "book.deleted" {
+		t.Errorf("got %v, %v", l, err)
+	}
+	if err := l.Scan(""); err != nil || l != nil {
+		t.Errorf("empty column: got %v, %v", l, err)
+	}
+	if v, _ := (StringList{"a", "b"}).Value(); v != "a,b" {
+		t.Errorf("got %v want a,b", v)
+	}
+	if data, _ := json.Marshal(StringList(nil)); string(data) != "[]" {
+		t.Errorf("empty list: got %s want []", data)
+	}
+}
@@ -0,0 +1,50 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/adedaryorh/bookstore-app/pkg/models"
+)
+
+// HTTPPublisher POSTs each event as JSON to URL. The event ID and type are
+// also sent as the X-Event-ID and X-Event-Type headers, so receivers can
+// deduplicate without parsing the body. Any 2xx response accepts the event.
+type HTTPPublisher struct {
+	URL    string
+	Client *http.Client
+}
+
+// Publish sends ev.
+func (p *HTTPPublisher) Publish(ctx context.Context, ev models.Event) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-ID", ev.ID)
+	req.Header.Set("X-Event-Type", ev.Type)
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("publishing event %s: %s", ev.ID, resp.Status)
+	}
+	return nil
+}
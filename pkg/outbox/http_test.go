@@ -0,0 +1,45 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/adedaryorh/bookstore-app/pkg/models"
+)
+
+func TestHTTPPublisher(t *testing.T) {
+	var got models.Event
+	var header http.Header
+	status := http.StatusAccepted
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	p := &HTTPPublisher{URL: srv.URL, Client: srv.Client()}
+	ev := models.Event{
+		ID:      "6f1c2a4e-0000-4000-8000-000000000001",
+		Type:    models.EventBookUpdated,
+		BookID:  7,
+		Changes: map[string]models.Change{"title": {Old: "Old", New: "New"}},
+	}
+	if err := p.Publish(context.Background(), ev); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	if header.Get("X-Event-ID") != ev.ID || header.Get("X-Event-Type") != ev.Type {
+		t.Errorf("wrong headers: %v", header)
+	}
+	if got.ID != ev.ID || got.BookID != 7 || got.Changes["title"].New != "New" {
+		t.Errorf("wrong body: %+v", got)
+	}
+
+	status = http.StatusServiceUnavailable
+	if err := p.Publish(context.Background(), ev); err == nil {
+		t.Error("expected an error for a 503 response")
+	}
+}
@@ -0,0 +1,117 @@
+// Package outbox relays the book events recorded in the database's outbox
+// to a publisher. Events are delivered at least once: an event is only
+// marked published after the publisher accepts it, so a crash in between
+// sends it again. Consumers deduplicate by the event ID.
+package outbox
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/adedaryorh/bookstore-app/pkg/models"
+)
+
+// Publisher delivers events somewhere outside the service.
+type Publisher interface {
+	Publish(ctx context.Context, ev models.Event) error
+}
+
+// PublisherFunc adapts a function to a Publisher.
+type PublisherFunc func(ctx context.Context, ev models.Event) error
+
+// Publish calls f.
+func (f PublisherFunc) Publish(ctx context.Context, ev models.Event) error {
+	return f(ctx, ev)
+}
+
+// maxBackoff caps the wait between polls while publishing keeps failing.
+const maxBackoff = 5 * time.Minute
+
+// Relay moves events from the outbox to a Publisher.
+type Relay struct {
+	Publisher Publisher
+	// Interval is how often the outbox is polled when it is idle.
+	Interval time.Duration
+	// BatchSize is the most events handled per poll.
+	BatchSize int
+	// Lease is how long a batch is held for this relay. It should be
+	// longer than publishing one event can take.
+	Lease time.Duration
+	// MaxAttempts is how many times an event is tried before it is
+	// marked dead.
+	MaxAttempts int
+	// Retention is how long published events are kept before being
+	// purged; zero keeps them forever.
+	Retention time.Duration
+}
+
+// Run relays events until ctx is done. A full batch is followed straight
+// away by the next one; after a failure the wait doubles, up to maxBackoff,
+// until publishing succeeds again.
+func (r *Relay) Run(ctx context.Context) {
+	var wait time.Duration
+	var lastPurge time.Time
+	for {
+		n, err := r.Flush(ctx)
+		switch {
+		case err != nil:
+			wait = min(max(wait*2, r.Interval), maxBackoff)
+			slog.WarnContext(ctx, "publishing events failed", "published", n, "retry_in", wait, "error", err)
+		case n == r.BatchSize:
+			wait = 0
+		default:
+			wait = r.Interval
+		}
+
+		if r.Retention > 0 && time.Since(lastPurge) > time.Hour {
+			lastPurge = time.Now()
+			if purged, err := models.PurgeEvents(ctx, lastPurge.Add(-r.Retention)); err != nil {
+				slog.WarnContext(ctx, "purging published events failed", "error", err)
+			} else if purged > 0 {
+				slog.InfoContext(ctx, "purged published events", "count", purged)
+			}
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// Flush publishes one batch of pending events and returns how many were
+// published.
+func (r *Relay) Flush(ctx context.Context) (int, error) {
+	return models.PublishEvents(ctx, r.BatchSize, r.Lease, r.MaxAttempts, func(ev models.Event) error {
+		return r.Publisher.Publish(ctx, ev)
+	})
+}
+
+// LogPublisher writes events to the log, which is enough to see them flow
+// during development.
+type LogPublisher struct{}
+
+// Publish logs ev.
+func (LogPublisher) Publish(ctx context.Context, ev models.Event) error {
+	slog.InfoContext(ctx, "book event", "event_id", ev.ID, "type", ev.Type, "book_id", ev.BookID, "changes", len(ev.Changes))
+	return nil
+}
+
+// Multi publishes every event to each of its publishers in turn. An event
+// one of them rejects is retried for all of them, so each should tolerate
+// repeats.
+type Multi []Publisher
+
+// Publish hands ev to each publisher, stopping at the first error.
+func (m Multi) Publish(ctx context.Context, ev models.Event) error {
+	for _, p := range m {
+		if err := p.Publish(ctx, ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,609 @@
+package routes
+
+import (
+	_ "embed"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adedaryorh/bookstore-app/pkg/importer"
+	"github.com/adedaryorh/bookstore-app/pkg/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// registration is a route as it was registered.
+type registration struct {
+	Method, Path string
+	// Idempotent routes accept an Idempotency-Key.
+	Idempotent bool
+}
+
+// operation documents a route for the OpenAPI document. Path parameters,
+// tags and error responses are filled in from the registration.
+type operation struct {
+	// ID is the operationId, unique across the document.
+	ID          string
+	Summary     string
+	Description string
+	Query       []param
+	// Body is the request body, by content type.
+	Body map[string]schema
+	// Responses maps statuses to their descriptions and bodies.
+	Responses map[int]response
+}
+
+type param struct {
+	Name, Description string
+	Schema            schema
+	// Repeated parameters may be given more than once.
+	Repeated bool
+}
+
+type response struct {
+	Description string
+	// Content maps content types to their schemas.
+	Content map[string]schema
+}
+
+type schema = map[string]interface{}
+
+func ref(name string) schema {
+	return schema{"$ref": "#/components/schemas/" + name}
+}
+
+func arrayOf(items schema) schema {
+	return schema{"type": "array", "items": items}
+}
+
+func jsonBody(s schema) map[string]schema {
+	return map[string]schema{"application/json": s}
+}
+
+func ok(description string, s schema) response {
+	return response{Description: description, Content: jsonBody(s)}
+}
+
+var (
+	integer   = schema{"type": "integer"}
+	str       = schema{"type": "string"}
+	boolean   = schema{"type": "boolean"}
+	timestamp = schema{"type": "string", "format": "date-time"}
+	binary    = schema{"type": "string", "contentMediaType": "application/octet-stream"}
+)
+
+func enum(values ...string) schema {
+	return schema{"type": "string", "enum": values}
+}
+
+// pathParams describes every path parameter used in a route.
+var pathParams = map[string]param{
+	"bookId":     {Description: "Book ID", Schema: integer},
+	"isbn":       {Description: "ISBN-10 or ISBN-13, hyphens allowed", Schema: str},
+	"revision":   {Description: "Revision number from the book's history", Schema: integer},
+	"importId":   {Description: "Import ID from the import report", Schema: str},
+	"webhookId":  {Description: "Webhook subscription ID", Schema: integer},
+	"deliveryId": {Description: "Delivery ID", Schema: integer},
+}
+
+var (
+	pageParams = []param{
+		{Name: "limit", Description: "Page size, 1 to 500", Schema: schema{"type": "integer", "minimum": 1, "maximum": 500, "default": 50}},
+		{Name: "offset", Description: "Entries to skip", Schema: schema{"type": "integer", "minimum": 0, "default": 0}},
+	}
+	filterParams = []param{
+		{Name: "title", Description: "Title contains, ignoring case", Schema: str},
+		{Name: "author", Description: "Author, ignoring case", Schema: str},
+		{Name: "genre", Description: "Genre, ignoring case", Schema: str},
+		{Name: "isbn", Description: "ISBN-10 or ISBN-13", Schema: str},
+		{Name: "publication_year", Description: "Publication year", Schema: str},
+		{Name: "updated_since", Description: "Changed at or after this time (RFC 3339)", Schema: timestamp},
+	}
+)
+
+// adminOnly describes the routes guarded by the admin token.
+const adminOnly = "Requires the admin bearer token when one is configured."
+
+// docs documents every registered route, keyed by method and path. The
+// OpenAPI test fails when a route is registered without an entry here, or
+// an entry outlives its route.
+var docs = map[string]operation{
+	"GET /health": {
+		ID:        "health",
+		Summary:   "Health check",
+		Responses: map[int]response{200: {Description: "The server is up", Content: map[string]schema{"text/plain": str}}},
+	},
+	"GET /ready": {
+		ID:        "ready",
+		Summary:   "Readiness check",
+		Responses: map[int]response{200: {Description: "The database is reachable"}, 503: {Description: "The database is unreachable"}},
+	},
+	"GET /debug/vars": {
+		ID:          "debugVars",
+		Summary:     "Cache counters (expvar)",
+		Description: "Requires the admin bearer token when one is configured. The command line and memory statistics aren't published.",
+		Responses:   map[int]response{200: ok("Counters by name", schema{"type": "object"}), 401: ok("Admin token required", ref("Error"))},
+	},
+	"GET /openapi.json": {
+		ID:        "openAPI",
+		Summary:   "This document",
+		Responses: map[int]response{200: ok("OpenAPI 3.1 document", schema{"type": "object"})},
+	},
+	"GET /docs": {
+		ID:        "docs",
+		Summary:   "API documentation page",
+		Responses: map[int]response{200: {Description: "HTML page rendering this document", Content: map[string]schema{"text/html": str}}},
+	},
+
+	"GET /books": {
+		ID:          "listBooks",
+		Summary:     "List books",
+		Description: "Supports If-Modified-Since and If-None-Match.",
+		Query:       filterParams,
+		Responses:   map[int]response{200: ok("Matching books", arrayOf(ref("Book"))), 304: {Description: "Not modified"}},
+	},
+	"GET /book": {
+		ID:        "listBooksAlt",
+		Summary:   "List books (alternative)",
+		Query:     filterParams,
+		Responses: map[int]response{200: ok("Matching books", arrayOf(ref("Book"))), 304: {Description: "Not modified"}},
+	},
+	"POST /book": {
+		ID:          "createBook",
+		Summary:     "Create a book",
+		Description: "A book whose ISBN another book has is refused with 409, unless upsert=true replaces that book instead.",
+		Query:       []param{{Name: "upsert", Description: "Replace the book with the same ISBN, if any", Schema: boolean}},
+		Body:        jsonBody(ref("Book")),
+		Responses: map[int]response{
+			201: ok("Created book", ref("Book")),
+			200: ok("Replaced book (upsert)", ref("Book")),
+			409: ok("Another book has the ISBN", ref("Conflict")),
+		},
+	},
+	"GET /book/:bookId": {
+		ID:        "getBook",
+		Summary:   "Get a book",
+		Query:     []param{{Name: "as_of", Description: "Return the book as it was at this time (RFC 3339)", Schema: timestamp}},
+		Responses: map[int]response{200: ok("The book", ref("Book")), 304: {Description: "Not modified"}},
+	},
+	"PUT /book/:bookId": {
+		ID:        "updateBook",
+		Summary:   "Replace a book",
+		Body:      jsonBody(ref("Book")),
+		Responses: map[int]response{200: ok("Updated book", ref("Book")), 409: ok("Another book has the ISBN", ref("Conflict"))},
+	},
+	"DELETE /book/:bookId": {
+		ID:      "deleteBook",
+		Summary: "Delete a book",
+		Responses: map[int]response{200: ok("Deleted book", schema{"type": "object", "properties": schema{
+			"message": str, "book": ref("Book"),
+		}})},
+	},
+	"GET /book/isbn/:isbn": {
+		ID:        "getBookByISBN",
+		Summary:   "Get a book by ISBN",
+		Responses: map[int]response{200: ok("The book", ref("Book")), 304: {Description: "Not modified"}},
+	},
+	"GET /book/:bookId/history": {
+		ID:        "getBookHistory",
+		Summary:   "A book's audit trail, newest first",
+		Query:     pageParams,
+		Responses: map[int]response{200: ok("Audit entries", arrayOf(ref("AuditEntry")))},
+	},
+	"POST /book/:bookId/revert/:revision": {
+		ID:          "revertBook",
+		Summary:     "Restore a book's fields from an earlier revision",
+		Description: "Saved as a new update. The cover is not reverted.",
+		Responses:   map[int]response{200: ok("Reverted book", ref("Book")), 409: ok("Another book has the ISBN", ref("Conflict"))},
+	},
+	"POST /book/:bookId/enrich": {
+		ID:      "enrichBook",
+		Summary: "Fill in a book's metadata from its ISBN",
+		Query:   []param{{Name: "overwrite", Description: "Replace fields that are already set", Schema: boolean}},
+		Responses: map[int]response{
+			200: ok("Enriched book", schema{"type": "object", "properties": schema{
+				"book": ref("Book"), "source": str, "updated": arrayOf(str),
+			}}),
+			409: ok("The book's ISBN changed during the lookup", ref("Error")),
+			422: ok("The book has no ISBN", ref("Error")),
+			502: ok("The metadata source is unavailable", ref("Error")),
+		},
+	},
+	"POST /book/:bookId/cover": {
+		ID:      "uploadCover",
+		Summary: "Upload a cover image",
+		Body: map[string]schema{
+			"image/jpeg":          binary,
+			"image/png":           binary,
+			"multipart/form-data": schema{"type": "object", "properties": schema{"file": binary}},
+		},
+		Responses: map[int]response{200: ok("Book with its new cover_url", ref("Book")), 413: ok("Image too large", ref("Error"))},
+	},
+	"GET /book/:bookId/cover": {
+		ID:      "getCover",
+		Summary: "Get a cover image",
+		Query: []param{
+			{Name: "size", Description: "Rendition", Schema: enum("original", "medium", "thumb")},
+			{Name: "v", Description: "Cover version from cover_url; versioned URLs may be cached indefinitely", Schema: str},
+		},
+		Responses: map[int]response{200: {Description: "The image", Content: map[string]schema{"image/jpeg": binary, "image/png": binary}}},
+	},
+	"GET /books/export": {
+		ID:      "exportBooks",
+		Summary: "Download the catalog",
+		Query: append([]param{
+			{Name: "format", Schema: enum("csv", "ndjson", "json", "onix", "marc", "marcxml", "xlsx")},
+			{Name: "currency", Description: "ONIX price currency; prices are not converted, so only the stored currency is accepted", Schema: str},
+		}, filterParams...),
+		Responses: map[int]response{200: {Description: "The matching books in the chosen format", Content: map[string]schema{
+			"text/csv": str, "application/x-ndjson": str, "application/json": arrayOf(ref("Book")),
+			"application/xml": str, "application/marc": binary, "application/marcxml+xml": str,
+			"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet": binary,
+		}}},
+	},
+	"GET /books/stream": {
+		ID:          "streamBooks",
+		Summary:     "Live book events",
+		Description: "Server-Sent Events named by event type with the event JSON as data. Send Last-Event-ID to resume.",
+		Responses:   map[int]response{200: {Description: "Event stream", Content: map[string]schema{"text/event-stream": str}}},
+	},
+	"POST /books/bulk": {
+		ID:          "bulkBooks",
+		Summary:     "Apply a batch of creates, updates and deletes",
+		Description: "atomic mode saves all or nothing and answers with the status of the failing operation; best_effort saves what it can.",
+		Query:       []param{{Name: "mode", Schema: schema{"type": "string", "enum": []string{"atomic", "best_effort"}, "default": "atomic"}}},
+		Body:        jsonBody(arrayOf(ref("BulkOp"))),
+		Responses: map[int]response{
+			200: ok("Outcome of each operation", ref("BulkResponse")),
+			413: ok("Too many operations", ref("Error")),
+		},
+	},
+	"POST /books/import": {
+		ID:          "importBooks",
+		Summary:     "Import books, upserting by ISBN",
+		Description: "The file is the body or the file part of a multipart form.",
+		Query: []param{
+			{Name: "format", Schema: schema{"type": "string", "enum": []string{"csv", "onix", "marc", "marcxml"}, "default": "csv"}},
+			{Name: "dry_run", Description: "Check every row without saving", Schema: boolean},
+			{Name: "map", Description: "Map a CSV column to a field, as <column>:<field>", Schema: str, Repeated: true},
+			{Name: "currency", Description: "ONIX price currency to import", Schema: str},
+		},
+		Body: map[string]schema{
+			"text/csv": str, "application/xml": str, "application/marc": binary,
+			"multipart/form-data": schema{"type": "object", "properties": schema{"file": binary}},
+		},
+		Responses: map[int]response{200: ok("Import report", ref("ImportReport"))},
+	},
+	"GET /books/import/:importId/errors": {
+		ID:        "getImportErrors",
+		Summary:   "Download an import's row errors",
+		Responses: map[int]response{200: {Description: "Row errors", Content: map[string]schema{"text/csv": str}}},
+	},
+
+	"GET /webhooks": {
+		ID:          "listWebhooks",
+		Summary:     "List webhook subscriptions",
+		Description: adminOnly,
+		Responses:   map[int]response{200: ok("Subscriptions", arrayOf(ref("Webhook"))), 401: ok("Admin token required", ref("Error"))},
+	},
+	"POST /webhooks": {
+		ID:          "createWebhook",
+		Summary:     "Subscribe a URL to book events",
+		Description: adminOnly,
+		Body:        jsonBody(ref("WebhookRequest")),
+		Responses:   map[int]response{201: ok("Subscription, with the signing secret", ref("WebhookWithSecret")), 401: ok("Admin token required", ref("Error"))},
+	},
+	"GET /webhooks/:webhookId": {
+		ID:          "getWebhook",
+		Summary:     "Get a subscription",
+		Description: adminOnly,
+		Responses:   map[int]response{200: ok("The subscription", ref("Webhook")), 401: ok("Admin token required", ref("Error"))},
+	},
+	"PUT /webhooks/:webhookId": {
+		ID:          "updateWebhook",
+		Summary:     "Replace a subscription",
+		Description: adminOnly,
+		Body:        jsonBody(ref("WebhookRequest")),
+		Responses:   map[int]response{200: ok("The subscription, with the secret if it was rotated", ref("WebhookWithSecret")), 401: ok("Admin token required", ref("Error"))},
+	},
+	"DELETE /webhooks/:webhookId": {
+		ID:          "deleteWebhook",
+		Summary:     "Delete a subscription",
+		Description: adminOnly,
+		Responses:   map[int]response{200: ok("Deleted", schema{"type": "object", "properties": schema{"message": str}}), 401: ok("Admin token required", ref("Error"))},
+	},
+	"GET /webhooks/:webhookId/deliveries": {
+		ID:          "listWebhookDeliveries",
+		Summary:     "List a subscription's deliveries",
+		Description: adminOnly,
+		Query: append([]param{
+			{Name: "status", Schema: enum(models.DeliveryPending, models.DeliverySucceeded, models.DeliveryDead)},
+			{Name: "event_type", Schema: enum(models.EventTypes...)},
+		}, pageParams...),
+		Responses: map[int]response{200: ok("Deliveries, newest first", arrayOf(ref("WebhookDelivery"))), 401: ok("Admin token required", ref("Error"))},
+	},
+	"GET /webhooks/:webhookId/deliveries/:deliveryId": {
+		ID:          "getWebhookDelivery",
+		Summary:     "Get a delivery with its attempts",
+		Description: adminOnly,
+		Responses:   map[int]response{200: ok("The delivery", ref("WebhookDelivery")), 401: ok("Admin token required", ref("Error"))},
+	},
+	"POST /webhooks/:webhookId/deliveries/:deliveryId/redeliver": {
+		ID:          "redeliverWebhook",
+		Summary:     "Send a delivery again",
+		Description: adminOnly,
+		Responses:   map[int]response{202: ok("The delivery, queued", ref("WebhookDelivery")), 401: ok("Admin token required", ref("Error"))},
+	},
+
+	"GET /graphql": {
+		ID:          "graphqlQuery",
+		Summary:     "Run a GraphQL query",
+		Description: "Mutations must be sent with POST.",
+		Query: []param{
+			{Name: "query", Description: "GraphQL document", Schema: str},
+			{Name: "operationName", Description: "Operation to run, when the document has several", Schema: str},
+			{Name: "variables", Description: "Variables as a JSON object", Schema: str},
+		},
+		Responses: map[int]response{200: ok("Result, with any field errors", ref("GraphQLResult")), 400: ok("The query can't run", ref("GraphQLResult"))},
+	},
+	"POST /graphql": {
+		ID:        "graphql",
+		Summary:   "Run a GraphQL query or mutation",
+		Body:      jsonBody(ref("GraphQLRequest")),
+		Responses: map[int]response{200: ok("Result, with any field errors", ref("GraphQLResult")), 400: ok("The query can't run", ref("GraphQLResult"))},
+	},
+
+	"GET /admin/audit": {
+		ID:          "searchAudit",
+		Summary:     "Search the audit trail",
+		Description: adminOnly,
+		Query: append([]param{
+			{Name: "book_id", Schema: integer},
+			{Name: "actor", Schema: str},
+			{Name: "action", Schema: enum(models.AuditCreated, models.AuditUpdated, models.AuditDeleted)},
+			{Name: "request_id", Schema: str},
+			{Name: "field", Description: "Entries that changed this field", Schema: str},
+			{Name: "since", Schema: timestamp},
+			{Name: "until", Schema: timestamp},
+		}, pageParams...),
+		Responses: map[int]response{200: ok("Audit entries, newest first", arrayOf(ref("AuditEntry"))), 401: ok("Admin token required", ref("Error"))},
+	},
+}
+
+// schemas are the named types the operations refer to.
+func schemas() map[string]schema {
+	s := schemaGen{names: map[reflect.Type]string{
+		reflect.TypeOf(models.Book{}):            "Book",
+		reflect.TypeOf(models.AuditEntry{}):      "AuditEntry",
+		reflect.TypeOf(models.Webhook{}):         "Webhook",
+		reflect.TypeOf(models.WebhookDelivery{}): "WebhookDelivery",
+		reflect.TypeOf(models.BulkOp{}):          "BulkOp",
+		reflect.TypeOf(importer.Report{}):        "ImportReport",
+	}}
+	out := map[string]schema{}
+	for t, name := range s.names {
+		out[name] = s.object(t)
+	}
+	// Book fields the server sets. Their schemas are copied first, since
+	// some, like timestamp, are shared.
+	book := out["Book"]["properties"].(schema)
+	for _, f := range []string{"id", "created_at", "updated_at"} {
+		readOnly := maps.Clone(book[f].(schema))
+		readOnly["readOnly"] = true
+		book[f] = readOnly
+	}
+	out["BulkOp"]["properties"].(schema)["op"] = enum(models.BulkCreate, models.BulkUpdate, models.BulkDelete)
+
+	out["Error"] = schema{"type": "object", "properties": schema{"error": str, "request_id": str}}
+	out["Conflict"] = schema{"type": "object", "properties": schema{
+		"error": str, "request_id": str, "book_id": integer, "book_url": str,
+	}}
+	out["BulkResponse"] = schema{"type": "object", "properties": schema{
+		"mode":    enum("atomic", "best_effort"),
+		"applied": integer,
+		"failed":  integer,
+		"results": arrayOf(schema{"type": "object", "properties": schema{
+			"index": integer, "op": str, "status": integer, "book": ref("Book"), "error": str,
+		}}),
+	}}
+	out["WebhookRequest"] = schema{"type": "object", "required": []string{"url"}, "properties": schema{
+		"url":    str,
+		"events": arrayOf(enum(models.EventTypes...)),
+		"fields": arrayOf(str),
+		"secret": schema{"type": "string", "description": "Generated when left out of a new subscription"},
+		"active": schema{"type": "boolean", "default": true},
+	}}
+	out["GraphQLRequest"] = schema{"type": "object", "required": []string{"query"}, "properties": schema{
+		"query": str, "operationName": str, "variables": schema{"type": "object"},
+	}}
+	out["GraphQLResult"] = schema{"type": "object", "properties": schema{
+		"data": schema{"type": []string{"object", "null"}},
+		"errors": arrayOf(schema{"type": "object", "properties": schema{
+			"message": str, "path": arrayOf(schema{}), "extensions": schema{"type": "object"},
+		}}),
+	}}
+	out["WebhookWithSecret"] = schema{"allOf": []schema{ref("Webhook"), {"type": "object", "properties": schema{"secret": str}}}}
+	return out
+}
+
+// schemaGen derives JSON schemas from Go types, as encoding/json would
+// marshal them.
+type schemaGen struct {
+	names map[reflect.Type]string
+}
+
+func (g schemaGen) of(t reflect.Type) schema {
+	if name, ok := g.names[t]; ok {
+		return ref(name)
+	}
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		return timestamp
+	case reflect.TypeOf([]byte(nil)):
+		return schema{"type": "string", "contentEncoding": "base64"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schema{"anyOf": []schema{g.of(t.Elem()), {"type": "null"}}}
+	case reflect.String:
+		return schema{"type": "string"}
+	case reflect.Bool:
+		return schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return schema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return schema{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return arrayOf(g.of(t.Elem()))
+	case reflect.Map:
+		return schema{"type": "object", "additionalProperties": g.of(t.Elem())}
+	case reflect.Struct:
+		return g.object(t)
+	}
+	// Interfaces hold any value.
+	return schema{}
+}
+
+func (g schemaGen) object(t reflect.Type) schema {
+	props := schema{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = g.of(f.Type)
+	}
+	return schema{"type": "object", "properties": props}
+}
+
+// openAPI builds the OpenAPI document for the registered routes.
+func openAPI(registered []registration) schema {
+	paths := schema{}
+	for _, reg := range registered {
+		op, documented := docs[reg.Method+" "+reg.Path]
+		if !documented {
+			continue
+		}
+		path, params := openAPIPath(reg.Path)
+		for _, p := range op.Query {
+			q := schema{"name": p.Name, "in": "query", "schema": p.Schema}
+			if p.Repeated {
+				q["schema"] = arrayOf(p.Schema)
+				q["explode"] = true
+			}
+			if p.Description != "" {
+				q["description"] = p.Description
+			}
+			params = append(params, q)
+		}
+		if reg.Idempotent {
+			params = append(params, schema{"name": "Idempotency-Key", "in": "header", "schema": schema{"type": "string", "maxLength": 255},
+				"description": "Retries with the same key and body get the first response again"})
+		}
+
+		responses := schema{"default": ok("Error", ref("Error")).object()}
+		for status, resp := range op.Responses {
+			responses[strconv.Itoa(status)] = resp.object()
+		}
+		o := schema{
+			"operationId": op.ID,
+			"summary":     op.Summary,
+			"tags":        []string{tag(reg.Path)},
+			"responses":   responses,
+		}
+		if op.Description != "" {
+			o["description"] = op.Description
+		}
+		if len(params) > 0 {
+			o["parameters"] = params
+		}
+		if op.Body != nil {
+			o["requestBody"] = schema{"required": true, "content": content(op.Body)}
+		}
+		if paths[path] == nil {
+			paths[path] = schema{}
+		}
+		paths[path].(schema)[strings.ToLower(reg.Method)] = o
+	}
+	return schema{
+		"openapi": "3.1.0",
+		"info": schema{
+			"title":       "Bookstore API",
+			"version":     "1.0.0",
+			"description": "Manage a book catalog: books, their history, bulk changes, imports and exports, and webhooks for changes.",
+		},
+		"paths":      paths,
+		"components": schema{"schemas": schemas()},
+	}
+}
+
+func (r response) object() schema {
+	o := schema{"description": r.Description}
+	if r.Content != nil {
+		o["content"] = content(r.Content)
+	}
+	return o
+}
+
+func content(types map[string]schema) schema {
+	c := schema{}
+	for ct, s := range types {
+		c[ct] = schema{"schema": s}
+	}
+	return c
+}
+
+// openAPIPath turns an httprouter path into an OpenAPI one and lists its
+// parameters.
+func openAPIPath(path string) (string, []schema) {
+	var params []schema
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if name, ok := strings.CutPrefix(s, ":"); ok {
+			p := pathParams[name]
+			params = append(params, schema{"name": name, "in": "path", "required": true, "description": p.Description, "schema": p.Schema})
+			segments[i] = "{" + name + "}"
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+func tag(path string) string {
+	switch {
+	case strings.HasPrefix(path, "/book"):
+		return "Books"
+	case strings.HasPrefix(path, "/webhooks"):
+		return "Webhooks"
+	case strings.HasPrefix(path, "/admin"):
+		return "Admin"
+	case path == "/graphql":
+		return "GraphQL"
+	}
+	return "Service"
+}
+
+//go:embed docs.html
+var docsPage []byte
+
+// serveOpenAPI registers the OpenAPI document of the routes registered so
+// far, itself included, and a page rendering it.
+func (r router) serveOpenAPI() {
+	var spec []byte
+	r.handle(http.MethodGet, "/openapi.json", func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(spec)
+	})
+	r.handle(http.MethodGet, "/docs", func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(docsPage)
+	})
+	spec, _ = json.MarshalIndent(openAPI(*r.registered), "", "  ")
+}
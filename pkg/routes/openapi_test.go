@@ -0,0 +1,121 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestOpenAPIMatchesRoutes(t *testing.T) {
+	r := httprouter.New()
+	routes := register(r, Options{})
+	seen := map[string]bool{}
+	for _, reg := range routes {
+		key := reg.Method + " " + reg.Path
+		if seen[key] {
+			t.Errorf("%s registered twice", key)
+		}
+		seen[key] = true
+		if _, ok := docs[key]; !ok {
+			t.Errorf("%s is registered but not documented in docs", key)
+		}
+		// The route should be reachable as recorded.
+		path := regexp.MustCompile(`:[^/]+`).ReplaceAllStringFunc(reg.Path, func(p string) string {
+			if p == ":isbn" {
+				return "9780306406157"
+			}
+			return "1"
+		})
+		if h, _, _ := r.Lookup(reg.Method, path); h == nil {
+			t.Errorf("%s is recorded but %s %s has no handler", key, reg.Method, path)
+		}
+		for _, s := range strings.Split(reg.Path, "/") {
+			if name, ok := strings.CutPrefix(s, ":"); ok && pathParams[name].Schema == nil {
+				t.Errorf("%s: path parameter %s isn't described in pathParams", key, name)
+			}
+		}
+	}
+	for key := range docs {
+		if !seen[key] {
+			t.Errorf("%s is documented but not registered", key)
+		}
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	r := httprouter.New()
+	RegisterRoutes(r, Options{})
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("got %v %v", rr.Code, rr.Header())
+	}
+	var spec struct {
+		OpenAPI    string                                       `json:"openapi"`
+		Paths      map[string]map[string]map[string]interface{} `json:"paths"`
+		Components struct {
+			Schemas map[string]interface{} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &spec); err != nil {
+		t.Fatal(err)
+	}
+	if spec.OpenAPI != "3.1.0" {
+		t.Errorf("openapi: got %q", spec.OpenAPI)
+	}
+	book := spec.Paths["/book/{bookId}"]
+	if book["get"] == nil || book["put"] == nil || book["delete"] == nil {
+		t.Errorf("/book/{bookId} operations missing: %v", book)
+	}
+	if _, ok := spec.Components.Schemas["Book"].(map[string]interface{})["properties"].(map[string]interface{})["publication_year"]; !ok {
+		t.Errorf("Book schema lacks publication_year: %v", spec.Components.Schemas["Book"])
+	}
+	if !strings.Contains(rr.Body.String(), `"name": "Idempotency-Key"`) {
+		t.Error("idempotent routes should document Idempotency-Key")
+	}
+
+	ids := map[string]bool{}
+	for path, ops := range spec.Paths {
+		for method, op := range ops {
+			id, _ := op["operationId"].(string)
+			if ids[id] {
+				t.Errorf("%s %s: duplicate operationId %q", method, path, id)
+			}
+			ids[id] = true
+			// Only the server sets readOnly fields, which a client's
+			// parameters can't be.
+			params, _ := op["parameters"].([]interface{})
+			for _, param := range params {
+				param := param.(map[string]interface{})
+				if s, _ := param["schema"].(map[string]interface{}); s["readOnly"] != nil {
+					t.Errorf("%s %s: parameter %v is readOnly", method, path, param["name"])
+				}
+			}
+			for status, resp := range op["responses"].(map[string]interface{}) {
+				if _, ok := resp.(map[string]interface{})["description"].(string); !ok {
+					t.Errorf("%s %s: response %s has no description", method, path, status)
+				}
+			}
+		}
+	}
+	audit := spec.Components.Schemas["AuditEntry"].(map[string]interface{})["properties"].(map[string]interface{})
+	if audit["occurred_at"].(map[string]interface{})["readOnly"] != nil || timestamp["readOnly"] != nil {
+		t.Error("only Book's own timestamps should be readOnly")
+	}
+	for _, m := range regexp.MustCompile(`"#/components/schemas/(\w+)"`).FindAllStringSubmatch(rr.Body.String(), -1) {
+		if spec.Components.Schemas[m[1]] == nil {
+			t.Errorf("$ref to undefined schema %s", m[1])
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "openapi.json") {
+		t.Errorf("docs page: got %v", rr.Code)
+	}
+}
@@ -1,21 +1,160 @@
 package routes
 
 import (
+	"expvar"
+	"fmt"
 	"net/http"
 
 	"github.com/adedaryorh/bookstore-app/pkg/controllers"
+	"github.com/adedaryorh/bookstore-app/pkg/idempotency"
+	"github.com/adedaryorh/bookstore-app/pkg/middleware"
 	"github.com/julienschmidt/httprouter"
 )
 
-func RegisterRoutes(r *httprouter.Router) {
-	r.GET("/book", controllers.GetBooks)
-	r.POST("/book", controllers.CreateBook)
-	r.GET("/book/:bookId", controllers.GetBookByID)
-	r.GET("/books", controllers.GetAllBooks)
-	r.PUT("/book/:bookId", controllers.UpdateBook)
-	r.DELETE("/book/:bookId", controllers.DeleteBook)
+// Options tunes the registered routes.
+type Options struct {
+	// CacheControl maps a route path to the Cache-Control policy sent with
+	// its successful GET responses.
+	CacheControl map[string]string
+	// AdminToken guards the /admin, /webhooks and /debug/vars routes;
+	// empty leaves them open.
+	AdminToken string
+	// Idempotency stores the responses replayed for POST requests retried
+	// with the same Idempotency-Key; nil ignores the header.
+	Idempotency idempotency.Store
+}
+
+func RegisterRoutes(r *httprouter.Router, opts Options) {
+	register(r, opts)
+}
+
+// register registers the routes and returns them.
+func register(r *httprouter.Router, opts Options) []registration {
+	rt := router{r, opts, &[]registration{}}
+	rt.handle(http.MethodGet, "/book", controllers.GetBooks)
+	rt.handleIdempotent(http.MethodPost, "/book", controllers.CreateBook)
+	rt.handle(http.MethodGet, "/book/:bookId", controllers.GetBookByID)
+	byISBN := rt.wrap(http.MethodGet, "/book/isbn/:isbn", controllers.GetBookByISBN)
+	cover := rt.wrap(http.MethodGet, "/book/:bookId/cover", controllers.GetCover)
+	history := rt.wrap(http.MethodGet, "/book/:bookId/history", controllers.GetBookHistory)
+	// httprouter won't register /book/isbn/:isbn beside /book/:bookId, so
+	// GETs two levels below /book share one pattern and are told apart here.
+	r.GET("/book/:bookId/:sub", func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+		switch {
+		case ps.ByName("bookId") == "isbn":
+			byISBN(w, req, httprouter.Params{{Key: "isbn", Value: ps.ByName("sub")}})
+		case ps.ByName("sub") == "cover":
+			cover(w, req, ps)
+		case ps.ByName("sub") == "history":
+			history(w, req, ps)
+		default:
+			http.NotFound(w, req)
+		}
+	})
+	rt.handle(http.MethodGet, "/books", controllers.GetAllBooks)
+	rt.handle(http.MethodGet, "/books/export", controllers.ExportBooks)
+	rt.handle(http.MethodGet, "/books/stream", controllers.StreamBooks)
+	rt.handleIdempotent(http.MethodPost, "/books/bulk", controllers.BulkBooks)
+	rt.handle(http.MethodPost, "/books/import", controllers.ImportBooks)
+	rt.handle(http.MethodGet, "/books/import/:importId/errors", controllers.GetImportErrors)
+	rt.handle(http.MethodPut, "/book/:bookId", controllers.UpdateBook)
+	rt.handle(http.MethodDelete, "/book/:bookId", controllers.DeleteBook)
+	rt.handleIdempotent(http.MethodPost, "/book/:bookId/enrich", controllers.EnrichBook)
+	rt.handle(http.MethodPost, "/book/:bookId/cover", controllers.UploadCover)
+	rt.handleIdempotent(http.MethodPost, "/book/:bookId/revert/:revision", controllers.RevertBook)
+	rt.handleAdmin(http.MethodGet, "/webhooks", controllers.GetWebhooks)
+	rt.handleAdminIdempotent(http.MethodPost, "/webhooks", controllers.CreateWebhook)
+	rt.handleAdmin(http.MethodGet, "/webhooks/:webhookId", controllers.GetWebhook)
+	rt.handleAdmin(http.MethodPut, "/webhooks/:webhookId", controllers.UpdateWebhook)
+	rt.handleAdmin(http.MethodDelete, "/webhooks/:webhookId", controllers.DeleteWebhook)
+	rt.handleAdmin(http.MethodGet, "/webhooks/:webhookId/deliveries", controllers.GetWebhookDeliveries)
+	rt.handleAdmin(http.MethodGet, "/webhooks/:webhookId/deliveries/:deliveryId", controllers.GetWebhookDelivery)
+	rt.handleAdminIdempotent(http.MethodPost, "/webhooks/:webhookId/deliveries/:deliveryId/redeliver", controllers.RedeliverWebhook)
+	rt.handle(http.MethodGet, "/graphql", controllers.GraphQL)
+	rt.handle(http.MethodPost, "/graphql", controllers.GraphQL)
+	rt.handle(http.MethodGet, "/admin/audit", middleware.AdminOnly(opts.AdminToken, controllers.SearchAudit))
+	rt.record(http.MethodGet, "/health")
 	r.GET("/health", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
 	})
+	rt.record(http.MethodGet, "/ready")
+	r.GET("/ready", controllers.Ready)
+	rt.handle(http.MethodGet, "/debug/vars", middleware.AdminOnly(opts.AdminToken, debugVars))
+	rt.serveOpenAPI()
+	return *rt.registered
+}
+
+type router struct {
+	*httprouter.Router
+	opts Options
+	// registered lists the routes for the OpenAPI document.
+	registered *[]registration
+}
+
+// handle registers h for method and path wrapped in the shared middleware.
+func (r router) handle(method, path string, h httprouter.Handle) {
+	r.Handle(method, path, r.wrap(method, path, h))
+}
+
+// handleIdempotent registers h like handle, replaying its responses to
+// retried requests. Uploads are left out, since their bodies would have to
+// be held in memory.
+func (r router) handleIdempotent(method, path string, h httprouter.Handle) {
+	r.handle(method, path, idempotency.Handle(r.opts.Idempotency, h))
+	(*r.registered)[len(*r.registered)-1].Idempotent = true
+}
+
+// handleAdmin registers h like handle for holders of the admin token.
+func (r router) handleAdmin(method, path string, h httprouter.Handle) {
+	r.handle(method, path, middleware.AdminOnly(r.opts.AdminToken, h))
+}
+
+// handleAdminIdempotent is handleIdempotent for holders of the admin
+// token, checked before a stored response is replayed.
+func (r router) handleAdminIdempotent(method, path string, h httprouter.Handle) {
+	r.handleAdmin(method, path, idempotency.Handle(r.opts.Idempotency, h))
+	(*r.registered)[len(*r.registered)-1].Idempotent = true
+}
+
+// record notes a route registered without the shared middleware.
+func (r router) record(method, path string) {
+	*r.registered = append(*r.registered, registration{Method: method, Path: path})
+}
+
+// wrap applies the shared middleware to h, naming it path in logs and
+// traces.
+func (r router) wrap(method, path string, h httprouter.Handle) httprouter.Handle {
+	r.record(method, path)
+	if method == http.MethodGet {
+		h = middleware.CacheControl(r.opts.CacheControl[path], h)
+	}
+	h = middleware.AccessLog(path, h)
+	h = middleware.Trace(path, h)
+	h = middleware.Identify(h)
+	return middleware.RequestID(h)
+}
+
+// hiddenVars are left out of /debug/vars: cmdline holds any secret passed
+// as a flag, and memstats tells callers more about the process than they
+// need.
+var hiddenVars = map[string]bool{"cmdline": true, "memstats": true}
+
+// debugVars serves the published expvars, as expvar.Handler does, except
+// hiddenVars.
+func debugVars(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	fmt.Fprint(w, "{\n")
+	first := true
+	expvar.Do(func(kv expvar.KeyValue) {
+		if hiddenVars[kv.Key] {
+			return
+		}
+		if !first {
+			fmt.Fprint(w, ",\n")
+		}
+		first = false
+		fmt.Fprintf(w, "%q: %s", kv.Key, kv.Value)
+	})
+	fmt.Fprint(w, "\n}\n")
 }
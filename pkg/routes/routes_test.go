@@ -0,0 +1,59 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestDebugVars(t *testing.T) {
+	r := httprouter.New()
+	RegisterRoutes(r, Options{AdminToken: "secret"})
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/debug/vars", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("without the admin token: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+
+	rr = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/debug/vars", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	r.ServeHTTP(rr, req)
+	var vars map[string]json.RawMessage
+	if err := json.Unmarshal(rr.Body.Bytes(), &vars); err != nil {
+		t.Fatalf("decoding %s: %v", rr.Body, err)
+	}
+	if _, ok := vars["book_cache"]; !ok {
+		t.Errorf("book_cache missing: %s", rr.Body)
+	}
+	for _, name := range []string{"cmdline", "memstats"} {
+		if _, ok := vars[name]; ok {
+			t.Errorf("%s should not be published", name)
+		}
+	}
+}
+
+func TestWebhooksRequireAdminToken(t *testing.T) {
+	r := httprouter.New()
+	RegisterRoutes(r, Options{AdminToken: "secret"})
+
+	for _, route := range []struct{ method, path string }{
+		{http.MethodGet, "/webhooks"},
+		{http.MethodPost, "/webhooks"},
+		{http.MethodDelete, "/webhooks/1"},
+		{http.MethodGet, "/webhooks/1/deliveries/2"},
+		{http.MethodPost, "/webhooks/1/deliveries/2/redeliver"},
+	} {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(route.method, route.path, nil)
+		req.Header.Set("Idempotency-Key", "k1")
+		r.ServeHTTP(rr, req)
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("%s %s: got %v want %v", route.method, route.path, rr.Code, http.StatusUnauthorized)
+		}
+	}
+}
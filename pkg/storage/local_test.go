@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLocal(t *testing.T) {
+	store, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := store.Put(ctx, "a/b/c", strings.NewReader("first")); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(ctx, "a/b/c", strings.NewReader("second")); err != nil {
+		t.Fatal(err)
+	}
+	obj, err := store.Get(ctx, "a/b/c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(obj)
+	obj.Close()
+	if string(data) != "second" || obj.Size != 6 || obj.ModTime.IsZero() {
+		t.Errorf("got %q size %d modtime %v", data, obj.Size, obj.ModTime)
+	}
+
+	if _, err := store.Get(ctx, "a/b"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("directory: got %v want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(ctx, "a/b/c"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("after delete: got %v want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, "missing"); err != nil {
+		t.Errorf("deleting nothing: %v", err)
+	}
+}
+
+func TestLocalRejectsEscapingKeys(t *testing.T) {
+	store, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"", "/etc/passwd", "../x", "a/../../x", "a//b", `a\b`} {
+		if err := store.Put(context.Background(), key, strings.NewReader("x")); err == nil {
+			t.Errorf("Put(%q) should fail", key)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+// Package storage keeps binary objects, such as cover images, under string
+// keys.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrNotFound is returned when no object is stored under a key.
+var ErrNotFound = errors.New("object not found")
+
+// Store is a flat key/value store for binary objects. Keys are slash
+// separated paths like "covers/12/thumb". Implementations must be safe for
+// concurrent use, and Put must replace an object atomically so readers see
+// either the old or the new content.
+type Store interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	Get(ctx context.Context, key string) (*Object, error)
+	// Delete removes every object whose key starts with prefix + "/", or
+	// equals prefix. Deleting nothing is not an error.
+	Delete(ctx context.Context, prefix string) error
+}
+
+// Object is an open stored object. The caller must close it.
+type Object struct {
+	io.ReadSeekCloser
+	Size    int64
+	ModTime time.Time
+}
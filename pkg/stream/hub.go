@@ -0,0 +1,139 @@
+// Package stream fans book events out to live subscribers, such as
+// Server-Sent Events clients, and keeps the most recent ones so a client
+// that reconnects can pick up where it left off.
+package stream
+
+import (
+	"sync"
+	"time"
+
+	"github.com/adedaryorh/bookstore-app/pkg/models"
+)
+
+// subscriberBuffer is how many messages a subscriber may fall behind
+// before it is dropped.
+const subscriberBuffer = 64
+
+// Message is an event numbered in the order the hub received it.
+type Message struct {
+	ID    uint64
+	Event models.Event
+}
+
+// Hub broadcasts events to subscribers and remembers the last few.
+type Hub struct {
+	mu sync.Mutex
+	// buf holds the most recent messages, oldest first.
+	buf    []Message
+	size   int
+	lastID uint64
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+// NewHub returns a hub replaying up to size recent events. Message IDs
+// start from the current time in microseconds, so they keep increasing
+// across restarts and an ID from before one is recognised as unknown
+// rather than mistaken for a new event.
+func NewHub(size int) *Hub {
+	return &Hub{
+		size:   size,
+		lastID: uint64(time.Now().UnixMicro()),
+		subs:   map[*Subscription]struct{}{},
+	}
+}
+
+// Subscription receives messages published after it was made.
+type Subscription struct {
+	// C is closed when the subscription ends: it was closed, the hub shut
+	// down or the subscriber fell too far behind.
+	C   <-chan Message
+	ch  chan Message
+	hub *Hub
+}
+
+// Close ends the subscription.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.drop(s)
+}
+
+// Publish numbers ev and sends it to every subscriber. A subscriber whose
+// buffer is full is dropped instead of holding up the others; it can
+// resume from its last message while that is still in the replay buffer.
+func (h *Hub) Publish(ev models.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+	h.lastID++
+	msg := Message{ID: h.lastID, Event: ev}
+	if h.size > 0 {
+		if len(h.buf) == h.size {
+			copy(h.buf, h.buf[1:])
+			h.buf = h.buf[:h.size-1]
+		}
+		h.buf = append(h.buf, msg)
+	}
+	for s := range h.subs {
+		select {
+		case s.ch <- msg:
+		default:
+			h.drop(s)
+		}
+	}
+}
+
+// Subscribe starts a subscription. When lastID is not zero, the buffered
+// messages after it are returned to be sent first; complete is false when
+// messages after lastID are no longer buffered, or lastID was never
+// issued, and the subscriber should reload what it has.
+func (h *Hub) Subscribe(lastID uint64) (sub *Subscription, replay []Message, complete bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ch := make(chan Message, subscriberBuffer)
+	sub = &Subscription{C: ch, ch: ch, hub: h}
+	if h.closed {
+		close(ch)
+		return sub, nil, true
+	}
+	h.subs[sub] = struct{}{}
+
+	if lastID == 0 || lastID == h.lastID {
+		return sub, nil, true
+	}
+	oldest := h.lastID + 1
+	if len(h.buf) > 0 {
+		oldest = h.buf[0].ID
+	}
+	if lastID > h.lastID || lastID+1 < oldest {
+		return sub, nil, false
+	}
+	for _, msg := range h.buf {
+		if msg.ID > lastID {
+			replay = append(replay, msg)
+		}
+	}
+	return sub, replay, true
+}
+
+// Close ends every subscription, so long-lived streams finish before the
+// server shuts down.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for s := range h.subs {
+		h.drop(s)
+	}
+}
+
+// drop removes a subscriber; h.mu must be held.
+func (h *Hub) drop(s *Subscription) {
+	if _, ok := h.subs[s]; ok {
+		delete(h.subs, s)
+		close(s.ch)
+	}
+}
@@ -0,0 +1,95 @@
+package stream
+
+import (
+	"testing"
+
+	"github.com/adedaryorh/bookstore-app/pkg/models"
+)
+
+func publish(h *Hub, n int) {
+	for i := 0; i < n; i++ {
+		h.Publish(models.Event{Type: models.EventBookUpdated, BookID: uint(i + 1)})
+	}
+}
+
+func TestHubBroadcasts(t *testing.T) {
+	h := NewHub(10)
+	a, _, _ := h.Subscribe(0)
+	b, _, _ := h.Subscribe(0)
+	defer b.Close()
+	publish(h, 1)
+
+	for name, sub := range map[string]*Subscription{"a": a, "b": b} {
+		if msg := <-sub.C; msg.Event.BookID != 1 {
+			t.Errorf("%s: got book %d want 1", name, msg.Event.BookID)
+		}
+	}
+	a.Close()
+	publish(h, 1)
+	if _, ok := <-a.C; ok {
+		t.Error("closed subscription still receives")
+	}
+	if msg := <-b.C; msg.Event.BookID != 1 {
+		t.Errorf("got book %d want 1", msg.Event.BookID)
+	}
+}
+
+func TestHubReplay(t *testing.T) {
+	h := NewHub(3)
+	sub, _, _ := h.Subscribe(0)
+	publish(h, 5)
+	var ids []uint64
+	for i := 0; i < 5; i++ {
+		ids = append(ids, (<-sub.C).ID)
+	}
+	sub.Close()
+
+	tests := []struct {
+		name     string
+		lastID   uint64
+		replayed int
+		complete bool
+	}{
+		{"up to date", ids[4], 0, true},
+		{"missed two", ids[2], 2, true},
+		{"oldest buffered", ids[1], 3, true},
+		{"evicted", ids[0], 0, false},
+		{"unknown", ids[4] + 100, 0, false},
+	}
+	for _, tt := range tests {
+		sub, replay, complete := h.Subscribe(tt.lastID)
+		sub.Close()
+		if len(replay) != tt.replayed || complete != tt.complete {
+			t.Errorf("%s: got %d replayed, complete %v; want %d, %v", tt.name, len(replay), complete, tt.replayed, tt.complete)
+		}
+		if len(replay) > 0 && replay[len(replay)-1].ID != ids[4] {
+			t.Errorf("%s: replay should end with the latest message", tt.name)
+		}
+	}
+}
+
+func TestHubDropsSlowSubscribers(t *testing.T) {
+	h := NewHub(0)
+	slow, _, _ := h.Subscribe(0)
+	publish(h, subscriberBuffer+1)
+	n := 0
+	for range slow.C {
+		n++
+	}
+	if n != subscriberBuffer {
+		t.Errorf("got %d messages before the drop want %d", n, subscriberBuffer)
+	}
+}
+
+func TestHubClose(t *testing.T) {
+	h := NewHub(10)
+	sub, _, _ := h.Subscribe(0)
+	h.Close()
+	if _, ok := <-sub.C; ok {
+		t.Error("subscription should end when the hub closes")
+	}
+	late, _, _ := h.Subscribe(0)
+	if _, ok := <-late.C; ok {
+		t.Error("subscribing to a closed hub should end at once")
+	}
+}
@@ -0,0 +1,78 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/jinzhu/gorm"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	contextKey = "tracing:context"
+	spanKey    = "tracing:span"
+)
+
+// WithContext returns a copy of db whose queries are traced as children of
+// the span in ctx.
+func WithContext(db *gorm.DB, ctx context.Context) *gorm.DB {
+	return db.Set(contextKey, ctx)
+}
+
+// RegisterCallbacks adds span-emitting callbacks around every gorm operation.
+func RegisterCallbacks(db *gorm.DB) {
+	cb := db.Callback()
+
+	cb.Create().Before("gorm:begin_transaction").Register("tracing:before_create", startSpan("INSERT"))
+	cb.Create().After("gorm:commit_or_rollback_transaction").Register("tracing:after_create", endSpan)
+	cb.Query().Before("gorm:query").Register("tracing:before_query", startSpan("SELECT"))
+	cb.Query().After("gorm:after_query").Register("tracing:after_query", endSpan)
+	cb.RowQuery().Before("gorm:row_query").Register("tracing:before_row_query", startSpan("SELECT"))
+	cb.RowQuery().After("gorm:row_query").Register("tracing:after_row_query", endSpan)
+	cb.Update().Before("gorm:begin_transaction").Register("tracing:before_update", startSpan("UPDATE"))
+	cb.Update().After("gorm:commit_or_rollback_transaction").Register("tracing:after_update", endSpan)
+	cb.Delete().Before("gorm:begin_transaction").Register("tracing:before_delete", startSpan("DELETE"))
+	cb.Delete().After("gorm:commit_or_rollback_transaction").Register("tracing:after_delete", endSpan)
+}
+
+func startSpan(operation string) func(*gorm.Scope) {
+	return func(scope *gorm.Scope) {
+		ctx := context.Background()
+		if v, ok := scope.Get(contextKey); ok {
+			if c, ok := v.(context.Context); ok {
+				ctx = c
+			}
+		}
+		table := scope.TableName()
+		_, span := Tracer().Start(ctx, operation+" "+table,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("db.system", "postgresql"),
+				attribute.String("db.operation.name", operation),
+				attribute.String("db.collection.name", table),
+			),
+		)
+		scope.Set(spanKey, span)
+	}
+}
+
+func endSpan(scope *gorm.Scope) {
+	v, ok := scope.Get(spanKey)
+	if !ok {
+		return
+	}
+	span, ok := v.(trace.Span)
+	if !ok {
+		return
+	}
+	span.SetAttributes(
+		attribute.String("db.query.text", scope.SQL),
+		attribute.Int64("db.response.returned_rows", scope.DB().RowsAffected),
+	)
+	if err := scope.DB().Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
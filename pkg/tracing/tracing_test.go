@@ -0,0 +1,59 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSetupFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.json")
+
+	shutdown, err := Setup(context.Background(), Options{
+		Exporter:    ExporterFile,
+		File:        path,
+		ServiceName: "bookstore-test",
+	})
+	if err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+
+	_, span := Tracer().Start(context.Background(), "test-span")
+	span.End()
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "test-span") {
+		t.Errorf("span not written to trace file: %s", data)
+	}
+	if !strings.Contains(string(data), "bookstore-test") {
+		t.Errorf("service name missing from trace file: %s", data)
+	}
+}
+
+func TestSetupRejectsInvalidOptions(t *testing.T) {
+	if _, err := Setup(context.Background(), Options{Exporter: "zipkin"}); err == nil {
+		t.Error("expected error for unknown exporter")
+	}
+	if _, err := Setup(context.Background(), Options{Exporter: ExporterFile}); err == nil {
+		t.Error("expected error for file exporter without a path")
+	}
+}
+
+func TestSetupNoneExporter(t *testing.T) {
+	shutdown, err := Setup(context.Background(), Options{Exporter: ExporterNone})
+	if err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("shutdown failed: %v", err)
+	}
+}
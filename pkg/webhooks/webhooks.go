@@ -0,0 +1,253 @@
+// Package webhooks pushes book events to partner subscriptions. Events
+// relayed from the outbox are queued once per matching subscription, and a
+// dispatcher sends each queued delivery as a signed POST, retrying failures
+// with exponential backoff until it gives up and marks the delivery dead.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/adedaryorh/bookstore-app/pkg/models"
+)
+
+// maxResponseLog is how much of a receiver's response body is kept in the
+// delivery log.
+const maxResponseLog = 1024
+
+// Fanout queues each event it is given for the subscriptions it matches.
+// It is an outbox publisher, so queueing happens at least once per event
+// and the queue drops the repeats.
+type Fanout struct{}
+
+// Publish queues ev.
+func (Fanout) Publish(ctx context.Context, ev models.Event) error {
+	_, err := models.EnqueueDeliveries(ctx, ev)
+	return err
+}
+
+// ErrInternalAddress is the error of an attempt at a receiver on a
+// loopback, private, link-local or other internal address.
+var ErrInternalAddress = errors.New("receiver address is not public")
+
+// internalPrefixes are the ranges beyond those netip classifies that
+// shouldn't be reachable through a subscription.
+var internalPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"), // shared address space, cloud metadata among it
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+}
+
+// publicAddr reports whether ip may be dialled for a delivery.
+func publicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	for _, p := range internalPrefixes {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// NewClient returns the client deliveries are sent with. Subscriptions can
+// name any URL, so it only connects to public addresses, checked on the
+// address actually dialled so DNS can't point it inside, and it hands back
+// redirects rather than following them. It uses no proxy, which would be
+// the address checked instead.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			ap, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !publicAddr(ap.Addr()) {
+				return fmt.Errorf("%w: %s", ErrInternalAddress, ap.Addr())
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// defaultClient sends deliveries for a Dispatcher without a Client.
+var defaultClient = NewClient(0)
+
+// Dispatcher sends queued deliveries.
+type Dispatcher struct {
+	// Client sends the deliveries; nil uses NewClient's, without a
+	// timeout. Another client should be as careful about where it
+	// connects.
+	Client *http.Client
+	// Interval is how often the queue is polled when it is idle.
+	Interval time.Duration
+	// BatchSize is how many deliveries are sent at once.
+	BatchSize int
+	// MaxAttempts is how many times a delivery is tried before it is
+	// marked dead.
+	MaxAttempts int
+	// Backoff is the wait after the first failure; it doubles with every
+	// further failure, up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Retention is how long successful deliveries are logged; zero keeps
+	// them forever.
+	Retention time.Duration
+}
+
+// Run sends deliveries as they fall due until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	var lastPurge time.Time
+	for {
+		wait := d.Interval
+		n, err := d.Dispatch(ctx)
+		switch {
+		case err != nil:
+			slog.WarnContext(ctx, "dispatching webhooks failed", "error", err)
+		case n == d.BatchSize:
+			wait = 0
+		}
+
+		if d.Retention > 0 && time.Since(lastPurge) > time.Hour {
+			lastPurge = time.Now()
+			if purged, err := models.PurgeDeliveries(ctx, lastPurge.Add(-d.Retention)); err != nil {
+				slog.WarnContext(ctx, "purging webhook deliveries failed", "error", err)
+			} else if purged > 0 {
+				slog.InfoContext(ctx, "purged webhook deliveries", "count", purged)
+			}
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// Dispatch sends one batch of due deliveries concurrently and returns how
+// many were attempted.
+func (d *Dispatcher) Dispatch(ctx context.Context) (int, error) {
+	deliveries, err := models.ClaimDeliveries(ctx, d.BatchSize, d.lease())
+	if err != nil {
+		return 0, err
+	}
+	var wg sync.WaitGroup
+	for i := range deliveries {
+		wg.Add(1)
+		go func(del *models.WebhookDelivery) {
+			defer wg.Done()
+			attempt := d.send(ctx, del)
+			status, next := d.outcome(del.Attempts+1, attempt)
+			if err := models.RecordAttempt(ctx, del, attempt, status, next); err != nil {
+				slog.WarnContext(ctx, "recording webhook attempt failed", "delivery_id", del.ID, "error", err)
+				return
+			}
+			if status == models.DeliveryDead {
+				slog.WarnContext(ctx, "webhook delivery dead", "webhook_id", del.WebhookID, "delivery_id", del.ID,
+					"event_id", del.EventID, "attempts", del.Attempts, "error", attempt.Error)
+			}
+		}(&deliveries[i])
+	}
+	wg.Wait()
+	return len(deliveries), nil
+}
+
+// send POSTs a delivery's event to its subscription and reports how it
+// went.
+func (d *Dispatcher) send(ctx context.Context, del *models.WebhookDelivery) models.WebhookAttempt {
+	start := time.Now()
+	attempt := models.WebhookAttempt{AttemptedAt: start}
+	body := []byte(del.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, del.Webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "bookstore-app-webhooks")
+	req.Header.Set("X-Event-ID", del.EventID)
+	req.Header.Set("X-Event-Type", del.EventType)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatUint(uint64(del.ID), 10))
+	req.Header.Set(SignatureHeader, Sign(del.Webhook.Secret, start, body))
+
+	client := d.Client
+	if client == nil {
+		client = defaultClient
+	}
+	resp, err := client.Do(req)
+	attempt.Duration = time.Since(start).Milliseconds()
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+	logged, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseLog))
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	attempt.StatusCode = resp.StatusCode
+	attempt.Response = string(logged)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		attempt.Error = fmt.Sprintf("receiver answered %s", resp.Status)
+	}
+	return attempt
+}
+
+// outcome decides what becomes of a delivery after its attempt'th try.
+func (d *Dispatcher) outcome(attempt int, a models.WebhookAttempt) (status string, next time.Time) {
+	now := time.Now()
+	switch {
+	case a.Error == "":
+		return models.DeliverySucceeded, now
+	case attempt >= d.MaxAttempts:
+		return models.DeliveryDead, now
+	default:
+		return models.DeliveryPending, now.Add(d.backoff(attempt))
+	}
+}
+
+// backoff is the wait after the attempt'th failure.
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	wait := d.Backoff
+	for i := 1; i < attempt && wait < d.MaxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, d.MaxBackoff)
+}
+
+// lease is how long a claimed delivery is kept from other dispatchers,
+// comfortably longer than an attempt can take.
+func (d *Dispatcher) lease() time.Duration {
+	if d.Client != nil && d.Client.Timeout > 0 {
+		return d.Client.Timeout + time.Minute
+	}
+	return 5 * time.Minute
+}
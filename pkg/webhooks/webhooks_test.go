@@ -0,0 +1,133 @@
+package webhooks
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adedaryorh/bookstore-app/pkg/models"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	body := []byte(`{"id":"e1"}`)
+	now := time.Unix(1700000000, 0)
+	sig := Sign("whsec_test", now, body)
+
+	if err := Verify("whsec_test", sig, body, 5*time.Minute, now.Add(time.Minute)); err != nil {
+		t.Errorf("valid signature rejected: %v", err)
+	}
+	for name, check := range map[string]error{
+		"wrong secret": Verify("whsec_other", sig, body, 5*time.Minute, now),
+		"altered body": Verify("whsec_test", sig, []byte(`{"id":"e2"}`), 5*time.Minute, now),
+		"too old":      Verify("whsec_test", sig, body, 5*time.Minute, now.Add(time.Hour)),
+		"malformed":    Verify("whsec_test", "v1=abc", body, 5*time.Minute, now),
+	} {
+		if check != ErrBadSignature {
+			t.Errorf("%s: got %v want %v", name, check, ErrBadSignature)
+		}
+	}
+}
+
+func TestDispatcherSend(t *testing.T) {
+	var header http.Header
+	var body []byte
+	status := http.StatusNoContent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+		w.Write([]byte("nope"))
+	}))
+	defer srv.Close()
+
+	d := &Dispatcher{Client: srv.Client()}
+	del := &models.WebhookDelivery{
+		ID:        12,
+		EventID:   "e1",
+		EventType: models.EventBookUpdated,
+		Payload:   `{"id":"e1","type":"book.updated"}`,
+		Webhook:   &models.Webhook{URL: srv.URL, Secret: "whsec_test"},
+	}
+
+	a := d.send(context.Background(), del)
+	if a.Error != "" || a.StatusCode != http.StatusNoContent {
+		t.Fatalf("delivery should succeed: %+v", a)
+	}
+	if string(body) != del.Payload {
+		t.Errorf("wrong body: %s", body)
+	}
+	if header.Get("X-Event-ID") != "e1" || header.Get("X-Webhook-Delivery") != "12" {
+		t.Errorf("wrong headers: %v", header)
+	}
+	if err := Verify("whsec_test", header.Get(SignatureHeader), body, time.Minute, time.Now()); err != nil {
+		t.Errorf("signature does not verify: %v", err)
+	}
+
+	status = http.StatusInternalServerError
+	a = d.send(context.Background(), del)
+	if a.Error == "" || a.StatusCode != http.StatusInternalServerError || a.Response != "nope" {
+		t.Errorf("failure not recorded: %+v", a)
+	}
+}
+
+func TestDispatcherOutcome(t *testing.T) {
+	d := &Dispatcher{MaxAttempts: 4, Backoff: time.Minute, MaxBackoff: 3 * time.Minute}
+	failed := models.WebhookAttempt{Error: "receiver answered 500"}
+
+	if status, _ := d.outcome(1, models.WebhookAttempt{StatusCode: 200}); status != models.DeliverySucceeded {
+		t.Errorf("success: got %v want %v", status, models.DeliverySucceeded)
+	}
+	for attempt, want := range map[int]time.Duration{1: time.Minute, 2: 2 * time.Minute, 3: 3 * time.Minute} {
+		status, next := d.outcome(attempt, failed)
+		if status != models.DeliveryPending {
+			t.Errorf("attempt %d: got %v want %v", attempt, status, models.DeliveryPending)
+		}
+		if wait := time.Until(next).Round(time.Second); wait != want {
+			t.Errorf("attempt %d: retry in %v want %v", attempt, wait, want)
+		}
+	}
+	if status, _ := d.outcome(4, failed); status != models.DeliveryDead {
+		t.Errorf("last attempt: got %v want %v", status, models.DeliveryDead)
+	}
+}
+
+func TestNewClientRefusesInternalAddresses(t *testing.T) {
+	for addr, public := range map[string]bool{
+		"93.184.215.14":    true,
+		"2606:4700::1111":  true,
+		"127.0.0.1":        false,
+		"::1":              false,
+		"::ffff:127.0.0.1": false,
+		"10.1.2.3":         false,
+		"172.16.0.1":       false,
+		"192.168.1.1":      false,
+		"169.254.169.254":  false,
+		"100.100.100.200":  false,
+		"fd00:ec2::254":    false,
+		"fe80::1":          false,
+		"0.0.0.0":          false,
+	} {
+		if got := publicAddr(netip.MustParseAddr(addr)); got != public {
+			t.Errorf("%s: got public %v want %v", addr, got, public)
+		}
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the client should not connect to a loopback receiver")
+	}))
+	defer srv.Close()
+	d := &Dispatcher{Client: NewClient(time.Second)}
+	a := d.send(context.Background(), &models.WebhookDelivery{Payload: "{}", Webhook: &models.Webhook{URL: srv.URL}})
+	if !strings.Contains(a.Error, ErrInternalAddress.Error()) {
+		t.Errorf("got attempt %+v, want %v", a, ErrInternalAddress)
+	}
+
+	if err := NewClient(0).CheckRedirect(nil, nil); err != http.ErrUseLastResponse {
+		t.Errorf("redirects should not be followed: got %v", err)
+	}
+}